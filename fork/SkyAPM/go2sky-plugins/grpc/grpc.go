@@ -0,0 +1,94 @@
+// Licensed to SkyAPM org under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. SkyAPM org licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package grpc is a plugin creating an entry span for the calls received by
+// a gRPC server.
+package grpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky"
+	v3 "github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter/grpc/language-agent"
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const componentIDGoGrpcServer = 23
+
+// UnaryServerInterceptor traces the unary calls, continuing the trace of the
+// sw8 metadata of the client.
+func UnaryServerInterceptor(tracer *go2sky.Tracer) gogrpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *gogrpc.UnaryServerInfo, handler gogrpc.UnaryHandler) (interface{}, error) {
+		span, ctx, ok := createEntrySpan(ctx, tracer, info.FullMethod)
+		resp, err := handler(ctx, req)
+		if ok {
+			endSpan(span, err)
+		}
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor traces the streams.
+func StreamServerInterceptor(tracer *go2sky.Tracer) gogrpc.StreamServerInterceptor {
+	return func(srv interface{}, ss gogrpc.ServerStream, info *gogrpc.StreamServerInfo, handler gogrpc.StreamHandler) error {
+		span, ctx, ok := createEntrySpan(ss.Context(), tracer, info.FullMethod)
+		err := handler(srv, &tracedStream{ServerStream: ss, ctx: ctx})
+		if ok {
+			endSpan(span, err)
+		}
+		return err
+	}
+}
+
+func createEntrySpan(ctx context.Context, tracer *go2sky.Tracer, method string) (go2sky.Span, context.Context, bool) {
+	if tracer == nil {
+		return nil, ctx, false
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	span, nCtx, _, err := tracer.CreateEntrySpan(ctx, method, func(key string) (string, error) {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0], nil
+		}
+		return "", nil
+	})
+	if err != nil {
+		return nil, ctx, false
+	}
+	span.SetComponent(componentIDGoGrpcServer)
+	span.SetSpanLayer(v3.SpanLayer_RPCFramework)
+	return span, nCtx, true
+}
+
+func endSpan(span go2sky.Span, err error) {
+	if err != nil {
+		span.Error(time.Now(), err.Error())
+	}
+	span.Tag(go2sky.TagStatusCode, status.Code(err).String())
+	span.End()
+}
+
+type tracedStream struct {
+	gogrpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedStream) Context() context.Context {
+	return s.ctx
+}
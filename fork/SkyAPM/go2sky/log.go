@@ -0,0 +1,73 @@
+// Licensed to SkyAPM org under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. SkyAPM org licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package go2sky
+
+import (
+	"context"
+	"strconv"
+)
+
+const (
+	EmptyTraceSegmentID = "N/A"
+	EmptySpanID         = -1
+)
+
+// SkyWalkingContext identifies the active span of a context in logs, so the
+// SkyWalking UI can link them to their trace.
+type SkyWalkingContext struct {
+	ServiceName         string
+	ServiceInstanceName string
+	TraceID             string
+	TraceSegmentID      string
+	SpanID              int32
+	ParentSpanID        int32
+}
+
+// FromGoContext returns the SkyWalking context of the active span of ctx. The
+// IDs are EmptyTraceID, EmptyTraceSegmentID and EmptySpanID when ctx has no
+// span, and the trace ID is NoopTraceID when the span is not sampled.
+func FromGoContext(ctx context.Context) SkyWalkingContext {
+	sc := SkyWalkingContext{
+		TraceID:        EmptyTraceID,
+		TraceSegmentID: EmptyTraceSegmentID,
+		SpanID:         EmptySpanID,
+		ParentSpanID:   EmptySpanID,
+	}
+	switch span := ctx.Value(ctxKeyInstance).(type) {
+	case segmentSpan:
+		segment := span.context()
+		sc.TraceID = segment.TraceID
+		sc.TraceSegmentID = segment.SegmentID
+		sc.SpanID = segment.SpanID
+		sc.ParentSpanID = segment.ParentSpanID
+		if t := span.tracer(); t != nil {
+			sc.ServiceName = t.service
+			sc.ServiceInstanceName = t.instance
+		}
+	case *NoopSpan:
+		sc.TraceID = NoopTraceID
+	}
+	return sc
+}
+
+// String formats the context as the SW_CTX field of the SkyWalking logs:
+// [service,instance,traceId,segmentId,spanId].
+func (sc SkyWalkingContext) String() string {
+	return "[" + sc.ServiceName + "," + sc.ServiceInstanceName + "," + sc.TraceID + "," +
+		sc.TraceSegmentID + "," + strconv.FormatInt(int64(sc.SpanID), 10) + "]"
+}
@@ -64,6 +64,9 @@ type SpanContext struct {
 	Sample                int8              `json:"sample"`
 	Valid                 bool              `json:"valid"`
 	CorrelationContext    map[string]string `json:"correlation_context"`
+	// TraceState are the tracestate members of other vendors, extracted and
+	// injected again by W3C.
+	TraceState string `json:"trace_state"`
 }
 
 // Decode all SpanContext data from Extractor
@@ -0,0 +1,390 @@
+// Licensed to SkyAPM org under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. SkyAPM org licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package propagation
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	HeaderTraceParent string = "traceparent"
+	HeaderTraceState  string = "tracestate"
+	HeaderB3          string = "b3"
+	HeaderB3TraceID   string = "X-B3-TraceId"
+	HeaderB3SpanID    string = "X-B3-SpanId"
+	HeaderB3Sampled   string = "X-B3-Sampled"
+	HeaderB3Flags     string = "X-B3-Flags"
+
+	// traceStateKey is the tracestate entry carrying the SkyWalking parent of
+	// a traceparent written by Inject.
+	traceStateKey string = "sw8"
+	// maxTraceStateValue and maxTraceStateMembers are the limits of W3C
+	// Trace Context on a tracestate value and on the number of members.
+	maxTraceStateValue   = 256
+	maxTraceStateMembers = 32
+)
+
+var (
+	errInvalidTraceParent = errors.New("invalid traceparent header")
+	errInvalidB3          = errors.New("invalid b3 header")
+)
+
+// Propagator reads and writes a SpanContext in the headers of one format.
+type Propagator interface {
+	// Extract decodes the parent context from the headers read by extractor,
+	// tc is left invalid when they are absent.
+	Extract(tc *SpanContext, extractor Extractor) error
+	// Inject encodes tc in the headers written by injector.
+	Inject(tc *SpanContext, injector Injector) error
+}
+
+// SW8 propagates the SpanContext in the sw8 and sw8-correlation headers of
+// SkyWalking.
+var SW8 Propagator = sw8Propagator{}
+
+type sw8Propagator struct{}
+
+func (sw8Propagator) Extract(tc *SpanContext, extractor Extractor) error {
+	return tc.Decode(extractor)
+}
+
+func (sw8Propagator) Inject(tc *SpanContext, injector Injector) error {
+	return tc.Encode(injector)
+}
+
+// W3C propagates the SpanContext in the traceparent and tracestate headers of
+// W3C Trace Context. The SkyWalking trace ID and span are mapped to hex IDs,
+// see TraceIDToHex and SpanIDToHex, and kept with the parent service in the
+// sw8 entry of tracestate so that a SkyWalking callee recovers them.
+var W3C Propagator = w3cPropagator{}
+
+type w3cPropagator struct{}
+
+// Extract reads a traceparent of version 00, the hex trace ID becomes the
+// trace ID and the parent-id the parent segment, unless tracestate carries the
+// SkyWalking trace and parent these IDs were mapped from. The other members of
+// tracestate are kept in TraceState.
+func (w3cPropagator) Extract(tc *SpanContext, extractor Extractor) error {
+	tc.Valid = false
+	header, err := extractor(HeaderTraceParent)
+	if err != nil || header == "" {
+		return err
+	}
+	hh := strings.Split(strings.TrimSpace(header), "-")
+	if len(hh) < 4 || hh[0] == "ff" || len(hh[0]) != 2 || (hh[0] == "00" && len(hh) != 4) ||
+		!isHexID(hh[1], 32) || !isHexID(hh[2], 16) || !isHex(hh[3], 2) {
+		return errors.WithMessagef(errInvalidTraceParent, "header string: %s", header)
+	}
+	flags, _ := strconv.ParseUint(hh[3], 16, 8)
+	tc.Sample = int8(flags & 1)
+	tc.TraceID = hh[1]
+	tc.ParentSegmentID = hh[2]
+	tc.ParentSpanID = 0
+	tc.ParentService, tc.ParentServiceInstance, tc.ParentEndpoint, tc.AddressUsedAtClient = "", "", "", ""
+	tc.CorrelationContext = map[string]string{}
+
+	state, err := extractor(HeaderTraceState)
+	if err != nil {
+		return err
+	}
+	tc.TraceState = strings.Join(traceStateMembers(state, traceStateKey), ",")
+	if value := traceStateValue(state, traceStateKey); value != "" {
+		var parent SpanContext
+		if parent.decodeTraceState(value) == nil && TraceIDToHex(parent.TraceID) == hh[1] &&
+			SpanIDToHex(parent.ParentSegmentID, parent.ParentSpanID) == hh[2] {
+			tc.TraceID = parent.TraceID
+			tc.ParentSegmentID = parent.ParentSegmentID
+			tc.ParentSpanID = parent.ParentSpanID
+			tc.ParentService = parent.ParentService
+			tc.ParentServiceInstance = parent.ParentServiceInstance
+			tc.ParentEndpoint = parent.ParentEndpoint
+			tc.AddressUsedAtClient = parent.AddressUsedAtClient
+		}
+	}
+	tc.Valid = true
+	return nil
+}
+
+// Inject writes the traceparent of tc and a tracestate starting with its sw8
+// entry, followed by the members of TraceState up to the limit of 32. The sw8
+// entry is left out when its value exceeds the 256 characters allowed, and
+// tracestate when it has no member.
+func (w3cPropagator) Inject(tc *SpanContext, injector Injector) error {
+	flags := "00"
+	if tc.Sample != 0 {
+		flags = "01"
+	}
+	err := injector(HeaderTraceParent, strings.Join([]string{
+		"00", TraceIDToHex(tc.TraceID), SpanIDToHex(tc.ParentSegmentID, tc.ParentSpanID), flags,
+	}, "-"))
+	if err != nil {
+		return err
+	}
+	var members []string
+	if value := tc.encodeTraceState(); len(value) <= maxTraceStateValue {
+		members = append(members, traceStateKey+"="+value)
+	}
+	members = append(members, traceStateMembers(tc.TraceState, traceStateKey)...)
+	if len(members) > maxTraceStateMembers {
+		members = members[:maxTraceStateMembers]
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	return injector(HeaderTraceState, strings.Join(members, ","))
+}
+
+// encodeTraceState encodes the sw8 fields of tc with the characters allowed
+// in a tracestate value, base64url encoded and joined by dots.
+func (tc *SpanContext) encodeTraceState() string {
+	return strings.Join([]string{
+		base64.RawURLEncoding.EncodeToString([]byte(tc.TraceID)),
+		base64.RawURLEncoding.EncodeToString([]byte(tc.ParentSegmentID)),
+		strconv.Itoa(int(tc.ParentSpanID)),
+		base64.RawURLEncoding.EncodeToString([]byte(tc.ParentService)),
+		base64.RawURLEncoding.EncodeToString([]byte(tc.ParentServiceInstance)),
+		base64.RawURLEncoding.EncodeToString([]byte(tc.ParentEndpoint)),
+		base64.RawURLEncoding.EncodeToString([]byte(tc.AddressUsedAtClient)),
+	}, ".")
+}
+
+func (tc *SpanContext) decodeTraceState(value string) (err error) {
+	hh := strings.Split(value, ".")
+	if len(hh) != 7 {
+		return errInsufficientHeaderEntities
+	}
+	fields := []*string{&tc.TraceID, &tc.ParentSegmentID, nil, &tc.ParentService, &tc.ParentServiceInstance, &tc.ParentEndpoint, &tc.AddressUsedAtClient}
+	for i, field := range fields {
+		if field == nil {
+			continue
+		}
+		b, err := base64.RawURLEncoding.DecodeString(hh[i])
+		if err != nil {
+			return err
+		}
+		*field = string(b)
+	}
+	tc.ParentSpanID, err = stringConvertInt32(hh[2])
+	return err
+}
+
+// traceStateValue returns the value of the entry key of a tracestate header.
+func traceStateValue(state, key string) string {
+	for _, entry := range strings.Split(state, ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(entry), "="); ok && k == key {
+			return v
+		}
+	}
+	return ""
+}
+
+// traceStateMembers returns the non empty members of a tracestate header but
+// the entry skip.
+func traceStateMembers(state, skip string) []string {
+	var members []string
+	for _, member := range strings.Split(state, ",") {
+		member = strings.TrimSpace(member)
+		if k, _, _ := strings.Cut(member, "="); member != "" && k != skip {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+// B3 propagates the SpanContext in the single b3 header of Zipkin, and
+// B3Multi in the X-B3-* headers. Both extract either form.
+var (
+	B3      Propagator = b3Propagator{single: true}
+	B3Multi Propagator = b3Propagator{}
+)
+
+type b3Propagator struct {
+	single bool
+}
+
+// Extract reads the b3 header, or the X-B3-* headers when it is absent. A
+// 64 bits trace ID is padded to 128 bits, the span ID becomes the parent
+// segment.
+func (p b3Propagator) Extract(tc *SpanContext, extractor Extractor) error {
+	tc.Valid = false
+	header, err := extractor(HeaderB3)
+	if err != nil {
+		return err
+	}
+	var traceID, spanID, sampled string
+	if header = strings.TrimSpace(header); header != "" {
+		hh := strings.Split(header, "-")
+		if len(hh) == 1 {
+			// b3: 0 only carries the sampling decision
+			if hh[0] == "0" || hh[0] == "1" || hh[0] == "d" {
+				return nil
+			}
+			return errors.WithMessagef(errInvalidB3, "header string: %s", header)
+		}
+		traceID, spanID = hh[0], hh[1]
+		if len(hh) > 2 {
+			sampled = hh[2]
+		}
+	} else {
+		if traceID, err = extractor(HeaderB3TraceID); err != nil {
+			return err
+		}
+		if spanID, err = extractor(HeaderB3SpanID); err != nil {
+			return err
+		}
+		if traceID == "" && spanID == "" {
+			return nil
+		}
+		if sampled, err = extractor(HeaderB3Sampled); err != nil {
+			return err
+		}
+		flags, err := extractor(HeaderB3Flags)
+		if err != nil {
+			return err
+		}
+		if flags == "1" {
+			sampled = "d"
+		}
+	}
+	traceID, spanID = strings.ToLower(traceID), strings.ToLower(spanID)
+	if len(traceID) == 16 {
+		traceID = strings.Repeat("0", 16) + traceID
+	}
+	if !isHexID(traceID, 32) || !isHexID(spanID, 16) {
+		return errors.WithMessagef(errInvalidB3, "trace id: %s, span id: %s", traceID, spanID)
+	}
+	tc.Sample = 1
+	if sampled == "0" || sampled == "false" {
+		tc.Sample = 0
+	}
+	tc.TraceID = traceID
+	tc.ParentSegmentID = spanID
+	tc.ParentSpanID = 0
+	tc.ParentService, tc.ParentServiceInstance, tc.ParentEndpoint, tc.AddressUsedAtClient = "", "", "", ""
+	tc.CorrelationContext = map[string]string{}
+	tc.TraceState = ""
+	tc.Valid = true
+	return nil
+}
+
+func (p b3Propagator) Inject(tc *SpanContext, injector Injector) error {
+	traceID, spanID, sampled := TraceIDToHex(tc.TraceID), SpanIDToHex(tc.ParentSegmentID, tc.ParentSpanID), "0"
+	if tc.Sample != 0 {
+		sampled = "1"
+	}
+	if p.single {
+		return injector(HeaderB3, strings.Join([]string{traceID, spanID, sampled}, "-"))
+	}
+	for _, h := range [][2]string{{HeaderB3TraceID, traceID}, {HeaderB3SpanID, spanID}, {HeaderB3Sampled, sampled}} {
+		if err := injector(h[0], h[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewCompositePropagator returns a Propagator extracting the context of the
+// first propagators whose headers are present, in the order given, and
+// injecting the context with all of them.
+func NewCompositePropagator(propagators ...Propagator) Propagator {
+	return compositePropagator(propagators)
+}
+
+type compositePropagator []Propagator
+
+// Extract skips the malformed headers while a later propagator finds a valid
+// context, the error of the first one is returned otherwise.
+func (c compositePropagator) Extract(tc *SpanContext, extractor Extractor) error {
+	var first error
+	for _, p := range c {
+		var sc SpanContext
+		err := p.Extract(&sc, extractor)
+		if err == nil && sc.Valid {
+			*tc = sc
+			return nil
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	tc.Valid = false
+	return first
+}
+
+func (c compositePropagator) Inject(tc *SpanContext, injector Injector) error {
+	for _, p := range c {
+		if err := p.Inject(tc, injector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TraceIDToHex maps a SkyWalking trace ID to the 32 hex digits of a W3C or B3
+// trace ID. A trace ID already in this form, as extracted from these headers,
+// is kept, others are hashed so that every service maps them alike.
+func TraceIDToHex(traceID string) string {
+	if isHexID(traceID, 32) {
+		return traceID
+	}
+	sum := sha256.Sum256([]byte(traceID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// SpanIDToHex maps the span spanID of the segment segmentID to the 16 hex
+// digits of a W3C or B3 span ID. The parent-id extracted from these headers is
+// the segment ID of a span 0, and is kept.
+func SpanIDToHex(segmentID string, spanID int32) string {
+	if spanID == 0 && isHexID(segmentID, 16) {
+		return segmentID
+	}
+	h := fnv.New64a()
+	h.Write([]byte(segmentID))
+	h.Write([]byte{'-'})
+	h.Write([]byte(strconv.Itoa(int(spanID))))
+	id := h.Sum64()
+	if id == 0 {
+		id = 1
+	}
+	return fmt.Sprintf("%016x", id)
+}
+
+// isHexID reports whether s is n lower case hex digits, not all zero.
+func isHexID(s string, n int) bool {
+	return isHex(s, n) && strings.Trim(s, "0") != ""
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,312 @@
+// Licensed to SkyAPM org under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. SkyAPM org licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package propagation
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func extractor(h http.Header) Extractor {
+	return func(key string) (string, error) { return h.Get(key), nil }
+}
+
+func injector(h http.Header) Injector {
+	return func(key, value string) error {
+		h.Set(key, value)
+		return nil
+	}
+}
+
+// parent is the context of an exit span injected by a SkyWalking service.
+func parent() *SpanContext {
+	return &SpanContext{
+		Sample:                1,
+		TraceID:               "10.0.0.1-1660000000000-000001-1-42",
+		ParentSegmentID:       "10.0.0.1-1660000000000-000002-2-42",
+		ParentSpanID:          3,
+		ParentService:         "gateway",
+		ParentServiceInstance: "gateway-1",
+		ParentEndpoint:        "/GET/api/users",
+		AddressUsedAtClient:   "users:8080",
+		CorrelationContext:    map[string]string{},
+	}
+}
+
+func TestW3CExtract(t *testing.T) {
+	for _, tt := range []struct {
+		name, traceparent string
+		want              *SpanContext
+		err               bool
+	}{
+		{name: "absent"},
+		{
+			name:        "sampled",
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			want: &SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", ParentSegmentID: "00f067aa0ba902b7",
+				Sample: 1, Valid: true, CorrelationContext: map[string]string{}},
+		},
+		{
+			name:        "future version",
+			traceparent: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra",
+			want: &SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", ParentSegmentID: "00f067aa0ba902b7",
+				Valid: true, CorrelationContext: map[string]string{}},
+		},
+		{name: "zero trace id", traceparent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", err: true},
+		{name: "upper case", traceparent: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01", err: true},
+		{name: "version ff", traceparent: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if tt.traceparent != "" {
+				h.Set(HeaderTraceParent, tt.traceparent)
+			}
+			var tc SpanContext
+			err := W3C.Extract(&tc, extractor(h))
+			if (err != nil) != tt.err {
+				t.Fatalf("Extract error = %v, want error %v", err, tt.err)
+			}
+			if tt.want == nil {
+				if tc.Valid {
+					t.Errorf("Extract = %+v, want invalid", tc)
+				}
+				return
+			}
+			if !reflect.DeepEqual(&tc, tt.want) {
+				t.Errorf("Extract = %+v, want %+v", tc, tt.want)
+			}
+		})
+	}
+}
+
+func TestW3CRoundTrip(t *testing.T) {
+	h := http.Header{}
+	if err := W3C.Inject(parent(), injector(h)); err != nil {
+		t.Fatal(err)
+	}
+	traceID := TraceIDToHex(parent().TraceID)
+	spanID := SpanIDToHex(parent().ParentSegmentID, parent().ParentSpanID)
+	if want := "00-" + traceID + "-" + spanID + "-01"; h.Get(HeaderTraceParent) != want {
+		t.Errorf("traceparent = %s, want %s", h.Get(HeaderTraceParent), want)
+	}
+
+	// a SkyWalking callee recovers the whole context from tracestate
+	var tc SpanContext
+	if err := W3C.Extract(&tc, extractor(h)); err != nil {
+		t.Fatal(err)
+	}
+	want := parent()
+	want.Valid = true
+	if !reflect.DeepEqual(&tc, want) {
+		t.Errorf("Extract = %+v, want %+v", tc, want)
+	}
+
+	// a service in between changed the parent-id, tracestate is stale
+	h.Set(HeaderTraceParent, "00-"+traceID+"-b7ad6b7169203331-01")
+	h.Set(HeaderTraceState, "vendor=x,"+h.Get(HeaderTraceState))
+	if err := W3C.Extract(&tc, extractor(h)); err != nil {
+		t.Fatal(err)
+	}
+	if tc.TraceID != traceID || tc.ParentSegmentID != "b7ad6b7169203331" || tc.ParentService != "" {
+		t.Errorf("Extract = %+v, want the IDs of traceparent", tc)
+	}
+}
+
+func TestW3CTraceState(t *testing.T) {
+	h := http.Header{}
+	if err := W3C.Inject(parent(), injector(h)); err != nil {
+		t.Fatal(err)
+	}
+	sw8 := h.Get(HeaderTraceState)
+
+	// the members of other vendors are kept, the stale sw8 entry is not
+	h.Set(HeaderTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set(HeaderTraceState, "congo=t61rcWkgMzE, "+sw8+",, rojo=00f067aa0ba902b7")
+	var tc SpanContext
+	if err := W3C.Extract(&tc, extractor(h)); err != nil {
+		t.Fatal(err)
+	}
+	if tc.TraceState != "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7" {
+		t.Errorf("TraceState = %q, want the congo and rojo members", tc.TraceState)
+	}
+
+	// the sw8 entry of the callee comes first
+	tc = *parent()
+	tc.TraceState = "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7"
+	out := http.Header{}
+	if err := W3C.Inject(&tc, injector(out)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.Get(HeaderTraceState), sw8+",congo=t61rcWkgMzE,rojo=00f067aa0ba902b7"; got != want {
+		t.Errorf("tracestate = %s, want %s", got, want)
+	}
+
+	// up to 32 members
+	var members []string
+	for i := 0; i < 40; i++ {
+		members = append(members, fmt.Sprintf("v%d=%d", i, i))
+	}
+	tc.TraceState = strings.Join(members, ",")
+	if err := W3C.Inject(&tc, injector(out)); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Split(out.Get(HeaderTraceState), ","); len(got) != 32 || got[0] != sw8 || got[31] != "v30=30" {
+		t.Errorf("tracestate = %v, want sw8 and the first 31 members", got)
+	}
+
+	// an sw8 value over 256 characters is left out
+	tc.ParentEndpoint = "/GET/" + strings.Repeat("a", 256)
+	tc.TraceState = "congo=t61rcWkgMzE"
+	if err := W3C.Inject(&tc, injector(out)); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Get(HeaderTraceState); got != "congo=t61rcWkgMzE" {
+		t.Errorf("tracestate = %s, want the congo member only", got)
+	}
+	if want := "00-" + TraceIDToHex(tc.TraceID) + "-" + SpanIDToHex(tc.ParentSegmentID, tc.ParentSpanID) + "-01"; out.Get(HeaderTraceParent) != want {
+		t.Errorf("traceparent = %s, want %s", out.Get(HeaderTraceParent), want)
+	}
+	tc.TraceState = ""
+	out = http.Header{}
+	if err := W3C.Inject(&tc, injector(out)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := out[http.CanonicalHeaderKey(HeaderTraceState)]; ok {
+		t.Errorf("tracestate = %q, want none without member", out.Get(HeaderTraceState))
+	}
+}
+
+func TestB3(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		headers map[string]string
+		want    *SpanContext
+		err     bool
+	}{
+		{name: "absent"},
+		{name: "deny", headers: map[string]string{HeaderB3: "0"}},
+		{
+			name:    "single",
+			headers: map[string]string{HeaderB3: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90"},
+			want: &SpanContext{TraceID: "80f198ee56343ba864fe8b2a57d3eff7", ParentSegmentID: "e457b5a2e4d86bd1",
+				Sample: 1, Valid: true, CorrelationContext: map[string]string{}},
+		},
+		{
+			name: "multi 64 bits",
+			headers: map[string]string{HeaderB3TraceID: "64fe8b2a57d3eff7", HeaderB3SpanID: "e457b5a2e4d86bd1",
+				HeaderB3Sampled: "0"},
+			want: &SpanContext{TraceID: "000000000000000064fe8b2a57d3eff7", ParentSegmentID: "e457b5a2e4d86bd1",
+				Valid: true, CorrelationContext: map[string]string{}},
+		},
+		{name: "bad span id", headers: map[string]string{HeaderB3: "80f198ee56343ba864fe8b2a57d3eff7-xyz"}, err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.headers {
+				h.Set(k, v)
+			}
+			var tc SpanContext
+			err := B3Multi.Extract(&tc, extractor(h))
+			if (err != nil) != tt.err {
+				t.Fatalf("Extract error = %v, want error %v", err, tt.err)
+			}
+			if tt.want == nil {
+				if tc.Valid {
+					t.Errorf("Extract = %+v, want invalid", tc)
+				}
+				return
+			}
+			if !reflect.DeepEqual(&tc, tt.want) {
+				t.Errorf("Extract = %+v, want %+v", tc, tt.want)
+			}
+		})
+	}
+
+	single, multi := http.Header{}, http.Header{}
+	if err := B3.Inject(parent(), injector(single)); err != nil {
+		t.Fatal(err)
+	}
+	if err := B3Multi.Inject(parent(), injector(multi)); err != nil {
+		t.Fatal(err)
+	}
+	traceID := TraceIDToHex(parent().TraceID)
+	spanID := SpanIDToHex(parent().ParentSegmentID, parent().ParentSpanID)
+	if want := traceID + "-" + spanID + "-1"; single.Get(HeaderB3) != want || len(single) != 1 {
+		t.Errorf("single headers = %v, want b3: %s", single, want)
+	}
+	if multi.Get(HeaderB3TraceID) != traceID || multi.Get(HeaderB3SpanID) != spanID || multi.Get(HeaderB3Sampled) != "1" {
+		t.Errorf("multi headers = %v", multi)
+	}
+}
+
+func TestCompositePropagator(t *testing.T) {
+	h := http.Header{}
+	sw8 := parent()
+	sw8.TraceID = "sw8-trace"
+	if err := SW8.Inject(sw8, injector(h)); err != nil {
+		t.Fatal(err)
+	}
+	h.Set(HeaderTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	for _, tt := range []struct {
+		name        string
+		propagators []Propagator
+		want        string
+	}{
+		{name: "sw8 first", propagators: []Propagator{SW8, W3C}, want: "sw8-trace"},
+		{name: "w3c first", propagators: []Propagator{W3C, SW8}, want: "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{name: "absent skipped", propagators: []Propagator{B3, W3C}, want: "4bf92f3577b34da6a3ce929d0e0e4736"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var tc SpanContext
+			if err := NewCompositePropagator(tt.propagators...).Extract(&tc, extractor(h)); err != nil {
+				t.Fatal(err)
+			}
+			if !tc.Valid || tc.TraceID != tt.want {
+				t.Errorf("Extract = %+v, want trace %s", tc, tt.want)
+			}
+		})
+	}
+
+	// a malformed header gives way to the next format
+	h.Set(Header, "malformed")
+	var tc SpanContext
+	if err := NewCompositePropagator(SW8, W3C).Extract(&tc, extractor(h)); err != nil || !tc.Valid {
+		t.Errorf("Extract = %+v, %v, want the traceparent context", tc, err)
+	}
+	h.Del(HeaderTraceParent)
+	if err := NewCompositePropagator(SW8, W3C).Extract(&tc, extractor(h)); err == nil || tc.Valid {
+		t.Errorf("Extract = %+v, %v, want the sw8 error", tc, err)
+	}
+
+	out := http.Header{}
+	if err := NewCompositePropagator(SW8, W3C, B3).Inject(parent(), injector(out)); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{Header, HeaderTraceParent, HeaderTraceState, HeaderB3} {
+		if out.Get(key) == "" {
+			t.Errorf("Inject did not write %s: %v", key, out)
+		}
+	}
+	if !strings.HasPrefix(out.Get(HeaderTraceState), "sw8=") {
+		t.Errorf("tracestate = %s", out.Get(HeaderTraceState))
+	}
+}
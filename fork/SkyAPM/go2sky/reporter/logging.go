@@ -0,0 +1,484 @@
+// Licensed to SkyAPM org under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. SkyAPM org licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package reporter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logv3 "github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter/grpc/logging"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+// Defaults of a LogDataReporter.
+const (
+	DefaultLogQueueSize     = 10000
+	DefaultLogBatchSize     = 100
+	DefaultLogFlushInterval = time.Second
+	DefaultLogMaxRetries    = 3
+	DefaultLogMinBackoff    = 100 * time.Millisecond
+	DefaultLogMaxBackoff    = 5 * time.Second
+
+	defaultLogTimeout = 5 * time.Second
+)
+
+// ErrLogReporterClosed is returned when flushing a closed LogDataReporter.
+var ErrLogReporterClosed = errors.New("go2sky: log reporter closed")
+
+// LogTransport sends batches of logs to the backend.
+type LogTransport interface {
+	SendLogs(ctx context.Context, logs []*logv3.LogData) error
+	Close() error
+}
+
+// LogDecoder converts the raw logs queued by LogDataReporter.ReportRaw, it is
+// called from the goroutine sending the logs.
+type LogDecoder func(raw []byte) (*logv3.LogData, error)
+
+// LogReporterStats counts the logs handled by a LogDataReporter.
+type LogReporterStats struct {
+	// Queued is the number of logs waiting to be sent.
+	Queued int
+	// Sent is the number of logs accepted by the backend.
+	Sent uint64
+	// Dropped is the number of logs discarded because the queue was full or
+	// the reporter closed.
+	Dropped uint64
+	// Failed is the number of logs lost because the backend kept failing.
+	Failed uint64
+	// Invalid is the number of raw logs the decoder rejected.
+	Invalid uint64
+}
+
+// LogReporterOption allows for functional options to adjust behaviour
+// of a log reporter to be created by NewLogDataReporter
+type LogReporterOption func(r *LogDataReporter)
+
+// WithLogQueueSize setup the number of logs queued, the logs reported when the
+// queue is full are dropped
+func WithLogQueueSize(size int) LogReporterOption {
+	return func(r *LogDataReporter) {
+		if size > 0 {
+			r.queue = make(chan queuedLog, size)
+		}
+	}
+}
+
+// WithLogBatchSize setup the maximum number of logs sent at once
+func WithLogBatchSize(size int) LogReporterOption {
+	return func(r *LogDataReporter) {
+		if size > 0 {
+			r.batchSize = size
+		}
+	}
+}
+
+// WithLogFlushInterval setup the maximum time a log waits in the queue
+func WithLogFlushInterval(interval time.Duration) LogReporterOption {
+	return func(r *LogDataReporter) {
+		if interval > 0 {
+			r.flushInterval = interval
+		}
+	}
+}
+
+// WithLogRetry setup the retries of a failed batch, waiting minBackoff before
+// the first one and twice as long before each next one, up to maxBackoff
+func WithLogRetry(maxRetries int, minBackoff, maxBackoff time.Duration) LogReporterOption {
+	return func(r *LogDataReporter) {
+		r.maxRetries = maxRetries
+		r.minBackoff = minBackoff
+		r.maxBackoff = maxBackoff
+	}
+}
+
+// WithLogDecoder setup the conversion of the raw logs queued by ReportRaw
+func WithLogDecoder(decode LogDecoder) LogReporterOption {
+	return func(r *LogDataReporter) {
+		r.decode = decode
+	}
+}
+
+// WithLogReporterLogger setup logger for the log reporter
+func WithLogReporterLogger(logger *log.Logger) LogReporterOption {
+	return func(r *LogDataReporter) {
+		r.logger = logger
+	}
+}
+
+// LogDataReporter sends logs to the backend from a background goroutine. Logs
+// are queued by Report and sent in batches through a LogTransport, so a slow
+// backend does not slow down the logging goroutines. The logs queued raw by
+// ReportRaw are converted by the LogDecoder before they are batched, for the
+// same reason.
+type LogDataReporter struct {
+	transport     LogTransport
+	decode        LogDecoder
+	logger        *log.Logger
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+	minBackoff    time.Duration
+	maxBackoff    time.Duration
+
+	// ctx is canceled when Close gives up, to abort the pending sends.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan queuedLog
+	flush  chan logFlushRequest
+	done   chan struct{}
+
+	sent    uint64
+	dropped uint64
+	failed  uint64
+	invalid uint64
+}
+
+// queuedLog is a log queued by Report, or by ReportRaw before its conversion.
+type queuedLog struct {
+	data *logv3.LogData
+	raw  []byte
+}
+
+type logFlushRequest struct {
+	ctx  context.Context
+	done chan error
+}
+
+// NewLogDataReporter creates a reporter sending the logs through transport.
+func NewLogDataReporter(transport LogTransport, opts ...LogReporterOption) *LogDataReporter {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &LogDataReporter{
+		transport:     transport,
+		logger:        log.New(os.Stderr, defaultLogPrefix, log.LstdFlags),
+		batchSize:     DefaultLogBatchSize,
+		flushInterval: DefaultLogFlushInterval,
+		maxRetries:    DefaultLogMaxRetries,
+		minBackoff:    DefaultLogMinBackoff,
+		maxBackoff:    DefaultLogMaxBackoff,
+		ctx:           ctx,
+		cancel:        cancel,
+		queue:         make(chan queuedLog, DefaultLogQueueSize),
+		flush:         make(chan logFlushRequest),
+		done:          make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	go r.run()
+	return r
+}
+
+// Report queues data, it is dropped when the queue is full.
+func (r *LogDataReporter) Report(data *logv3.LogData) {
+	r.enqueue(queuedLog{data: data})
+}
+
+// ReportRaw queues a copy of raw, converted by the LogDecoder of the reporter
+// before it is sent. It is dropped when the queue is full, and counted as
+// invalid when the reporter has no decoder.
+func (r *LogDataReporter) ReportRaw(raw []byte) {
+	if r.decode == nil {
+		atomic.AddUint64(&r.invalid, 1)
+		return
+	}
+	r.enqueue(queuedLog{raw: append([]byte(nil), raw...)})
+}
+
+func (r *LogDataReporter) enqueue(l queuedLog) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		atomic.AddUint64(&r.dropped, 1)
+		return
+	}
+	select {
+	case r.queue <- l:
+	default:
+		atomic.AddUint64(&r.dropped, 1)
+	}
+}
+
+// Flush sends the queued logs and returns when they are sent or ctx is done.
+func (r *LogDataReporter) Flush(ctx context.Context) error {
+	r.mu.RLock()
+	closed := r.closed
+	r.mu.RUnlock()
+	if closed {
+		return ErrLogReporterClosed
+	}
+
+	req := logFlushRequest{ctx: ctx, done: make(chan error, 1)}
+	select {
+	case r.flush <- req:
+	case <-r.done:
+		return ErrLogReporterClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-req.done
+}
+
+// Close stops accepting logs, sends the queued ones until ctx is done and
+// closes the transport. The logs still queued then are dropped.
+func (r *LogDataReporter) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		<-r.done
+		return nil
+	}
+	r.closed = true
+	close(r.queue)
+	r.mu.Unlock()
+
+	defer r.cancel()
+	var err error
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		r.cancel()
+		<-r.done
+		err = ctx.Err()
+	}
+	if cerr := r.transport.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Stats returns the counters of the reporter.
+func (r *LogDataReporter) Stats() LogReporterStats {
+	return LogReporterStats{
+		Queued:  len(r.queue),
+		Sent:    atomic.LoadUint64(&r.sent),
+		Dropped: atomic.LoadUint64(&r.dropped),
+		Failed:  atomic.LoadUint64(&r.failed),
+		Invalid: atomic.LoadUint64(&r.invalid),
+	}
+}
+
+// run batches the queued logs until the queue is closed.
+func (r *LogDataReporter) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*logv3.LogData, 0, r.batchSize)
+	for {
+		select {
+		case l, ok := <-r.queue:
+			if !ok {
+				r.drain(batch)
+				return
+			}
+			batch = r.add(batch, l)
+			if len(batch) >= r.batchSize {
+				r.send(r.ctx, batch)
+				batch = make([]*logv3.LogData, 0, r.batchSize)
+			}
+		case <-ticker.C:
+			r.send(r.ctx, batch)
+			batch = make([]*logv3.LogData, 0, r.batchSize)
+		case req := <-r.flush:
+			req.done <- r.flushQueued(req.ctx, batch)
+			batch = make([]*logv3.LogData, 0, r.batchSize)
+		}
+	}
+}
+
+// flushQueued sends batch and the logs queued when it is called.
+func (r *LogDataReporter) flushQueued(ctx context.Context, batch []*logv3.LogData) error {
+	for n := len(r.queue); n > 0; n-- {
+		l, ok := <-r.queue
+		if !ok {
+			break
+		}
+		batch = r.add(batch, l)
+		if len(batch) >= r.batchSize {
+			r.send(ctx, batch)
+			batch = make([]*logv3.LogData, 0, r.batchSize)
+		}
+	}
+	r.send(ctx, batch)
+	return ctx.Err()
+}
+
+// drain sends batch and the rest of the closed queue, until Close gives up.
+func (r *LogDataReporter) drain(batch []*logv3.LogData) {
+	for l := range r.queue {
+		batch = r.add(batch, l)
+		if len(batch) >= r.batchSize {
+			r.send(r.ctx, batch)
+			batch = make([]*logv3.LogData, 0, r.batchSize)
+		}
+	}
+	r.send(r.ctx, batch)
+}
+
+// add appends the queued log to batch, converting it when it was queued raw.
+func (r *LogDataReporter) add(batch []*logv3.LogData, l queuedLog) []*logv3.LogData {
+	if l.raw == nil {
+		return append(batch, l.data)
+	}
+	data, err := r.decode(l.raw)
+	if err != nil {
+		atomic.AddUint64(&r.invalid, 1)
+		return batch
+	}
+	return append(batch, data)
+}
+
+// send sends batch, retrying a failed send with an exponential backoff. The
+// batch is dropped once ctx is done.
+func (r *LogDataReporter) send(ctx context.Context, batch []*logv3.LogData) {
+	if len(batch) == 0 {
+		return
+	}
+	if ctx.Err() != nil {
+		atomic.AddUint64(&r.dropped, uint64(len(batch)))
+		return
+	}
+	var err error
+	backoff := r.minBackoff
+retry:
+	for attempt := 0; attempt <= r.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				break retry
+			}
+			if backoff *= 2; backoff > r.maxBackoff {
+				backoff = r.maxBackoff
+			}
+		}
+		if err = r.transport.SendLogs(ctx, batch); err == nil {
+			atomic.AddUint64(&r.sent, uint64(len(batch)))
+			return
+		}
+	}
+	atomic.AddUint64(&r.failed, uint64(len(batch)))
+	r.logger.Printf("%d logs lost: %v", len(batch), err)
+}
+
+// GRPCLogOption allows for functional options to adjust behaviour
+// of a gRPC log transport to be created by NewGRPCLogTransport
+type GRPCLogOption func(t *grpcLogTransport)
+
+// WithLogTransportCredentials setup transport layer security
+func WithLogTransportCredentials(creds credentials.TransportCredentials) GRPCLogOption {
+	return func(t *grpcLogTransport) {
+		t.creds = creds
+	}
+}
+
+// WithLogAuthentication used Authentication for gRPC
+func WithLogAuthentication(auth string) GRPCLogOption {
+	return func(t *grpcLogTransport) {
+		t.md = metadata.New(map[string]string{authKey: auth})
+	}
+}
+
+// WithLogTimeout setup the timeout of sending one batch
+func WithLogTimeout(timeout time.Duration) GRPCLogOption {
+	return func(t *grpcLogTransport) {
+		if timeout > 0 {
+			t.timeout = timeout
+		}
+	}
+}
+
+// NewGRPCLogTransport create a transport sending logs to the LogReportService
+// of the gRPC oap server. The connection is established in the background, the
+// transport can be created while the server is down.
+func NewGRPCLogTransport(serverAddr string, opts ...GRPCLogOption) (LogTransport, error) {
+	t := &grpcLogTransport{timeout: defaultLogTimeout}
+	for _, o := range opts {
+		o(t)
+	}
+
+	var credsDialOption grpc.DialOption
+	if t.creds != nil {
+		// use tls
+		credsDialOption = grpc.WithTransportCredentials(t.creds)
+	} else {
+		credsDialOption = grpc.WithInsecure()
+	}
+
+	conn, err := grpc.Dial(serverAddr, credsDialOption)
+	if err != nil {
+		return nil, err
+	}
+	t.conn = conn
+	t.client = logv3.NewLogReportServiceClient(conn)
+	return t, nil
+}
+
+type grpcLogTransport struct {
+	conn    *grpc.ClientConn
+	client  logv3.LogReportServiceClient
+	timeout time.Duration
+
+	md    metadata.MD
+	creds credentials.TransportCredentials
+}
+
+// SendLogs sends logs in one stream.
+func (t *grpcLogTransport) SendLogs(ctx context.Context, logs []*logv3.LogData) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	if t.md != nil {
+		ctx = metadata.NewOutgoingContext(ctx, t.md)
+	}
+	stream, err := t.client.Collect(ctx)
+	if err != nil {
+		return err
+	}
+	for _, data := range logs {
+		if err := stream.Send(data); err != nil {
+			// the cause of a failed Send is returned by RecvMsg
+			if err == io.EOF {
+				if _, rerr := stream.CloseAndRecv(); rerr != nil {
+					err = rerr
+				}
+			}
+			return err
+		}
+	}
+	if _, err := stream.CloseAndRecv(); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func (t *grpcLogTransport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,191 @@
+// Licensed to SkyAPM org under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. SkyAPM org licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package reporter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter/grpc/common"
+	logv3 "github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter/grpc/logging"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeCollector is a LogReportService failing its first fail streams.
+type fakeCollector struct {
+	mu      sync.Mutex
+	fail    int
+	streams int
+	logs    []*logv3.LogData
+}
+
+func (c *fakeCollector) Collect(stream logv3.LogReportService_CollectServer) error {
+	c.mu.Lock()
+	c.streams++
+	fail := c.streams <= c.fail
+	c.mu.Unlock()
+	if fail {
+		return status.Error(codes.Unavailable, "backend starting")
+	}
+	for {
+		data, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&common.Commands{})
+		}
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.logs = append(c.logs, data)
+		c.mu.Unlock()
+	}
+}
+
+func startCollector(t *testing.T, c *fakeCollector) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	logv3.RegisterLogReportServiceServer(s, c)
+	go s.Serve(ln)
+	t.Cleanup(s.Stop)
+	return ln.Addr().String()
+}
+
+func TestLogDataReporter(t *testing.T) {
+	c := &fakeCollector{fail: 2}
+	transport, err := NewGRPCLogTransport(startCollector(t, c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewLogDataReporter(transport,
+		WithLogBatchSize(2),
+		WithLogFlushInterval(time.Hour),
+		WithLogRetry(3, time.Millisecond, 5*time.Millisecond),
+		WithLogReporterLogger(log.New(io.Discard, "", 0)),
+	)
+	for _, service := range []string{"a", "b", "c"} {
+		r.Report(&logv3.LogData{Service: service})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	c.mu.Lock()
+	if len(c.logs) != 3 || c.logs[0].Service != "a" || c.logs[2].Service != "c" {
+		t.Errorf("collected %v, want a, b and c", c.logs)
+	}
+	if c.streams != 4 {
+		t.Errorf("got %d streams, want 2 failed and 2 batches", c.streams)
+	}
+	c.mu.Unlock()
+	if stats := r.Stats(); stats.Sent != 3 || stats.Failed != 0 || stats.Dropped != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// the batch is lost once the retries are exhausted
+	c.mu.Lock()
+	c.fail = c.streams + 10
+	c.mu.Unlock()
+	r.Report(&logv3.LogData{Service: "d"})
+	if err := r.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stats := r.Stats(); stats.Failed != 1 {
+		t.Errorf("stats = %+v, want 1 failed", stats)
+	}
+	r.Report(&logv3.LogData{Service: "e"})
+	if stats := r.Stats(); stats.Dropped != 1 {
+		t.Errorf("stats = %+v, want the log reported after Close dropped", stats)
+	}
+}
+
+func TestLogDataReporterRaw(t *testing.T) {
+	c := &fakeCollector{}
+	transport, err := NewGRPCLogTransport(startCollector(t, c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []string
+	r := NewLogDataReporter(transport,
+		WithLogFlushInterval(time.Hour),
+		WithLogReporterLogger(log.New(io.Discard, "", 0)),
+		WithLogDecoder(func(raw []byte) (*logv3.LogData, error) {
+			// only the reporter goroutine decodes, decoded needs no lock
+			decoded = append(decoded, string(raw))
+			if string(raw) == "invalid" {
+				return nil, errors.New("not a log")
+			}
+			return &logv3.LogData{Service: string(raw)}, nil
+		}),
+	)
+	buf := []byte("a")
+	r.ReportRaw(buf)
+	// the caller may reuse its buffer once ReportRaw returned
+	buf[0] = 'b'
+	r.ReportRaw(buf)
+	r.ReportRaw([]byte("invalid"))
+	r.Report(&logv3.LogData{Service: "c"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	c.mu.Lock()
+	var services []string
+	for _, data := range c.logs {
+		services = append(services, data.Service)
+	}
+	c.mu.Unlock()
+	if len(services) != 3 || services[0] != "a" || services[1] != "b" || services[2] != "c" {
+		t.Errorf("collected %v, want a, b and c", services)
+	}
+	if len(decoded) != 3 {
+		t.Errorf("decoded %q, want the raw logs only", decoded)
+	}
+	if stats := r.Stats(); stats.Sent != 3 || stats.Invalid != 1 || stats.Dropped != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if err := r.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// without decoder the raw logs cannot be sent
+	if transport, err = NewGRPCLogTransport(startCollector(t, c)); err != nil {
+		t.Fatal(err)
+	}
+	r = NewLogDataReporter(transport, WithLogReporterLogger(log.New(io.Discard, "", 0)))
+	defer r.Close(ctx)
+	r.ReportRaw([]byte("a"))
+	if stats := r.Stats(); stats.Invalid != 1 || stats.Queued != 0 {
+		t.Errorf("stats = %+v, want the raw log counted as invalid", stats)
+	}
+}
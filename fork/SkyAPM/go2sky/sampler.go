@@ -19,9 +19,13 @@ package go2sky
 
 import (
 	"math/rand"
+	"strings"
+	"sync"
 	"time"
 )
 
+// Sampler decides whether a new trace starting with operation is sampled, it
+// must be safe for concurrent use.
 type Sampler interface {
 	IsSampled(operation string) (sampled bool)
 }
@@ -43,20 +47,30 @@ func (s *ConstSampler) IsSampled(operation string) bool {
 	return s.decision
 }
 
+// RandomSampler samples a fraction of the traces, the fraction can be changed
+// while it is in use.
 type RandomSampler struct {
+	mu           sync.Mutex
 	samplingRate float64
 	rand         *rand.Rand
-	threshold    int
 }
 
 // IsSampled implements IsSampled() of Sampler.
 func (s *RandomSampler) IsSampled(operation string) bool {
-	return s.threshold >= s.rand.Intn(100)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rand.Float64() < s.samplingRate
+}
+
+// SetSamplingRate changes the fraction of the sampled traces, from 0 to 1.
+func (s *RandomSampler) SetSamplingRate(samplingRate float64) {
+	s.mu.Lock()
+	s.samplingRate = samplingRate
+	s.mu.Unlock()
 }
 
 func (s *RandomSampler) init() {
-	s.rand = rand.New(rand.NewSource(time.Now().Unix()))
-	s.threshold = int(s.samplingRate * 100)
+	s.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
 }
 
 func NewRandomSampler(samplingRate float64) *RandomSampler {
@@ -66,3 +80,112 @@ func NewRandomSampler(samplingRate float64) *RandomSampler {
 	s.init()
 	return s
 }
+
+// RateLimitingSampler samples up to a number of traces per second, with bursts
+// of up to one second of traces. The rate can be changed while it is in use.
+type RateLimitingSampler struct {
+	mu              sync.Mutex
+	tracesPerSecond float64
+	balance         float64
+	last            time.Time
+	now             func() time.Time
+}
+
+// NewRateLimitingSampler creates a RateLimitingSampler.
+func NewRateLimitingSampler(tracesPerSecond float64) *RateLimitingSampler {
+	s := &RateLimitingSampler{now: time.Now}
+	s.SetTracesPerSecond(tracesPerSecond)
+	s.balance = s.maxBalance()
+	return s
+}
+
+// IsSampled implements IsSampled() of Sampler.
+func (s *RateLimitingSampler) IsSampled(operation string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.balance += now.Sub(s.last).Seconds() * s.tracesPerSecond
+	s.last = now
+	if max := s.maxBalance(); s.balance > max {
+		s.balance = max
+	}
+	if s.balance < 1 {
+		return false
+	}
+	s.balance--
+	return true
+}
+
+// SetTracesPerSecond changes the number of traces sampled per second.
+func (s *RateLimitingSampler) SetTracesPerSecond(tracesPerSecond float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tracesPerSecond = tracesPerSecond
+	s.last = s.now()
+	if max := s.maxBalance(); s.balance > max {
+		s.balance = max
+	}
+}
+
+func (s *RateLimitingSampler) maxBalance() float64 {
+	if s.tracesPerSecond < 1 {
+		return 1
+	}
+	return s.tracesPerSecond
+}
+
+// OperationSampler always or never samples the operations matching its
+// patterns and leaves the others to a default sampler. A pattern ending with *
+// matches the operations starting with it, never takes precedence over always.
+// The patterns can be changed while it is in use.
+type OperationSampler struct {
+	sampler Sampler
+
+	mu     sync.RWMutex
+	always []string
+	never  []string
+}
+
+// NewOperationSampler creates an OperationSampler deferring to sampler.
+func NewOperationSampler(sampler Sampler, always, never []string) *OperationSampler {
+	s := &OperationSampler{sampler: sampler}
+	s.SetOperations(always, never)
+	return s
+}
+
+// IsSampled implements IsSampled() of Sampler.
+func (s *OperationSampler) IsSampled(operation string) bool {
+	s.mu.RLock()
+	never, always := matchOperation(s.never, operation), matchOperation(s.always, operation)
+	s.mu.RUnlock()
+	switch {
+	case never:
+		return false
+	case always:
+		return true
+	default:
+		return s.sampler.IsSampled(operation)
+	}
+}
+
+// SetOperations replaces the patterns of the operations always and never
+// sampled.
+func (s *OperationSampler) SetOperations(always, never []string) {
+	s.mu.Lock()
+	s.always = append([]string(nil), always...)
+	s.never = append([]string(nil), never...)
+	s.mu.Unlock()
+}
+
+func matchOperation(patterns []string, operation string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(operation, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if pattern == operation {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+// Licensed to SkyAPM org under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. SkyAPM org licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package go2sky
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRandomSampler(t *testing.T) {
+	s := NewRandomSampler(0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if s.IsSampled("/GET/v1/users") {
+					t.Error("sampled at rate 0")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.SetSamplingRate(1)
+	for i := 0; i < 100; i++ {
+		if !s.IsSampled("/GET/v1/users") {
+			t.Fatal("not sampled at rate 1")
+		}
+	}
+}
+
+func TestRateLimitingSampler(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := NewRateLimitingSampler(2)
+	s.now = func() time.Time { return now }
+	s.SetTracesPerSecond(2)
+
+	count := func() (n int) {
+		for i := 0; i < 10; i++ {
+			if s.IsSampled("op") {
+				n++
+			}
+		}
+		return n
+	}
+	if n := count(); n != 2 {
+		t.Errorf("sampled %d traces of a burst, want 2", n)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if n := count(); n != 1 {
+		t.Errorf("sampled %d traces after 500ms, want 1", n)
+	}
+	now = now.Add(time.Hour)
+	if n := count(); n != 2 {
+		t.Errorf("sampled %d traces after an idle hour, want the burst of 2", n)
+	}
+
+	s.SetTracesPerSecond(0.5)
+	now = now.Add(time.Second)
+	if n := count(); n != 0 {
+		t.Errorf("sampled %d traces 1s after lowering the rate to 0.5/s, want 0", n)
+	}
+	now = now.Add(time.Second)
+	if n := count(); n != 1 {
+		t.Errorf("sampled %d traces 2s after lowering the rate to 0.5/s, want 1", n)
+	}
+}
+
+func TestOperationSampler(t *testing.T) {
+	s := NewOperationSampler(NewConstSampler(false), []string{"/POST/v1/orders", "/proto.Orders/*"}, []string{"/proto.Orders/Ping"})
+	for operation, want := range map[string]bool{
+		"/POST/v1/orders":    true,
+		"/POST/v1/orders/1":  false,
+		"/proto.Orders/Get":  true,
+		"/proto.Orders/Ping": false,
+		"/GET/v1/users":      false,
+	} {
+		if got := s.IsSampled(operation); got != want {
+			t.Errorf("IsSampled(%q) = %v, want %v", operation, got, want)
+		}
+	}
+
+	s.SetOperations(nil, []string{"*"})
+	if s.IsSampled("/POST/v1/orders") {
+		t.Error("sampled an operation no longer always sampled")
+	}
+}
@@ -61,6 +61,9 @@ type SegmentContext struct {
 	spanIDGenerator    *int32
 	FirstSpan          Span `json:"-"`
 	CorrelationContext map[string]string
+	// TraceState are the tracestate members of other vendors received with
+	// the trace, passed on by the exit spans.
+	TraceState string
 }
 
 // ReportedSpan is accessed by Reporter to load reported data
@@ -175,6 +178,7 @@ func (s *segmentSpanImpl) createSegmentContext(parent segmentSpan) (err error) {
 		if len(s.defaultSpan.Refs) > 0 {
 			s.TraceID = s.defaultSpan.Refs[0].TraceID
 			s.CorrelationContext = s.defaultSpan.Refs[0].CorrelationContext
+			s.TraceState = s.defaultSpan.Refs[0].TraceState
 		} else {
 			s.TraceID, err = idgen.GenerateGlobalID()
 			if err != nil {
@@ -188,6 +192,7 @@ func (s *segmentSpanImpl) createSegmentContext(parent segmentSpan) (err error) {
 		s.ParentSpanID = s.SpanID
 		s.SpanID = atomic.AddInt32(s.Context().spanIDGenerator, 1)
 		s.CorrelationContext = parent.context().CorrelationContext
+		s.TraceState = parent.context().TraceState
 	}
 	if s.SegmentContext.FirstSpan == nil {
 		s.SegmentContext.FirstSpan = s
@@ -43,6 +43,7 @@ type Tracer struct {
 	initFlag    int32
 	sampler     Sampler
 	correlation *CorrelationConfig
+	propagator  propagation.Propagator
 }
 
 // TracerOption allows for functional options to adjust behaviour
@@ -79,6 +80,9 @@ func NewTracer(service string, opts ...TracerOption) (tracer *Tracer, err error)
 	if t.sampler == nil {
 		t.sampler = NewConstSampler(true)
 	}
+	if t.propagator == nil {
+		t.propagator = propagation.SW8
+	}
 	return t, nil
 }
 
@@ -91,7 +95,7 @@ func (t *Tracer) CreateEntrySpan(ctx context.Context, operationName string, extr
 		return
 	}
 	var refSc = &propagation.SpanContext{}
-	err = refSc.Decode(extractor)
+	err = t.propagator.Extract(refSc, extractor)
 	if err != nil {
 		return
 	}
@@ -173,8 +177,9 @@ func (t *Tracer) CreateExitSpan(ctx context.Context, operationName string, peer
 	spanContext.ParentEndpoint = firstSpan.GetOperationName()
 	spanContext.AddressUsedAtClient = peer
 	spanContext.CorrelationContext = span.Context().CorrelationContext
+	spanContext.TraceState = span.Context().TraceState
 
-	err = spanContext.Encode(injector)
+	err = t.propagator.Inject(spanContext, injector)
 	if err != nil {
 		return nil, err
 	}
@@ -217,3 +222,15 @@ func TraceID(ctx context.Context) string {
 	}
 	return NoopTraceID
 }
+
+// TraceSegmentID returns the segment ID of the active span of ctx, or
+// EmptyTraceSegmentID.
+func TraceSegmentID(ctx context.Context) string {
+	return FromGoContext(ctx).TraceSegmentID
+}
+
+// SpanID returns the ID of the active span of ctx in its segment, or
+// EmptySpanID.
+func SpanID(ctx context.Context) int32 {
+	return FromGoContext(ctx).SpanID
+}
@@ -17,6 +17,8 @@
 
 package go2sky
 
+import "github.com/767829413/normal-frame/fork/SkyAPM/go2sky/propagation"
+
 // WithReporter setup report pipeline for tracer
 func WithReporter(reporter Reporter) TracerOption {
 	return func(t *Tracer) {
@@ -53,3 +55,11 @@ func WithCustomSampler(sampler Sampler) TracerOption {
 		t.sampler = sampler
 	}
 }
+
+// WithPropagator setup the formats of the trace context read from the
+// incoming requests and written to the outgoing ones, sw8 by default
+func WithPropagator(propagator propagation.Propagator) TracerOption {
+	return func(t *Tracer) {
+		t.propagator = propagator
+	}
+}
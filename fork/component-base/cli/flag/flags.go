@@ -25,6 +25,26 @@ func InitFlags(flags *pflag.FlagSet) {
 // PrintFlags logs the flags in the flagset.
 func PrintFlags(flags *pflag.FlagSet) {
 	flags.VisitAll(func(flag *pflag.Flag) {
-		log.Printf("FLAG: --%s=%q \n", flag.Name, flag.Value)
+		value := flag.Value.String()
+		if IsSecret(flag) && value != "" {
+			value = redacted
+		}
+		log.Printf("FLAG: --%s=%q \n", flag.Name, value)
 	})
 }
+
+// SecretAnnotation marks the flags whose value must never be printed.
+const SecretAnnotation = "secret"
+
+const redacted = "******"
+
+// MarkSecret marks the flag name of fs as holding a secret.
+func MarkSecret(fs *pflag.FlagSet, name string) {
+	_ = fs.SetAnnotation(name, SecretAnnotation, []string{"true"})
+}
+
+// IsSecret reports whether the flag holds a secret.
+func IsSecret(flag *pflag.Flag) bool {
+	_, ok := flag.Annotations[SecretAnnotation]
+	return ok
+}
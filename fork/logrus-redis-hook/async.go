@@ -0,0 +1,323 @@
+package logredis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Defaults of the queue of an AsyncHook.
+const (
+	DefaultQueueSize     = 10000
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+	DefaultWriteTimeout  = time.Second
+
+	sendAttempts = 3
+)
+
+// ErrClosed is returned when flushing a closed hook.
+var ErrClosed = errors.New("logredis: hook closed")
+
+// Stats counts the entries handled by an AsyncHook.
+type Stats struct {
+	// Queued is the number of entries waiting to be sent.
+	Queued int
+	// Sent is the number of entries pushed to REDIS.
+	Sent uint64
+	// Dropped is the number of entries discarded because the queue was full or
+	// the hook closed.
+	Dropped uint64
+	// Failed is the number of entries lost because REDIS kept failing.
+	Failed uint64
+}
+
+// AsyncHook sends logs to a Redis server from a background goroutine. Entries
+// are queued by Fire and pushed in batches with a single pipelined RPUSH, so a
+// slow Redis does not slow down the logging goroutines.
+type AsyncHook struct {
+	*RedisHook
+
+	batchSize     int
+	flushInterval time.Duration
+	block         bool
+
+	// ctx is canceled when Close gives up, to abort the pending sends.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan []byte
+	flush  chan flushRequest
+	done   chan struct{}
+
+	sent    uint64
+	dropped uint64
+	failed  uint64
+}
+
+type flushRequest struct {
+	ctx  context.Context
+	done chan error
+}
+
+// NewAsyncHook creates a hook queueing up to config.QueueSize entries. When
+// the queue is full, Fire drops the entry or, with config.BlockOnFull, waits
+// for room.
+func NewAsyncHook(config HookConfig) (*AsyncHook, error) {
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = DefaultWriteTimeout
+	}
+	hook, err := newHook(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultQueueSize
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultFlushInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &AsyncHook{
+		RedisHook:     hook,
+		batchSize:     config.BatchSize,
+		flushInterval: config.FlushInterval,
+		block:         config.BlockOnFull,
+		ctx:           ctx,
+		cancel:        cancel,
+		queue:         make(chan []byte, config.QueueSize),
+		flush:         make(chan flushRequest),
+		done:          make(chan struct{}),
+	}
+	go h.run()
+	return h, nil
+}
+
+// Fire queues the entry.
+func (h *AsyncHook) Fire(entry *logrus.Entry) error {
+	// the entry is reused by logrus once the hooks returned, it is encoded now
+	js, err := json.Marshal(h.message(entry))
+	if err != nil {
+		return fmt.Errorf("error creating message for REDIS: %s", err)
+	}
+
+	h.enqueue(js)
+	return nil
+}
+
+// Write queues p, a message already encoded such as a JSON line of another
+// logger, so the hook can be used as an io.Writer.
+func (h *AsyncHook) Write(p []byte) (int, error) {
+	// p may be reused by the caller once Write returned
+	msg := make([]byte, len(p))
+	copy(msg, p)
+	h.enqueue(bytes.TrimRight(msg, "\n"))
+	return len(p), nil
+}
+
+func (h *AsyncHook) enqueue(msg []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		atomic.AddUint64(&h.dropped, 1)
+		return
+	}
+	if h.block {
+		h.queue <- msg
+		return
+	}
+	select {
+	case h.queue <- msg:
+	default:
+		atomic.AddUint64(&h.dropped, 1)
+	}
+}
+
+// Flush sends the queued entries and returns when they are sent or ctx is
+// done.
+func (h *AsyncHook) Flush(ctx context.Context) error {
+	h.mu.RLock()
+	closed := h.closed
+	h.mu.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+
+	req := flushRequest{ctx: ctx, done: make(chan error, 1)}
+	select {
+	case h.flush <- req:
+	case <-h.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-req.done
+}
+
+// Close stops accepting entries and sends the queued ones until ctx is done,
+// the entries still queued then are dropped.
+func (h *AsyncHook) Close(ctx context.Context) error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		<-h.done
+		return nil
+	}
+	h.closed = true
+	close(h.queue)
+	h.mu.Unlock()
+
+	defer h.cancel()
+	select {
+	case <-h.done:
+		return nil
+	case <-ctx.Done():
+		h.cancel()
+		<-h.done
+		return ctx.Err()
+	}
+}
+
+// Stats returns the counters of the hook.
+func (h *AsyncHook) Stats() Stats {
+	return Stats{
+		Queued:  len(h.queue),
+		Sent:    atomic.LoadUint64(&h.sent),
+		Dropped: atomic.LoadUint64(&h.dropped),
+		Failed:  atomic.LoadUint64(&h.failed),
+	}
+}
+
+// run batches the queued entries until the queue is closed.
+func (h *AsyncHook) run() {
+	defer close(h.done)
+	ticker := time.NewTicker(h.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([][]byte, 0, h.batchSize)
+	for {
+		select {
+		case msg, ok := <-h.queue:
+			if !ok {
+				h.drain(batch)
+				return
+			}
+			batch = append(batch, msg)
+			if len(batch) >= h.batchSize {
+				h.send(h.ctx, batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			h.send(h.ctx, batch)
+			batch = batch[:0]
+		case req := <-h.flush:
+			req.done <- h.flushQueued(req.ctx, batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flushQueued sends batch and the entries queued when it is called.
+func (h *AsyncHook) flushQueued(ctx context.Context, batch [][]byte) error {
+	for n := len(h.queue); n > 0; n-- {
+		msg, ok := <-h.queue
+		if !ok {
+			break
+		}
+		batch = append(batch, msg)
+		if len(batch) >= h.batchSize {
+			h.send(ctx, batch)
+			batch = batch[:0]
+		}
+	}
+	h.send(ctx, batch)
+	return ctx.Err()
+}
+
+// drain sends batch and the rest of the closed queue, until Close gives up.
+func (h *AsyncHook) drain(batch [][]byte) {
+	for msg := range h.queue {
+		batch = append(batch, msg)
+		if len(batch) >= h.batchSize {
+			h.send(h.ctx, batch)
+			batch = batch[:0]
+		}
+	}
+	h.send(h.ctx, batch)
+}
+
+// send pushes batch, retrying a failed push with a backoff. The batch is
+// dropped once ctx is done.
+func (h *AsyncHook) send(ctx context.Context, batch [][]byte) {
+	if len(batch) == 0 {
+		return
+	}
+	if ctx.Err() != nil {
+		atomic.AddUint64(&h.dropped, uint64(len(batch)))
+		return
+	}
+	var err error
+retry:
+	for attempt := 0; attempt < sendAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+			case <-ctx.Done():
+				break retry
+			}
+		}
+		if err = h.push(batch); err == nil {
+			atomic.AddUint64(&h.sent, uint64(len(batch)))
+			return
+		}
+	}
+	atomic.AddUint64(&h.failed, uint64(len(batch)))
+	fmt.Fprintf(os.Stderr, "logredis: %d entries lost: %v\n", len(batch), err)
+}
+
+// push sends batch with one RPUSH, and EXPIRE when a TTL is set, in a single
+// round trip.
+func (h *AsyncHook) push(batch [][]byte) error {
+	conn := h.RedisPool.Get()
+	defer conn.Close()
+
+	args := make([]interface{}, 0, len(batch)+1)
+	args = append(args, h.RedisKey)
+	for _, msg := range batch {
+		args = append(args, msg)
+	}
+	if err := conn.Send("RPUSH", args...); err != nil {
+		return fmt.Errorf("error sending message to REDIS: %s", err)
+	}
+	if h.TTL != 0 {
+		if err := conn.Send("EXPIRE", h.RedisKey, h.TTL); err != nil {
+			return fmt.Errorf("error setting TTL to key: %s, %s", h.RedisKey, err)
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return fmt.Errorf("error sending message to REDIS: %s", err)
+	}
+	if _, err := conn.Receive(); err != nil {
+		return fmt.Errorf("error sending message to REDIS: %s", err)
+	}
+	if h.TTL != 0 {
+		if _, err := conn.Receive(); err != nil {
+			return fmt.Errorf("error setting TTL to key: %s, %s", h.RedisKey, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package logredis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fakeRedis answers PING, RPUSH and EXPIRE and records the pushed values.
+type fakeRedis struct {
+	ln net.Listener
+
+	mu     sync.Mutex
+	values []string
+	pushes int
+	// hold delays the RPUSH replies while it is locked.
+	hold sync.Mutex
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) port() int {
+	return r.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(rd)
+		if err != nil {
+			return
+		}
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			fmt.Fprint(conn, "+PONG\r\n")
+		case "RPUSH":
+			r.hold.Lock()
+			r.hold.Unlock()
+			r.mu.Lock()
+			r.values = append(r.values, args[2:]...)
+			r.pushes++
+			n := len(r.values)
+			r.mu.Unlock()
+			fmt.Fprintf(conn, ":%d\r\n", n)
+		case "EXPIRE":
+			fmt.Fprint(conn, ":1\r\n")
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command %s\r\n", args[0])
+		}
+	}
+}
+
+func (r *fakeRedis) received() ([]string, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.values...), r.pushes
+}
+
+// readCommand reads a RESP array of bulk strings.
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = rd.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func newTestLogger(hook logrus.Hook) *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.AddHook(hook)
+	return logger
+}
+
+func TestAsyncHookBatches(t *testing.T) {
+	r := newFakeRedis(t)
+	hook, err := NewAsyncHook(HookConfig{
+		Host: "127.0.0.1", Port: r.port(), Key: "logs", Format: "origin", TTL: 60,
+		BatchSize: 10, FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := newTestLogger(hook)
+
+	for i := 0; i < 25; i++ {
+		logger.Infof("entry %d", i)
+	}
+	if err := hook.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	values, pushes := r.received()
+	if len(values) != 25 {
+		t.Fatalf("received %d entries, want 25", len(values))
+	}
+	if pushes != 3 {
+		t.Errorf("received %d RPUSH, want 3 batches", pushes)
+	}
+	if !strings.Contains(values[24], `"message":"entry 24"`) {
+		t.Errorf("last entry = %s", values[24])
+	}
+	if stats := hook.Stats(); stats.Sent != 25 || stats.Dropped != 0 || stats.Failed != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if err := hook.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAsyncHookDropsWhenFull(t *testing.T) {
+	r := newFakeRedis(t)
+	hook, err := NewAsyncHook(HookConfig{
+		Host: "127.0.0.1", Port: r.port(), Key: "logs", Format: "origin",
+		QueueSize: 5, BatchSize: 1, FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := newTestLogger(hook)
+
+	// the flusher is stuck on the first entry, the queue holds the next 5
+	r.hold.Lock()
+	logger.Info("first")
+	for deadline := time.Now().Add(time.Second); hook.Stats().Queued != 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		logger.Infof("entry %d", i)
+	}
+	if stats := hook.Stats(); stats.Queued != 5 || stats.Dropped != 5 {
+		t.Errorf("stats = %+v, want 5 queued and 5 dropped", stats)
+	}
+	r.hold.Unlock()
+
+	if err := hook.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	values, _ := r.received()
+	if len(values) != 6 {
+		t.Errorf("received %d entries, want 6", len(values))
+	}
+	logger.Info("after close")
+	if stats := hook.Stats(); stats.Sent != 6 || stats.Dropped != 6 {
+		t.Errorf("stats = %+v, want 6 sent and 6 dropped", stats)
+	}
+}
+
+func TestAsyncHookCloseTimeout(t *testing.T) {
+	r := newFakeRedis(t)
+	hook, err := NewAsyncHook(HookConfig{
+		Host: "127.0.0.1", Port: r.port(), Key: "logs", Format: "origin",
+		BatchSize: 1, FlushInterval: time.Hour, WriteTimeout: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := newTestLogger(hook)
+
+	r.hold.Lock()
+	defer r.hold.Unlock()
+	for i := 0; i < 3; i++ {
+		logger.Infof("entry %d", i)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := hook.Close(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Close() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Close took %s", d)
+	}
+	if stats := hook.Stats(); stats.Sent != 0 || stats.Dropped+stats.Failed != 3 {
+		t.Errorf("stats = %+v, want the 3 entries dropped or failed", stats)
+	}
+}
+
+func TestAsyncHookWrite(t *testing.T) {
+	r := newFakeRedis(t)
+	hook, err := NewAsyncHook(HookConfig{
+		Host: "127.0.0.1", Port: r.port(), Key: "logs", Format: "origin", FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := []byte(`{"level":"info","message":"hello"}` + "\n")
+	if n, err := hook.Write(line); err != nil || n != len(line) {
+		t.Fatalf("Write() = %d, %v", n, err)
+	}
+	// the caller may reuse its buffer
+	copy(line, "xxxxxxxx")
+	if err := hook.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	values, _ := r.received()
+	if len(values) != 1 || values[0] != `{"level":"info","message":"hello"}` {
+		t.Errorf("received %q", values)
+	}
+}
@@ -20,6 +20,16 @@ type HookConfig struct {
 	Port     int
 	DB       int
 	TTL      int
+
+	// WriteTimeout bounds the reads and writes to REDIS, 100ms by default for
+	// a RedisHook and DefaultWriteTimeout for an AsyncHook.
+	WriteTimeout time.Duration
+	// QueueSize, BatchSize, FlushInterval and BlockOnFull configure the queue
+	// of an AsyncHook.
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+	BlockOnFull   bool
 }
 
 // RedisHook to sends logs to Redis server
@@ -36,7 +46,14 @@ type RedisHook struct {
 
 // NewHook creates a hook to be added to an instance of logger
 func NewHook(config HookConfig) (*RedisHook, error) {
-	pool := newRedisConnectionPool(config.Host, config.Password, config.Port, config.DB)
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = 100 * time.Millisecond
+	}
+	return newHook(config)
+}
+
+func newHook(config HookConfig) (*RedisHook, error) {
+	pool := newRedisConnectionPool(config.Host, config.Password, config.Port, config.DB, config.WriteTimeout)
 
 	if config.Format != "v0" && config.Format != "v1" && config.Format != "access" && config.Format != "origin" {
 		return nil, fmt.Errorf("unknown message format")
@@ -66,23 +83,8 @@ func NewHook(config HookConfig) (*RedisHook, error) {
 
 // Fire is called when a log event is fired.
 func (hook *RedisHook) Fire(entry *logrus.Entry) error {
-	var msg interface{}
-
-	switch hook.LogstashFormat {
-	case "v0":
-		msg = createV0Message(entry, hook.AppName, hook.Hostname)
-	case "v1":
-		msg = createV1Message(entry, hook.AppName, hook.Hostname)
-	case "access":
-		msg = createAccessLogMessage(entry, hook.AppName, hook.Hostname)
-	case "origin":
-		msg = createOriginLogMessage(entry)
-	default:
-		fmt.Println("Invalid LogstashFormat")
-	}
-
 	// Marshal into json message
-	js, err := json.Marshal(msg)
+	js, err := json.Marshal(hook.message(entry))
 	if err != nil {
 		return fmt.Errorf("error creating message for REDIS: %s", err)
 	}
@@ -107,6 +109,23 @@ func (hook *RedisHook) Fire(entry *logrus.Entry) error {
 	return nil
 }
 
+// message formats entry in the format of the hook.
+func (hook *RedisHook) message(entry *logrus.Entry) interface{} {
+	switch hook.LogstashFormat {
+	case "v0":
+		return createV0Message(entry, hook.AppName, hook.Hostname)
+	case "v1":
+		return createV1Message(entry, hook.AppName, hook.Hostname)
+	case "access":
+		return createAccessLogMessage(entry, hook.AppName, hook.Hostname)
+	case "origin":
+		return createOriginLogMessage(entry)
+	default:
+		fmt.Println("Invalid LogstashFormat")
+		return nil
+	}
+}
+
 // Levels returns the available logging levels.
 func (hook *RedisHook) Levels() []logrus.Level {
 	return []logrus.Level{
@@ -178,7 +197,7 @@ func createOriginLogMessage(entry *logrus.Entry) map[string]interface{} {
 	return fields
 }
 
-func newRedisConnectionPool(server, password string, port int, db int) *redis.Pool {
+func newRedisConnectionPool(server, password string, port int, db int, timeout time.Duration) *redis.Pool {
 	hostPort := fmt.Sprintf("%s:%d", server, port)
 	return &redis.Pool{
 		MaxIdle:     3,
@@ -187,8 +206,8 @@ func newRedisConnectionPool(server, password string, port int, db int) *redis.Po
 			c, err := redis.Dial("tcp", hostPort, redis.DialDatabase(db),
 				redis.DialPassword(password),
 				redis.DialConnectTimeout(time.Second),
-				redis.DialReadTimeout(time.Millisecond * 100),
-				redis.DialWriteTimeout(time.Millisecond * 100))
+				redis.DialReadTimeout(timeout),
+				redis.DialWriteTimeout(timeout))
 			if err != nil {
 				return nil, err
 			}
@@ -2,6 +2,7 @@ package apiserver
 
 import (
 	"github.com/767829413/normal-frame/internal/apiserver/options"
+	"github.com/767829413/normal-frame/internal/pkg/reload"
 	"github.com/767829413/normal-frame/pkg/app"
 )
 
@@ -10,12 +11,15 @@ const commandDesc = `Generic Golang server for validating and configuring data V
 // NewApp creates an App object with default parameters.
 func NewApp(basename, confName string) *app.App {
 	opts := options.NewOptions()
+	notifier := reload.NewNotifier(opts)
 	return app.NewApp("API Server",
 		basename,
 		confName,
 		app.WithOptions(opts),
 		app.WithDescription(commandDesc),
 		app.WithDefaultValidArgs(),
-		app.WithRunFunc(GetRunFunc(opts)),
+		app.WithRunFunc(GetRunFunc(opts, notifier)),
+		app.WithReloadFunc(GetReloadFunc(notifier)),
+		app.WithCommands(newConfigCommand(confName), newUserCommand(), newVersionCommand()),
 	)
 }
@@ -0,0 +1,157 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/767829413/normal-frame/internal/apiserver/options"
+	"github.com/767829413/normal-frame/pkg/app"
+	optionsCli "github.com/767829413/normal-frame/pkg/options"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// newConfigCommand creates the config command and its view, init, validate,
+// diff and schema sub commands.
+func newConfigCommand(confName string) *app.Command {
+	cmd := app.NewCommand("config", "Print, validate, diff, describe and scaffold the configuration.")
+	cmd.AddCommands(
+		newConfigViewCommand(),
+		newConfigInitCommand(confName),
+		newConfigValidateCommand(),
+		newConfigDiffCommand(),
+		newConfigSchemaCommand(),
+	)
+	return cmd
+}
+
+func newConfigViewCommand() *app.Command {
+	opts := options.NewOptions()
+	var output string
+	return app.NewCommand("view",
+		"Print the effective configuration merged from flags, environment, file and defaults, with secrets redacted.",
+		app.WithCommandOptions(opts),
+		app.WithCommandFlags(func(fs *pflag.FlagSet) {
+			fs.StringVarP(&output, "output", "o", "yaml", "Output format, yaml or json.")
+		}),
+		app.WithCommandRunFunc(func(args []string) error {
+			return writeSettings(os.Stdout, optionsCli.Settings(opts, true, nil), output)
+		}),
+	)
+}
+
+func newConfigInitCommand(confName string) *app.Command {
+	var force bool
+	return app.NewCommand("init [FILE]",
+		fmt.Sprintf("Write a configuration file with the default values and a comment on each option, %s.yaml by default.", confName),
+		app.WithCommandFlags(func(fs *pflag.FlagSet) {
+			fs.BoolVarP(&force, "force", "f", false, "Overwrite FILE if it already exists.")
+		}),
+		app.WithCommandRunFunc(func(args []string) error {
+			file := confName + ".yaml"
+			if len(args) > 0 {
+				file = args[0]
+			}
+
+			flag := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+			if force {
+				flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			}
+			f, err := os.OpenFile(file, flag, 0o644)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			opts := options.NewOptions()
+			if err := writeSettings(f, optionsCli.Settings(opts, false, optionsCli.Usages(opts, opts.Flags())), "yaml"); err != nil {
+				return err
+			}
+			fmt.Printf("configuration written to %s\n", file)
+			return nil
+		}),
+	)
+}
+
+func newConfigValidateCommand() *app.Command {
+	opts := options.NewOptions()
+	return app.NewCommand("validate",
+		"Validate the configuration merged from flags, environment, file and defaults without starting the server.",
+		app.WithCommandOptions(opts),
+		app.WithCommandRunFunc(func(args []string) error {
+			if err := optionsCli.Aggregate(opts.Validate()); err != nil {
+				return err
+			}
+			fmt.Println("configuration is valid")
+			return nil
+		}),
+	)
+}
+
+func newConfigDiffCommand() *app.Command {
+	opts := options.NewOptions()
+	return app.NewCommand("diff",
+		"Print the options of the effective configuration that differ from the defaults, with secrets redacted.",
+		app.WithCommandOptions(opts),
+		app.WithCommandRunFunc(func(args []string) error {
+			defaults := optionsCli.FlatSettings(options.NewOptions(), true)
+			current := optionsCli.FlatSettings(opts, true)
+
+			keys := make([]string, 0, len(current))
+			for key := range current {
+				keys = append(keys, key)
+			}
+			for key := range defaults {
+				if _, ok := current[key]; !ok {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				if defaults[key] != current[key] {
+					fmt.Printf("%s: %s -> %s\n", key, defaults[key], current[key])
+				}
+			}
+			return nil
+		}),
+	)
+}
+
+func newConfigSchemaCommand() *app.Command {
+	return app.NewCommand("schema",
+		"Print the JSON schema of the configuration file, for editors and CI to validate it.",
+		app.WithCommandRunFunc(func(args []string) error {
+			opts := options.NewOptions()
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(optionsCli.Schema(opts, optionsCli.Usages(opts, opts.Flags())))
+		}),
+	)
+}
+
+// writeSettings writes the settings as yaml or json.
+func writeSettings(w io.Writer, settings *yaml.Node, output string) error {
+	switch output {
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(settings); err != nil {
+			return err
+		}
+		return enc.Close()
+	case "json":
+		var v interface{}
+		if err := settings.Decode(&v); err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	default:
+		return fmt.Errorf("unknown output format %q, must be yaml or json", output)
+	}
+}
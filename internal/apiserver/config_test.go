@@ -0,0 +1,50 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestConfigViewRedactsOTLPHeaders(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	t.Setenv("APISERVER_APM_OTLP_HEADERS", "authorization=Bearer abc,x-scope-orgid=orders")
+
+	args, stdout := os.Args, os.Stdout
+	defer func() { os.Args, os.Stdout = args, stdout }()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Args = []string{"apiserver", "config", "view", "--output", "json"}
+	os.Stdout = w
+	NewApp("apiserver", "apiserver-test").Run()
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var settings struct {
+		Apm struct {
+			OTLP struct {
+				Headers map[string]string `json:"headers"`
+			} `json:"otlp"`
+		} `json:"apm"`
+	}
+	if err := json.Unmarshal(out, &settings); err != nil {
+		t.Fatalf("config view printed %s: %v", out, err)
+	}
+	for name, value := range settings.Apm.OTLP.Headers {
+		if value != "******" {
+			t.Errorf("header %s = %q, want it redacted", name, value)
+		}
+	}
+	if len(settings.Apm.OTLP.Headers) != 2 {
+		t.Errorf("headers = %v, want the two of the environment", settings.Apm.OTLP.Headers)
+	}
+}
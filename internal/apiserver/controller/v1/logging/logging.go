@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"net/http"
+	"time"
+
+	v1 "github.com/767829413/normal-frame/internal/apiserver/controller/v1"
+	"github.com/767829413/normal-frame/internal/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultRevertAfter is how long levels changed without a duration stay in
+// effect.
+const defaultRevertAfter = 10 * time.Minute
+
+// LevelController changes the log levels of the running server.
+type LevelController struct{}
+
+func NewLevelController() *LevelController {
+	return &LevelController{}
+}
+
+// levelRequest is the body of Update. Level and Modules are applied on top of
+// the configured levels until Duration elapses, 10m by default.
+type levelRequest struct {
+	Level    string            `json:"level"`
+	Modules  map[string]string `json:"modules"`
+	Duration string            `json:"duration"`
+}
+
+// Get returns the effective log levels.
+func (l *LevelController) Get(c *gin.Context) {
+	resp := &v1.Res{State: 1, Msg: "success", Data: logger.GetLevels()}
+	resp.WriteResponse(c)
+}
+
+// Update temporarily changes the log levels.
+func (l *LevelController) Update(c *gin.Context) {
+	var r levelRequest
+	resp := &v1.Res{State: 1, Msg: "success"}
+	if err := c.ShouldBindJSON(&r); err != nil {
+		resp.Msg = err.Error()
+		resp.State = -1
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	d := defaultRevertAfter
+	if r.Duration != "" {
+		var err error
+		if d, err = time.ParseDuration(r.Duration); err != nil {
+			resp.Msg = err.Error()
+			resp.State = -1
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+	}
+	if err := logger.OverrideLevels(r.Level, r.Modules, d); err != nil {
+		resp.Msg = err.Error()
+		resp.State = -1
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+	logger.LogWarnf(c, logger.LogNameDefault, "log levels overridden for %s: level %q, modules %v", d, r.Level, r.Modules)
+
+	resp.Data = logger.GetLevels()
+	resp.WriteResponse(c)
+}
+
+// Revert restores the configured log levels.
+func (l *LevelController) Revert(c *gin.Context) {
+	logger.RevertLevels()
+	resp := &v1.Res{State: 1, Msg: "success", Data: logger.GetLevels()}
+	resp.WriteResponse(c)
+}
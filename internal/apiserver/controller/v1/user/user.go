@@ -1,8 +1,6 @@
 package v1
 
 import (
-	"time"
-
 	v1 "github.com/767829413/normal-frame/internal/apiserver/controller/v1"
 	"github.com/767829413/normal-frame/internal/apiserver/model"
 	srvv1 "github.com/767829413/normal-frame/internal/apiserver/service/v1"
@@ -42,9 +40,6 @@ func (u *UserController) Create(c *gin.Context) {
 		return
 	}
 
-	r.Status = 1
-	r.LoginedAt = time.Now()
-
 	// Insert the user to the storage.
 	if err := u.srv.Users().Create(c, &r); err != nil {
 		resp.Msg = err.Error()
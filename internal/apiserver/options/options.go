@@ -2,20 +2,33 @@
 package options
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
 	cliflag "github.com/767829413/normal-frame/fork/component-base/cli/flag"
 	"github.com/767829413/normal-frame/internal/pkg/options"
+	"github.com/767829413/normal-frame/pkg/certmanager"
+	optionsCli "github.com/767829413/normal-frame/pkg/options"
+	"github.com/767829413/normal-frame/pkg/secret"
 )
 
+// resolveTimeout bounds the time spent resolving secret references.
+const resolveTimeout = 30 * time.Second
+
 type Options struct {
-	GenericServerRunOptions *options.ServerRunOptions `json:"server" mapstructure:"server" yaml:"server"`
-	MySQLOptions            *options.MySQLOptions     `json:"mysql" mapstructure:"mysql" yaml:"mysql"`
-	RedisOptions            *options.RedisOptions     `json:"redis" mapstructure:"redis" yaml:"redis"`
-	LogsOptions             *options.LogsOptions      `json:"logs" mapstructure:"logs" yaml:"logs"`
-	GrpcOptions             *options.GrpcOptions      `json:"grpc" mapstructure:"grpc" yaml:"grpc"`
-	FeatureOptions          *options.FeatureOptions   `json:"feature" mapstructure:"feature" yaml:"feature"`
-	SecureOptions           *options.SecureOptions    `json:"secure" mapstructure:"secure" yaml:"secure"`
-	HttpsOptions            *options.HttpsOptions     `json:"https" mapstructure:"https" yaml:"https"`
-	ApmOptions              *options.ApmOptions       `json:"apm" mapstructure:"apm" yaml:"apm"`
+	GenericServerRunOptions *options.ServerRunOptions  `json:"server" mapstructure:"server" yaml:"server"`
+	MySQLOptions            *options.MySQLOptions      `json:"mysql" mapstructure:"mysql" yaml:"mysql"`
+	RedisOptions            *options.RedisOptions      `json:"redis" mapstructure:"redis" yaml:"redis"`
+	LogsOptions             *options.LogsOptions       `json:"logs" mapstructure:"logs" yaml:"logs"`
+	GrpcOptions             *options.GrpcOptions       `json:"grpc" mapstructure:"grpc" yaml:"grpc"`
+	FeatureOptions          *options.FeatureOptions    `json:"feature" mapstructure:"feature" yaml:"feature"`
+	SecureOptions           *options.SecureOptions     `json:"secure" mapstructure:"secure" yaml:"secure"`
+	HttpsOptions            *options.HttpsOptions      `json:"https" mapstructure:"https" yaml:"https"`
+	ApmOptions              *options.ApmOptions        `json:"apm" mapstructure:"apm" yaml:"apm"`
+	HTTPClientOptions       *options.HTTPClientOptions `json:"http-client" mapstructure:"http-client" yaml:"http-client"`
 }
 
 // NewOptions creates a new Options object with default parameters.
@@ -30,6 +43,7 @@ func NewOptions() *Options {
 		SecureOptions:           options.NewSecureOptions(),
 		HttpsOptions:            options.NewHttpsOptions(),
 		ApmOptions:              options.NewApmOptions(),
+		HTTPClientOptions:       options.NewHTTPClientOptions(),
 	}
 }
 
@@ -44,5 +58,96 @@ func (o *Options) Flags() (fss cliflag.NamedFlagSets) {
 	o.HttpsOptions.AddFlags(fss.FlagSet("https"))
 	o.RedisOptions.AddFlags(fss.FlagSet("redis"))
 	o.ApmOptions.AddFlags(fss.FlagSet("apm"))
+	o.HTTPClientOptions.AddFlags(fss.FlagSet("http-client"))
 	return fss
 }
+
+// Complete resolves the secret references of the options, such as
+// file:///run/secrets/db or env://DB_PASS, into the secrets.
+func (o *Options) Complete() error {
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	return optionsCli.ResolveSecrets(o, func(value string) (string, error) {
+		return secret.Resolve(ctx, value)
+	})
+}
+
+// Validate checks the options and returns every problem found.
+func (o *Options) Validate() []error {
+	var errs []error
+	errs = append(errs, o.GenericServerRunOptions.Validate()...)
+	errs = append(errs, o.MySQLOptions.Validate()...)
+	errs = append(errs, o.RedisOptions.Validate()...)
+	errs = append(errs, o.LogsOptions.Validate()...)
+	errs = append(errs, o.GrpcOptions.Validate()...)
+	errs = append(errs, o.FeatureOptions.Validate()...)
+	errs = append(errs, o.SecureOptions.Validate()...)
+	errs = append(errs, o.HttpsOptions.Validate()...)
+	errs = append(errs, o.ApmOptions.Validate()...)
+	errs = append(errs, o.HTTPClientOptions.Validate()...)
+	errs = append(errs, o.validateListeners()...)
+	errs = append(errs, o.validateAdmin()...)
+	return errs
+}
+
+// validateListeners checks the settings spanning several sections: the HTTP,
+// HTTPS and gRPC servers must not bind the same port and HTTPS needs a
+// certificate.
+func (o *Options) validateListeners() []error {
+	type listener struct {
+		flag    string
+		address string
+		port    int
+	}
+	listeners := []listener{{"server.bind-port", o.GenericServerRunOptions.BindAddress, o.GenericServerRunOptions.BindPort}}
+	if o.HttpsOptions.Enabled {
+		listeners = append(listeners, listener{"https.bind-port", o.HttpsOptions.BindAddress, o.HttpsOptions.BindPort})
+	}
+	if o.GrpcOptions.Enabled {
+		listeners = append(listeners, listener{"grpc.bind-port", o.GrpcOptions.BindAddress, o.GrpcOptions.BindPort})
+	}
+
+	var errs []error
+	for i, l := range listeners {
+		for _, prev := range listeners[:i] {
+			if l.port == prev.port && overlaps(l.address, prev.address) {
+				errs = append(errs, fmt.Errorf("--%s (%s): port %d is already bound by --%s (%s)",
+					l.flag, l.flag, l.port, prev.flag, prev.flag))
+			}
+		}
+	}
+
+	if o.HttpsOptions.Enabled && !o.SecureOptions.HasServerCert() {
+		errs = append(errs, errors.New("--https.enabled (https.enabled): requires --secure.tls.cert-key.cert-file "+
+			"and --secure.tls.cert-key.private-key-file, or --secure.tls.cert-dir and --secure.tls.pair-name"))
+	}
+	return errs
+}
+
+// validateAdmin checks that the admin endpoints can authenticate their
+// clients, they are only served to verified client certificates.
+func (o *Options) validateAdmin() []error {
+	if !o.FeatureOptions.EnableAdmin {
+		return nil
+	}
+	mode := o.SecureOptions.ClientAuth
+	if !o.HttpsOptions.Enabled || mode == "" || mode == certmanager.ClientAuthNone {
+		return []error{errors.New("--feature.enable-admin (feature.enable-admin): requires --https.enabled and " +
+			"--secure.client-auth request or require-and-verify, the admin endpoints are only served to verified client certificates")}
+	}
+	return nil
+}
+
+// overlaps reports whether listening on both addresses would conflict, which
+// is the case when they are equal or either of them is a wildcard address.
+func overlaps(a, b string) bool {
+	if a == b {
+		return true
+	}
+	for _, addr := range []string{a, b} {
+		if ip := net.ParseIP(addr); addr == "" || (ip != nil && ip.IsUnspecified()) {
+			return true
+		}
+	}
+	return false
+}
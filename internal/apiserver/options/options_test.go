@@ -0,0 +1,177 @@
+package options
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDefaults(t *testing.T) {
+	if errs := NewOptions().Validate(); len(errs) != 0 {
+		t.Errorf("default options are invalid: %v", errs)
+	}
+}
+
+func TestValidateReportsEverySection(t *testing.T) {
+	o := NewOptions()
+	o.GenericServerRunOptions.BindPort = 0
+	o.LogsOptions.Level = "verbose"
+	o.HTTPClientOptions.MaxRetries = -1
+	errs := o.Validate()
+	for _, flag := range []string{"--server.bind-port", "--logs.level", "--http-client.max-retries"} {
+		found := false
+		for _, err := range errs {
+			found = found || strings.HasPrefix(err.Error(), flag)
+		}
+		if !found {
+			t.Errorf("no error for %s in %v", flag, errs)
+		}
+	}
+}
+
+func TestValidateListeners(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		setup   func(*Options)
+		want    []string
+		wantNot string
+	}{
+		{
+			name: "same port",
+			setup: func(o *Options) {
+				o.GrpcOptions.Enabled, o.GrpcOptions.BindAddress, o.GrpcOptions.BindPort = true, "10.0.0.1", 8080
+				o.GenericServerRunOptions.BindAddress, o.GenericServerRunOptions.BindPort = "10.0.0.1", 8080
+			},
+			want: []string{"--grpc.bind-port (grpc.bind-port): port 8080 is already bound by --server.bind-port (server.bind-port)"},
+		},
+		{
+			name: "wildcard and specific address",
+			setup: func(o *Options) {
+				o.GrpcOptions.Enabled, o.GrpcOptions.BindAddress, o.GrpcOptions.BindPort = true, "10.0.0.1", 8080
+				o.GenericServerRunOptions.BindAddress, o.GenericServerRunOptions.BindPort = "0.0.0.0", 8080
+			},
+			want: []string{"port 8080 is already bound by --server.bind-port"},
+		},
+		{
+			name: "empty address is a wildcard",
+			setup: func(o *Options) {
+				o.GrpcOptions.Enabled, o.GrpcOptions.BindAddress, o.GrpcOptions.BindPort = true, "::", 8080
+				o.GenericServerRunOptions.BindAddress, o.GenericServerRunOptions.BindPort = "", 8080
+			},
+			want: []string{"port 8080 is already bound by --server.bind-port"},
+		},
+		{
+			name: "different addresses",
+			setup: func(o *Options) {
+				o.GrpcOptions.Enabled, o.GrpcOptions.BindAddress, o.GrpcOptions.BindPort = true, "10.0.0.1", 8080
+				o.GenericServerRunOptions.BindAddress, o.GenericServerRunOptions.BindPort = "10.0.0.2", 8080
+			},
+			wantNot: "already bound",
+		},
+		{
+			name: "disabled server",
+			setup: func(o *Options) {
+				o.GrpcOptions.Enabled, o.GrpcOptions.BindPort = false, o.GenericServerRunOptions.BindPort
+				o.HttpsOptions.Enabled, o.HttpsOptions.BindPort = false, o.GenericServerRunOptions.BindPort
+			},
+			wantNot: "already bound",
+		},
+		{
+			name: "three servers on one port",
+			setup: func(o *Options) {
+				o.GenericServerRunOptions.BindAddress, o.GenericServerRunOptions.BindPort = "", 9000
+				o.HttpsOptions.Enabled, o.HttpsOptions.BindAddress, o.HttpsOptions.BindPort = true, "0.0.0.0", 9000
+				o.GrpcOptions.Enabled, o.GrpcOptions.BindAddress, o.GrpcOptions.BindPort = true, "0.0.0.0", 9000
+				o.SecureOptions.ServerCert.CertKey.CertFile = "tls.crt"
+				o.SecureOptions.ServerCert.CertKey.KeyFile = "tls.key"
+			},
+			want: []string{
+				"--https.bind-port (https.bind-port): port 9000 is already bound by --server.bind-port",
+				"--grpc.bind-port (grpc.bind-port): port 9000 is already bound by --server.bind-port",
+				"--grpc.bind-port (grpc.bind-port): port 9000 is already bound by --https.bind-port",
+			},
+		},
+		{
+			name: "https without certificate",
+			setup: func(o *Options) {
+				o.HttpsOptions.Enabled = true
+			},
+			want: []string{"--https.enabled (https.enabled): requires --secure.tls.cert-key.cert-file"},
+		},
+		{
+			name: "https with a generated pair",
+			setup: func(o *Options) {
+				o.HttpsOptions.Enabled = true
+				o.SecureOptions.ServerCert.CertDirectory, o.SecureOptions.ServerCert.PairName = "/var/run/certs", "apiserver"
+			},
+			wantNot: "https.enabled",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOptions()
+			tt.setup(o)
+			var msgs []string
+			for _, err := range o.validateListeners() {
+				msgs = append(msgs, err.Error())
+			}
+			got := strings.Join(msgs, "\n")
+			if len(msgs) != len(tt.want) {
+				t.Errorf("errors:\n%s\nwant %d errors", got, len(tt.want))
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("errors:\n%s\nwant %q", got, want)
+				}
+			}
+			if tt.wantNot != "" && strings.Contains(got, tt.wantNot) {
+				t.Errorf("errors:\n%s\nwant none about %q", got, tt.wantNot)
+			}
+		})
+	}
+}
+
+func TestValidateAdmin(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		setup func(*Options)
+		ok    bool
+	}{
+		{name: "disabled", setup: func(*Options) {}, ok: true},
+		{name: "plain HTTP", setup: func(o *Options) { o.FeatureOptions.EnableAdmin = true }},
+		{name: "https without client certificates", setup: func(o *Options) {
+			o.FeatureOptions.EnableAdmin, o.HttpsOptions.Enabled = true, true
+		}},
+		{name: "verified client certificates", setup: func(o *Options) {
+			o.FeatureOptions.EnableAdmin, o.HttpsOptions.Enabled = true, true
+			o.SecureOptions.ClientAuth = "require-and-verify"
+		}, ok: true},
+		{name: "requested client certificates", setup: func(o *Options) {
+			o.FeatureOptions.EnableAdmin, o.HttpsOptions.Enabled = true, true
+			o.SecureOptions.ClientAuth = "request"
+		}, ok: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOptions()
+			tt.setup(o)
+			errs := o.validateAdmin()
+			if tt.ok && len(errs) != 0 {
+				t.Errorf("errors: %v, want none", errs)
+			}
+			if !tt.ok && (len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "--feature.enable-admin (feature.enable-admin): requires --https.enabled")) {
+				t.Errorf("errors: %v, want the admin endpoints rejected", errs)
+			}
+		})
+	}
+}
+
+func TestValidateLogModules(t *testing.T) {
+	o := NewOptions()
+	o.LogsOptions.Modules = map[string]string{"mysql": "warn", "myslq": "debug"}
+	var msgs []string
+	for _, err := range o.Validate() {
+		msgs = append(msgs, err.Error())
+	}
+	got := strings.Join(msgs, "\n")
+	if len(msgs) != 1 || !strings.Contains(got, `--logs.modules (logs.modules.myslq): unknown log category "myslq"`) {
+		t.Errorf("errors:\n%s\nwant the unknown category only", got)
+	}
+}
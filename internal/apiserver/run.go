@@ -3,20 +3,43 @@ package apiserver
 import (
 	"github.com/767829413/normal-frame/internal/apiserver/options"
 	"github.com/767829413/normal-frame/internal/pkg/logger"
+	"github.com/767829413/normal-frame/internal/pkg/reload"
 	apiSver "github.com/767829413/normal-frame/internal/pkg/server"
 	"github.com/767829413/normal-frame/pkg/app"
+	optionsCli "github.com/767829413/normal-frame/pkg/options"
+	"github.com/spf13/viper"
 )
 
-func GetRunFunc(opts *options.Options) app.RunFunc {
+func GetRunFunc(opts *options.Options, notifier *reload.Notifier) app.RunFunc {
 	return func(basename string) error {
 		logger.Init(opts.LogsOptions)
-		return Run(opts)
+		return Run(opts, notifier)
+	}
+}
+
+// GetReloadFunc reads the changed configuration into fresh options, validates
+// them and hands them to the notifier. Invalid configuration is rejected and
+// the server keeps running with the previous options.
+func GetReloadFunc(notifier *reload.Notifier) app.ReloadFunc {
+	return func(basename string) error {
+		opts := options.NewOptions()
+		if err := viper.Unmarshal(opts, viper.DecodeHook(optionsCli.DecodeHook())); err != nil {
+			return err
+		}
+		if err := opts.Complete(); err != nil {
+			return err
+		}
+		if err := optionsCli.Aggregate(opts.Validate()); err != nil {
+			return err
+		}
+		notifier.Apply(opts)
+		return nil
 	}
 }
 
 // Run runs the specified APIServer. This should never exit.
-func Run(opts *options.Options) error {
-	server, err := apiSver.CreateAPIServer(opts)
+func Run(opts *options.Options, notifier *reload.Notifier) error {
+	server, err := apiSver.CreateAPIServer(opts, notifier)
 	if err != nil {
 		return err
 	}
@@ -2,17 +2,20 @@ package v1
 
 import (
 	"context"
+	"time"
 
 	"github.com/767829413/normal-frame/internal/apiserver/model"
 	"github.com/767829413/normal-frame/internal/pkg/store"
+	"github.com/767829413/normal-frame/pkg/auth"
 )
 
 type UserSrv interface {
 	Create(ctx context.Context, user *model.User) error
-	// Update(ctx context.Context, user *model.User) error
-	// Delete(ctx context.Context, username string) error
-	// Get(ctx context.Context, username string) (*model.User, error)
-	// List(ctx context.Context) (*model.UserList, error)
+	Update(ctx context.Context, user *model.User) error
+	ChangePassword(ctx context.Context, user *model.User, password string) error
+	Delete(ctx context.Context, email string) error
+	Get(ctx context.Context, email string) (*model.User, error)
+	List(ctx context.Context) (*model.UserList, error)
 }
 
 type userService struct {
@@ -25,20 +28,54 @@ func newUsers(srv *service) *userService {
 	return &userService{store: srv.store}
 }
 
+// Create stores a new user, its password is hashed first.
 func (u *userService) Create(ctx context.Context, user *model.User) error {
-	u.store.GetDb().Model(&model.User{}).Create(user)
-	return nil
-}
-
-// func (u *userService) Get(ctx context.Context, username string) (*model.User, error) {
-// 	return nil, nil
-// }
-// func (u *userService) Update(ctx context.Context, user *model.User) error {
-// 	return nil
-// }
-// func (u *userService) Delete(ctx context.Context, username string) error {
-// 	return nil
-// }
-// func (u *userService) List(ctx context.Context) (*model.UserList, error) {
-// 	return nil, nil
-// }
+	hashed, err := auth.Encrypt(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Password = hashed
+	user.Status = 1
+	user.LoginedAt = time.Now()
+
+	return u.store.GetDb().WithContext(ctx).Model(&model.User{}).Create(user).Error
+}
+
+// Update saves every field of the user.
+func (u *userService) Update(ctx context.Context, user *model.User) error {
+	return u.store.GetDb().WithContext(ctx).Save(user).Error
+}
+
+// ChangePassword hashes password and stores it as the password of the user.
+func (u *userService) ChangePassword(ctx context.Context, user *model.User, password string) error {
+	hashed, err := auth.Encrypt(password)
+	if err != nil {
+		return err
+	}
+	user.Password = hashed
+
+	return u.store.GetDb().WithContext(ctx).Model(user).Update("password", hashed).Error
+}
+
+// Delete removes the user with the email.
+func (u *userService) Delete(ctx context.Context, email string) error {
+	return u.store.GetDb().WithContext(ctx).Where("email = ?", email).Delete(&model.User{}).Error
+}
+
+// Get returns the user with the email.
+func (u *userService) Get(ctx context.Context, email string) (*model.User, error) {
+	user := &model.User{}
+	if err := u.store.GetDb().WithContext(ctx).Where("email = ?", email).First(user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// List returns every user, ordered by id.
+func (u *userService) List(ctx context.Context) (*model.UserList, error) {
+	list := &model.UserList{}
+	if err := u.store.GetDb().WithContext(ctx).Order("id").Find(&list.Items).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
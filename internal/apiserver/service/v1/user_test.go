@@ -0,0 +1,144 @@
+package v1
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"github.com/767829413/normal-frame/internal/apiserver/model"
+	"github.com/767829413/normal-frame/pkg/auth"
+)
+
+type statement struct {
+	sql  string
+	vars []interface{}
+}
+
+// dryRunStore builds the statements of the service without a database and
+// records them.
+type dryRunStore struct {
+	db         *gorm.DB
+	statements []statement
+}
+
+func newDryRunStore(t *testing.T) *dryRunStore {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "user:pass@tcp(127.0.0.1:3306)/shop?parseTime=true",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		NamingStrategy:         schema.NamingStrategy{SingularTable: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &dryRunStore{db: db}
+	record := func(db *gorm.DB) {
+		s.statements = append(s.statements, statement{sql: db.Statement.SQL.String(), vars: db.Statement.Vars})
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("test:record", record); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("test:record", record); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func (s *dryRunStore) GetDb() *gorm.DB {
+	return s.db
+}
+
+// hashVar returns the variable of the only statement that is a bcrypt hash.
+func (s *dryRunStore) hashVar(t *testing.T) string {
+	t.Helper()
+	if len(s.statements) != 1 {
+		t.Fatalf("statements = %v, want one", s.statements)
+	}
+	var hashes []string
+	for _, v := range s.statements[0].vars {
+		if str, ok := v.(string); ok && strings.HasPrefix(str, "$2a$") {
+			hashes = append(hashes, str)
+		}
+	}
+	if len(hashes) != 1 {
+		t.Fatalf("statement %s with %v, want one bcrypt hash", s.statements[0].sql, s.statements[0].vars)
+	}
+	return hashes[0]
+}
+
+func TestCreateHashesThePassword(t *testing.T) {
+	st := newDryRunStore(t)
+	user := &model.User{Nickname: "someone", Email: "someone@example.com", Password: "s3cret-pass"}
+	if err := NewService(st).Users().Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(st.statements[0].sql, "INSERT INTO `user`") {
+		t.Errorf("statement = %s", st.statements[0].sql)
+	}
+	for _, v := range st.statements[0].vars {
+		if v == "s3cret-pass" {
+			t.Fatal("the plain text password is stored")
+		}
+	}
+	stored := st.hashVar(t)
+	if stored != user.Password {
+		t.Errorf("stored %q, the user holds %q", stored, user.Password)
+	}
+	if err := auth.Compare(stored, "s3cret-pass"); err != nil {
+		t.Errorf("the stored hash does not match the password: %v", err)
+	}
+	if user.Status != 1 || user.LoginedAt.IsZero() {
+		t.Errorf("user = %+v, want it active with a login time", user)
+	}
+}
+
+func TestChangePasswordHashesThePassword(t *testing.T) {
+	st := newDryRunStore(t)
+	previous, err := auth.Encrypt("old-pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &model.User{Model: gorm.Model{ID: 7}, Email: "someone@example.com", Password: previous}
+	if err := NewService(st).Users().ChangePassword(context.Background(), user, "new-pass"); err != nil {
+		t.Fatal(err)
+	}
+
+	sql := st.statements[0].sql
+	if !strings.HasPrefix(sql, "UPDATE `user` SET `password`=?") || !strings.Contains(sql, "`id` = ?") {
+		t.Errorf("statement = %s, want the password of the user updated", sql)
+	}
+	stored := st.hashVar(t)
+	if stored != user.Password || stored == previous {
+		t.Errorf("stored %q, the user holds %q", stored, user.Password)
+	}
+	if err := auth.Compare(stored, "new-pass"); err != nil {
+		t.Errorf("the stored hash does not match the new password: %v", err)
+	}
+	if auth.Compare(stored, "old-pass") == nil {
+		t.Error("the old password still matches")
+	}
+}
+
+func TestHashesAreSalted(t *testing.T) {
+	st := newDryRunStore(t)
+	users := NewService(st).Users()
+	a := &model.User{Email: "a@example.com", Password: "same-pass"}
+	b := &model.User{Email: "b@example.com", Password: "same-pass"}
+	for _, u := range []*model.User{a, b} {
+		if err := users.Create(context.Background(), u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.Password == b.Password {
+		t.Error("two users with the same password have the same hash")
+	}
+}
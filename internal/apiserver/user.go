@@ -0,0 +1,272 @@
+package apiserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/767829413/normal-frame/internal/apiserver/model"
+	"github.com/767829413/normal-frame/internal/apiserver/options"
+	srvv1 "github.com/767829413/normal-frame/internal/apiserver/service/v1"
+	"github.com/767829413/normal-frame/internal/apiserver/validation"
+	"github.com/767829413/normal-frame/internal/pkg/store"
+	"github.com/767829413/normal-frame/pkg/app"
+	"github.com/767829413/normal-frame/pkg/secret"
+	"github.com/spf13/pflag"
+)
+
+// newUserCommand creates the user command managing the users in the store
+// configured for the server.
+func newUserCommand() *app.Command {
+	cmd := app.NewCommand("user", "Create, list, promote, reset the password of and delete users.")
+	cmd.AddCommands(
+		newUserCreateCommand(),
+		newUserListCommand(),
+		newUserSetAdminCommand(),
+		newUserResetPasswordCommand(),
+		newUserDeleteCommand(),
+	)
+	return cmd
+}
+
+func newUserCreateCommand() *app.Command {
+	opts := options.NewOptions()
+	var (
+		user     model.User
+		admin    bool
+		password string
+		output   string
+	)
+	return app.NewCommand("create",
+		"Create a user, the password is read from stdin when --password is not set.",
+		app.WithCommandOptions(opts),
+		app.WithCommandFlags(func(fs *pflag.FlagSet) {
+			fs.StringVar(&user.Email, "email", "", "Email of the user, it identifies the user in the other commands.")
+			fs.StringVar(&user.Nickname, "nickname", "", "Nickname of the user.")
+			fs.StringVar(&user.Phone, "phone", "", "Phone number of the user.")
+			fs.BoolVar(&admin, "admin", false, "Whether the user is an administrator.")
+			addPasswordFlag(fs, &password)
+			addOutputFlag(fs, &output)
+		}),
+		app.WithCommandRunFunc(func(args []string) error {
+			if user.Email == "" || user.Nickname == "" {
+				return errors.New("--email and --nickname are required")
+			}
+			var err error
+			if user.Password, err = readPassword(password); err != nil {
+				return err
+			}
+			if err := validation.Create(user); err != nil {
+				return err
+			}
+			if admin {
+				user.IsAdmin = 1
+			}
+
+			users, err := newUserService(opts)
+			if err != nil {
+				return err
+			}
+			if err := users.Create(context.Background(), &user); err != nil {
+				return err
+			}
+			return writeUsers(os.Stdout, []*model.User{&user}, output)
+		}),
+	)
+}
+
+func newUserListCommand() *app.Command {
+	opts := options.NewOptions()
+	var output string
+	return app.NewCommand("list",
+		"List the users.",
+		app.WithCommandOptions(opts),
+		app.WithCommandFlags(func(fs *pflag.FlagSet) {
+			addOutputFlag(fs, &output)
+		}),
+		app.WithCommandRunFunc(func(args []string) error {
+			users, err := newUserService(opts)
+			if err != nil {
+				return err
+			}
+			list, err := users.List(context.Background())
+			if err != nil {
+				return err
+			}
+			return writeUsers(os.Stdout, list.Items, output)
+		}),
+	)
+}
+
+func newUserSetAdminCommand() *app.Command {
+	opts := options.NewOptions()
+	var (
+		admin  bool
+		output string
+	)
+	return app.NewCommand("set-admin EMAIL",
+		"Grant the user administrator rights, or revoke them with --admin=false.",
+		app.WithCommandOptions(opts),
+		app.WithCommandFlags(func(fs *pflag.FlagSet) {
+			fs.BoolVar(&admin, "admin", true, "Whether the user is an administrator.")
+			addOutputFlag(fs, &output)
+		}),
+		app.WithCommandRunFunc(func(args []string) error {
+			email, err := emailArg(args)
+			if err != nil {
+				return err
+			}
+			users, err := newUserService(opts)
+			if err != nil {
+				return err
+			}
+			user, err := users.Get(context.Background(), email)
+			if err != nil {
+				return err
+			}
+			user.IsAdmin = 0
+			if admin {
+				user.IsAdmin = 1
+			}
+			if err := users.Update(context.Background(), user); err != nil {
+				return err
+			}
+			return writeUsers(os.Stdout, []*model.User{user}, output)
+		}),
+	)
+}
+
+func newUserResetPasswordCommand() *app.Command {
+	opts := options.NewOptions()
+	var password string
+	return app.NewCommand("reset-password EMAIL",
+		"Set a new password for the user, it is read from stdin when --password is not set.",
+		app.WithCommandOptions(opts),
+		app.WithCommandFlags(func(fs *pflag.FlagSet) {
+			addPasswordFlag(fs, &password)
+		}),
+		app.WithCommandRunFunc(func(args []string) error {
+			email, err := emailArg(args)
+			if err != nil {
+				return err
+			}
+			if password, err = readPassword(password); err != nil {
+				return err
+			}
+			if err := validation.IsValidPassword(password); err != nil {
+				return err
+			}
+			users, err := newUserService(opts)
+			if err != nil {
+				return err
+			}
+			user, err := users.Get(context.Background(), email)
+			if err != nil {
+				return err
+			}
+			if err := users.ChangePassword(context.Background(), user, password); err != nil {
+				return err
+			}
+			fmt.Printf("password of %s reset\n", email)
+			return nil
+		}),
+	)
+}
+
+func newUserDeleteCommand() *app.Command {
+	opts := options.NewOptions()
+	return app.NewCommand("delete EMAIL",
+		"Delete the user.",
+		app.WithCommandOptions(opts),
+		app.WithCommandRunFunc(func(args []string) error {
+			email, err := emailArg(args)
+			if err != nil {
+				return err
+			}
+			users, err := newUserService(opts)
+			if err != nil {
+				return err
+			}
+			if _, err := users.Get(context.Background(), email); err != nil {
+				return err
+			}
+			if err := users.Delete(context.Background(), email); err != nil {
+				return err
+			}
+			fmt.Printf("user %s deleted\n", email)
+			return nil
+		}),
+	)
+}
+
+// newUserService connects to the store configured in opts.
+func newUserService(opts *options.Options) (srvv1.UserSrv, error) {
+	st, err := store.GetMySQLFactoryOr(opts.MySQLOptions)
+	if err != nil {
+		return nil, err
+	}
+	if st == nil {
+		return nil, errors.New("mysql is not enabled, users are stored in mysql, set --mysql.enabled")
+	}
+	return srvv1.NewService(st).Users(), nil
+}
+
+func addPasswordFlag(fs *pflag.FlagSet, password *string) {
+	fs.StringVar(password, "password", "", ""+
+		"Password of the user, or a reference such as env://USER_PASS or file:///run/secrets/user. "+
+		"Read from stdin when not set, which keeps it out of the process list.")
+}
+
+func addOutputFlag(fs *pflag.FlagSet, output *string) {
+	fs.StringVarP(output, "output", "o", "table", "Output format, table or json.")
+}
+
+// readPassword resolves password when it is a secret reference, or reads the
+// first line of stdin when it is empty.
+func readPassword(password string) (string, error) {
+	if password != "" {
+		return secret.Resolve(context.Background(), password)
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", fmt.Errorf("failed to read the password from stdin: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func emailArg(args []string) (string, error) {
+	if len(args) != 1 || args[0] == "" {
+		return "", errors.New("exactly one EMAIL argument is required")
+	}
+	return args[0], nil
+}
+
+// writeUsers prints the users as a table or json, without their password.
+func writeUsers(w io.Writer, users []*model.User, output string) error {
+	for _, user := range users {
+		user.Password = ""
+	}
+	switch output {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(&model.UserList{Items: users})
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tEMAIL\tNICKNAME\tPHONE\tADMIN\tSTATUS\tCREATED")
+		for _, user := range users {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%t\t%d\t%s\n", user.ID, user.Email, user.Nickname, user.Phone,
+				user.IsAdmin == 1, user.Status, user.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q, must be table or json", output)
+	}
+}
@@ -0,0 +1,34 @@
+package apiserver
+
+import (
+	"fmt"
+
+	"github.com/767829413/normal-frame/pkg/app"
+	"github.com/767829413/normal-frame/pkg/version"
+	"github.com/spf13/pflag"
+)
+
+// newVersionCommand creates the version command printing the build metadata.
+func newVersionCommand() *app.Command {
+	var output string
+	return app.NewCommand("version",
+		"Print the version, git commit, build date and platform of the binary.",
+		app.WithCommandFlags(func(fs *pflag.FlagSet) {
+			fs.StringVarP(&output, "output", "o", "", "Output format, json or yaml. Human readable text when empty.")
+		}),
+		app.WithCommandRunFunc(func(args []string) error {
+			info := version.Get()
+			switch output {
+			case "":
+				fmt.Print(info.Text())
+			case "json":
+				fmt.Print(info.JSON())
+			case "yaml":
+				fmt.Print(info.YAML())
+			default:
+				return fmt.Errorf("unknown output format %q, must be json or yaml", output)
+			}
+			return nil
+		}),
+	)
+}
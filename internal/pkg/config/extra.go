@@ -13,6 +13,8 @@ type ExtraConfig struct {
 	PairName      string
 	CertFile      string
 	KeyFile       string
+	ClientCAFile  string
+	ClientAuth    string
 }
 
 func NewExtraConfig() *ExtraConfig {
@@ -9,6 +9,37 @@ type GenericConfig struct {
 	GzipLevel     int
 	EnableMetrics bool
 	EnablePprof   bool
+	EnableAdmin   bool
+	// AdminIdentities are the client identities allowed on the admin
+	// endpoints, any verified client when empty.
+	AdminIdentities []string
+
+	CorsAllowOrigins []string
+	RateLimitEnabled bool
+	RateLimitQPS     float64
+	RateLimitBurst   int
+
+	AccessLog AccessLogConfig
+}
+
+// AccessLogConfig configures the access log of the HTTP requests.
+type AccessLogConfig struct {
+	Enabled bool
+	// SkipPaths are not logged, a path ending with * matches its prefix.
+	SkipPaths []string
+	// SampleRate is the fraction of the successful requests logged, the
+	// failed ones are always logged.
+	SampleRate float64
+	// Headers logs the request headers, Body the request and response bodies
+	// of BodyContentTypes up to MaxBodySize bytes.
+	Headers          bool
+	Body             bool
+	MaxBodySize      int
+	BodyContentTypes []string
+	// RedactFields are the JSON paths, such as user.password or items.*.token,
+	// and form fields replaced in the bodies; RedactHeaders the headers.
+	RedactFields  []string
+	RedactHeaders []string
 }
 
 // NewConfig returns a Config struct with the default values.
@@ -0,0 +1,293 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/767829413/normal-frame/internal/pkg/config"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+const (
+	fieldMethod       = "method"       // 请求方法
+	fieldStatus       = "status"       // 响应状态码
+	fieldLatency      = "latency"      // 处理耗时, 毫秒
+	fieldBytes        = "bytes"        // 响应大小
+	fieldHeaders      = "headers"      // 请求头
+	fieldRequestBody  = "requestBody"  // 请求体
+	fieldResponseBody = "responseBody" // 响应体
+)
+
+// redacted replaces the masked values.
+const redacted = "***"
+
+// AccessLog logs the requests to the api category once they are handled,
+// with their method, status, latency, response size and the fields of the
+// request logger, so it must run after Middleware. Failed requests are logged
+// at warning or error level and are never sampled out.
+func AccessLog(cfg config.AccessLogConfig) gin.HandlerFunc {
+	if !cfg.Enabled {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	return newAccessLogger(cfg).handle
+}
+
+type accessLogger struct {
+	cfg           config.AccessLogConfig
+	skipPaths     map[string]struct{}
+	skipPrefixes  []string
+	contentTypes  map[string]struct{}
+	redactFields  [][]string
+	redactHeaders map[string]struct{}
+}
+
+func newAccessLogger(cfg config.AccessLogConfig) *accessLogger {
+	a := &accessLogger{
+		cfg:           cfg,
+		skipPaths:     map[string]struct{}{},
+		contentTypes:  map[string]struct{}{},
+		redactHeaders: map[string]struct{}{},
+	}
+	for _, path := range cfg.SkipPaths {
+		if strings.HasSuffix(path, "*") {
+			a.skipPrefixes = append(a.skipPrefixes, strings.TrimSuffix(path, "*"))
+		} else {
+			a.skipPaths[path] = struct{}{}
+		}
+	}
+	for _, contentType := range cfg.BodyContentTypes {
+		a.contentTypes[strings.ToLower(contentType)] = struct{}{}
+	}
+	for _, field := range cfg.RedactFields {
+		a.redactFields = append(a.redactFields, strings.Split(field, "."))
+	}
+	for _, header := range cfg.RedactHeaders {
+		a.redactHeaders[http.CanonicalHeaderKey(header)] = struct{}{}
+	}
+	return a
+}
+
+func (a *accessLogger) handle(c *gin.Context) {
+	if a.skip(c.Request.URL.Path) {
+		c.Next()
+		return
+	}
+	start := time.Now()
+
+	var reqBody []byte
+	reqTooLarge := false
+	if a.cfg.Body && c.Request.Body != nil && a.captured(c.GetHeader("Content-Type")) {
+		reqBody, reqTooLarge = a.readBody(c.Request)
+	}
+	var w *bodyWriter
+	if a.cfg.Body {
+		w = &bodyWriter{ResponseWriter: c.Writer, max: a.cfg.MaxBodySize}
+		c.Writer = w
+	}
+
+	c.Next()
+
+	status := c.Writer.Status()
+	level := zerolog.InfoLevel
+	switch {
+	case status >= http.StatusInternalServerError:
+		level = zerolog.ErrorLevel
+	case status >= http.StatusBadRequest:
+		level = zerolog.WarnLevel
+	case a.cfg.SampleRate < 1 && rand.Float64() >= a.cfg.SampleRate:
+		return
+	}
+	if !enabled(LogNameAPI, level) {
+		return
+	}
+
+	size := c.Writer.Size()
+	if size < 0 {
+		size = 0
+	}
+	l := ginLogger(c)
+	e := l.start(level).
+		Str(fieldType, typeAccess).
+		Str(fieldMethod, c.Request.Method).
+		Int(fieldStatus, status).
+		Dur(fieldLatency, time.Since(start)).
+		Int(fieldBytes, size)
+	if a.cfg.Headers {
+		e.Dict(fieldHeaders, a.headers(c.Request.Header))
+	}
+	if len(reqBody) > 0 || reqTooLarge {
+		e.Str(fieldRequestBody, a.body(reqBody, reqTooLarge, c.GetHeader("Content-Type")))
+	}
+	if w != nil && (w.buf.Len() > 0 || w.tooLarge) && a.captured(w.Header().Get("Content-Type")) {
+		e.Str(fieldResponseBody, a.body(w.buf.Bytes(), w.tooLarge, w.Header().Get("Content-Type")))
+	}
+	e.Msg(LogNameAPI + " : " + c.Request.Method + " " + c.Request.URL.Path + " " + strconv.Itoa(status))
+}
+
+func (a *accessLogger) skip(path string) bool {
+	if _, ok := a.skipPaths[path]; ok {
+		return true
+	}
+	for _, prefix := range a.skipPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// captured reports whether the bodies of contentType are logged.
+func (a *accessLogger) captured(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	_, ok := a.contentTypes[mediaType]
+	return ok
+}
+
+// readBody reads up to MaxBodySize bytes of the request body and leaves the
+// whole body to the handlers.
+func (a *accessLogger) readBody(r *http.Request) ([]byte, bool) {
+	buf, _ := io.ReadAll(io.LimitReader(r.Body, int64(a.cfg.MaxBodySize)+1))
+	r.Body = &replayBody{Reader: io.MultiReader(bytes.NewReader(buf), r.Body), Closer: r.Body}
+	if len(buf) > a.cfg.MaxBodySize {
+		return nil, true
+	}
+	return buf, false
+}
+
+// body formats a captured body with its redacted fields. A body larger than
+// MaxBodySize or that cannot be parsed is left out, it could not be redacted.
+func (a *accessLogger) body(b []byte, tooLarge bool, contentType string) string {
+	if tooLarge {
+		return "[larger than " + strconv.Itoa(a.cfg.MaxBodySize) + " bytes]"
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		var v interface{}
+		if err := d.Decode(&v); err != nil {
+			return "[invalid json]"
+		}
+		for _, path := range a.redactFields {
+			redact(v, path)
+		}
+		js, err := json.Marshal(v)
+		if err != nil {
+			return "[invalid json]"
+		}
+		return string(js)
+	case mediaType == "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(b))
+		if err != nil {
+			return "[invalid form]"
+		}
+		for _, path := range a.redactFields {
+			if len(path) != 1 {
+				continue
+			}
+			for key, values := range form {
+				if strings.EqualFold(key, path[0]) {
+					for i := range values {
+						values[i] = redacted
+					}
+				}
+			}
+		}
+		return form.Encode()
+	default:
+		return string(b)
+	}
+}
+
+func (a *accessLogger) headers(header http.Header) *zerolog.Event {
+	d := zerolog.Dict()
+	for name, values := range header {
+		if _, ok := a.redactHeaders[name]; ok {
+			d.Str(name, redacted)
+		} else {
+			d.Str(name, strings.Join(values, ", "))
+		}
+	}
+	return d
+}
+
+// redact masks the values of v at path, where * matches any key or array
+// element. Arrays are also matched element by element, so password masks the
+// passwords of a list of objects.
+func redact(v interface{}, path []string) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for key, child := range t {
+			if path[0] != "*" && !strings.EqualFold(path[0], key) {
+				continue
+			}
+			if len(path) == 1 {
+				t[key] = redacted
+			} else {
+				redact(child, path[1:])
+			}
+		}
+	case []interface{}:
+		for i, child := range t {
+			switch {
+			case path[0] != "*":
+				redact(child, path)
+			case len(path) == 1:
+				t[i] = redacted
+			default:
+				redact(child, path[1:])
+			}
+		}
+	}
+}
+
+// replayBody is a request body whose beginning was already read.
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+// bodyWriter keeps the first max bytes of the response body.
+type bodyWriter struct {
+	gin.ResponseWriter
+	max      int
+	buf      bytes.Buffer
+	tooLarge bool
+}
+
+func (w *bodyWriter) Write(b []byte) (int, error) {
+	w.capture(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *bodyWriter) capture(b []byte) {
+	if w.tooLarge {
+		return
+	}
+	if w.buf.Len()+len(b) > w.max {
+		w.tooLarge = true
+		w.buf.Reset()
+		return
+	}
+	w.buf.Write(b)
+}
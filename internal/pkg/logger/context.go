@@ -0,0 +1,256 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	fieldRequestID = "requestId" // 请求ID, 后台任务每次执行一个
+	fieldRoute     = "route"     // 路由模板或gRPC方法
+	fieldUser      = "user"      // 调用者身份
+	fieldJob       = "job"       // 后台任务名
+)
+
+// Logger logs entries carrying the fields attached to a context, such as the
+// request ID, route and user set by Middleware. It follows the levels of its
+// category, LogNameDefault unless changed with Named.
+type Logger struct {
+	zl   zerolog.Logger
+	name string
+	// ctx is the context the logger was retrieved from, the IDs of its active
+	// span are added to every entry.
+	ctx context.Context
+	// c is set for the LogXxx calls of a request without context logger, they
+	// keep the fields of the gin context.
+	c *gin.Context
+	// typ is the type of the entries, EVENT when empty.
+	typ string
+}
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx carrying l.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger attached to ctx, or a logger without request
+// fields when there is none. A *gin.Context is looked up through its request.
+func FromContext(ctx context.Context) *Logger {
+	if c, ok := ctx.(*gin.Context); ok {
+		if c.Request == nil {
+			return &Logger{zl: base, name: LogNameDefault}
+		}
+		ctx = c.Request.Context()
+	}
+	if ctx == nil {
+		return &Logger{zl: base, name: LogNameDefault}
+	}
+	if l, ok := ctx.Value(loggerKey{}).(*Logger); ok {
+		return &Logger{zl: l.zl, name: l.name, ctx: ctx, typ: l.typ}
+	}
+	return &Logger{zl: base, name: LogNameDefault, ctx: ctx}
+}
+
+// NewJobContext returns a copy of ctx carrying a logger for one run of the
+// background job name, its entries share a new request ID.
+func NewJobContext(ctx context.Context, name string) context.Context {
+	requestID := NewRequestID()
+	ctx = context.WithValue(ctx, requestIDKey{}, requestID)
+	return NewContext(ctx, FromContext(ctx).With(fieldJob, name, fieldRequestID, requestID))
+}
+
+type requestIDKey struct{}
+
+// RequestID returns the request ID of ctx, set by Middleware, the gRPC
+// interceptors and NewJobContext, or an empty string.
+func RequestID(ctx context.Context) string {
+	if c, ok := ctx.(*gin.Context); ok {
+		if c.Request == nil {
+			return ""
+		}
+		ctx = c.Request.Context()
+	}
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns a random ID for a request that came without one.
+func NewRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// With returns a logger adding the key value pairs to every entry.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	return &Logger{zl: l.zl.With().Fields(keyvals).Logger(), name: l.name, ctx: l.ctx, c: l.c, typ: l.typ}
+}
+
+// Named returns a logger for the category logName, one of the LogName
+// constants.
+func (l *Logger) Named(logName string) *Logger {
+	return &Logger{zl: l.zl, name: getLogName(logName), ctx: l.ctx, c: l.c, typ: l.typ}
+}
+
+func (l *Logger) Debug(msg string) {
+	if !enabled(l.name, zerolog.DebugLevel) {
+		return
+	}
+	l.event(zerolog.DebugLevel).Msg(l.name + " : " + msg)
+}
+
+func (l *Logger) Debugf(template string, args ...interface{}) {
+	if !enabled(l.name, zerolog.DebugLevel) {
+		return
+	}
+	l.event(zerolog.DebugLevel).Msgf(l.name+":"+template, args...)
+}
+
+func (l *Logger) Info(msg string) {
+	if !enabled(l.name, zerolog.InfoLevel) {
+		return
+	}
+	l.event(zerolog.InfoLevel).Msg(l.name + " : " + msg)
+}
+
+func (l *Logger) Infof(template string, args ...interface{}) {
+	if !enabled(l.name, zerolog.InfoLevel) {
+		return
+	}
+	l.event(zerolog.InfoLevel).Msgf(l.name+":"+template, args...)
+}
+
+func (l *Logger) Warn(msg string) {
+	if !enabled(l.name, zerolog.WarnLevel) {
+		return
+	}
+	l.event(zerolog.WarnLevel).Msg(l.name + " : " + msg)
+}
+
+func (l *Logger) Warnf(template string, args ...interface{}) {
+	if !enabled(l.name, zerolog.WarnLevel) {
+		return
+	}
+	l.event(zerolog.WarnLevel).Msgf(l.name+":"+template, args...)
+}
+
+func (l *Logger) Error(msg string) {
+	if !enabled(l.name, zerolog.ErrorLevel) {
+		return
+	}
+	l.event(zerolog.ErrorLevel).Msg(l.name + " : " + msg)
+}
+
+func (l *Logger) Errorw(msg string, err error) {
+	if !enabled(l.name, zerolog.ErrorLevel) {
+		return
+	}
+	l.event(zerolog.ErrorLevel).Msg(l.name + " : " + msg + ", " + err.Error())
+}
+
+func (l *Logger) Errorf(template string, args ...interface{}) {
+	if !enabled(l.name, zerolog.ErrorLevel) {
+		return
+	}
+	l.event(zerolog.ErrorLevel).Msgf(l.name+":"+template, args...)
+}
+
+// event starts an entry of l at level with its type and the caller when it is
+// enabled.
+func (l *Logger) event(level zerolog.Level) *zerolog.Event {
+	e := l.start(level).Str(fieldType, l.entryType())
+	if level >= callerLevel {
+		e.Str(fieldLogger, traceFunc())
+	}
+	return e
+}
+
+// entryType returns the type of the entries of l.
+func (l *Logger) entryType() string {
+	if l.typ == "" {
+		return typeEvent
+	}
+	return l.typ
+}
+
+// start starts an entry of l at level with the trace context of its context
+// and the goroutine id when it is enabled.
+func (l *Logger) start(level zerolog.Level) *zerolog.Event {
+	e := l.zl.WithLevel(level)
+	if l.c != nil {
+		if !addTrace(e, l.c.Request.Context()) {
+			e.Str(fieldTraceID, l.c.GetString("sw8"))
+		}
+		e.Str(fieldURL, l.c.Request.Method+"： "+l.c.Request.URL.Path)
+	} else if l.ctx != nil {
+		addTrace(e, l.ctx)
+	}
+	if goroutineID {
+		e.Uint64(fieldThreadID, getGID())
+	}
+	return e
+}
+
+// addTrace adds the IDs of the active span of ctx, in the fields of the logger
+// and in the SW_CTX field of the SkyWalking log format. The spans of the otlp
+// reporter only have a trace and a span ID. It reports whether ctx has a
+// sampled span.
+func addTrace(e *zerolog.Event, ctx context.Context) bool {
+	sc := go2sky.FromGoContext(ctx)
+	if sc.TraceID == go2sky.EmptyTraceID || sc.TraceID == go2sky.NoopTraceID {
+		if osc := trace.SpanContextFromContext(ctx); osc.IsSampled() {
+			e.Str(fieldTraceID, osc.TraceID().String()).Str(fieldSpanID, osc.SpanID().String())
+			return true
+		}
+		return false
+	}
+	e.Str(fieldTraceID, sc.TraceID).
+		Str(fieldSegmentID, sc.TraceSegmentID).
+		Int32(fieldSpanID, sc.SpanID).
+		Int32(fieldParentID, sc.ParentSpanID).
+		Str(fieldSWCtx, sc.String())
+	return true
+}
+
+// Detach returns a context keeping the logger and the active span of ctx but
+// not its cancellation, for the goroutines outliving the request that spawned
+// them.
+func Detach(ctx context.Context) context.Context {
+	return detached{ctx}
+}
+
+type detached struct {
+	parent context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detached) Done() <-chan struct{} { return nil }
+
+func (detached) Err() error { return nil }
+
+func (d detached) Value(key interface{}) interface{} { return d.parent.Value(key) }
+
+// ginLogger returns the logger of the request c for the LogXxx functions.
+func ginLogger(c *gin.Context) Logger {
+	if c == nil || c.Request == nil {
+		return Logger{zl: base}
+	}
+	ctx := c.Request.Context()
+	if l, ok := ctx.Value(loggerKey{}).(*Logger); ok {
+		return Logger{zl: l.zl, ctx: ctx, typ: l.typ}
+	}
+	return Logger{zl: base, c: c}
+}
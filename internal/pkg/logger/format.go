@@ -0,0 +1,105 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+var errNotObject = errors.New("not a JSON object")
+
+// newFormatWriter returns a writer formatting the JSON entries in format to w:
+// json, text or logfmt. JSON is written as is, the other formats decode the
+// entries again.
+func newFormatWriter(format string, w io.Writer) io.Writer {
+	switch strings.ToLower(format) {
+	case "text":
+		return zerolog.ConsoleWriter{Out: w, NoColor: !isTerminal(w), TimeFormat: defaultTimestampFormat}
+	case "logfmt":
+		return &logfmtWriter{w: w}
+	default:
+		return w
+	}
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// logfmtWriter writes the fields of a JSON entry as key=value pairs, in the
+// order they were encoded.
+type logfmtWriter struct {
+	w io.Writer
+}
+
+func (l *logfmtWriter) Write(p []byte) (int, error) {
+	var buf bytes.Buffer
+	if err := writeLogfmt(&buf, p); err != nil {
+		// not an object, write it unchanged
+		return l.w.Write(p)
+	}
+	if _, err := l.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func writeLogfmt(buf *bytes.Buffer, p []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return errNotObject
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(key.(string))
+		buf.WriteByte('=')
+		writeLogfmtValue(buf, value)
+	}
+	buf.WriteByte('\n')
+	return nil
+}
+
+// writeLogfmtValue writes strings unquoted unless they contain spaces,
+// quotes or equal signs, objects and arrays as quoted JSON and other values as
+// is.
+func writeLogfmtValue(buf *bytes.Buffer, value json.RawMessage) {
+	switch value[0] {
+	case '"':
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			buf.Write(value)
+			return
+		}
+		if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+			buf.WriteString(strconv.Quote(s))
+			return
+		}
+		buf.WriteString(s)
+	case '{', '[':
+		buf.WriteString(strconv.Quote(string(value)))
+	default:
+		buf.Write(value)
+	}
+}
@@ -0,0 +1,214 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// levelSet is the minimum level of the logs, with overrides per category.
+type levelSet struct {
+	base    zerolog.Level
+	modules map[string]zerolog.Level
+}
+
+// levelNames are the accepted level names, warning is kept from logrus.
+var levelNames = map[string]zerolog.Level{
+	"trace":   zerolog.TraceLevel,
+	"debug":   zerolog.DebugLevel,
+	"info":    zerolog.InfoLevel,
+	"warn":    zerolog.WarnLevel,
+	"warning": zerolog.WarnLevel,
+	"error":   zerolog.ErrorLevel,
+	"fatal":   zerolog.FatalLevel,
+	"panic":   zerolog.PanicLevel,
+}
+
+func parseLevel(level string) (zerolog.Level, error) {
+	if lvl, ok := levelNames[strings.ToLower(level)]; ok {
+		return lvl, nil
+	}
+	return zerolog.NoLevel, fmt.Errorf("not a valid log level: %q", level)
+}
+
+func parseLevels(base string, modules map[string]string) (*levelSet, error) {
+	lvl, err := parseLevel(base)
+	if err != nil {
+		return nil, err
+	}
+	set := &levelSet{base: lvl, modules: make(map[string]zerolog.Level, len(modules))}
+	for name, level := range modules {
+		if _, ok := logNameList[name]; !ok && name != LogNameDefault {
+			return nil, fmt.Errorf("unknown log category %q", name)
+		}
+		lvl, err := parseLevel(level)
+		if err != nil {
+			return nil, fmt.Errorf("log category %s: %w", name, err)
+		}
+		set.modules[name] = lvl
+	}
+	return set, nil
+}
+
+func (s *levelSet) enabled(logName string, level zerolog.Level) bool {
+	lvl, ok := s.modules[getLogName(logName)]
+	if !ok {
+		lvl = s.base
+	}
+	return level >= lvl
+}
+
+// merge returns a copy of s with the levels of o, an unset base keeps the
+// base of s.
+func (s *levelSet) merge(o *levelSet, keepBase bool) *levelSet {
+	merged := &levelSet{base: o.base, modules: make(map[string]zerolog.Level, len(s.modules)+len(o.modules))}
+	if keepBase {
+		merged.base = s.base
+	}
+	for name, lvl := range s.modules {
+		merged.modules[name] = lvl
+	}
+	for name, lvl := range o.modules {
+		merged.modules[name] = lvl
+	}
+	return merged
+}
+
+func (s *levelSet) strings() (string, map[string]string) {
+	modules := make(map[string]string, len(s.modules))
+	for name, lvl := range s.modules {
+		modules[name] = lvl.String()
+	}
+	return s.base.String(), modules
+}
+
+// Levels describes the effective log levels.
+type Levels struct {
+	Level   string            `json:"level"`
+	Modules map[string]string `json:"modules"`
+	// RevertAt is when the levels set with OverrideLevels are reverted to the
+	// configured ones, nil when the configured levels are in effect.
+	RevertAt *time.Time `json:"revertAt,omitempty"`
+}
+
+var levels struct {
+	mu         sync.Mutex
+	configured *levelSet
+	overridden bool
+	revertAt   time.Time
+	timer      *time.Timer
+	// generation counts the overrides and reverts, the timer of an override
+	// only reverts it while it is the latest one.
+	generation uint64
+
+	effective atomic.Value // *levelSet
+}
+
+func init() {
+	set := &levelSet{base: zerolog.TraceLevel}
+	levels.configured = set
+	levels.effective.Store(set)
+}
+
+// enabled reports whether a log of the category logName at level is emitted.
+func enabled(logName string, level zerolog.Level) bool {
+	return levels.effective.Load().(*levelSet).enabled(logName, level)
+}
+
+// apply makes set the effective levels, the caller holds levels.mu.
+func apply(set *levelSet) {
+	levels.effective.Store(set)
+}
+
+// SetLevels sets the configured minimum level and the levels of the
+// categories named in modules, keyed by the LogName constants. They take
+// effect once a temporary override is reverted.
+func SetLevels(level string, modules map[string]string) error {
+	set, err := parseLevels(level, modules)
+	if err != nil {
+		return err
+	}
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	levels.configured = set
+	if !levels.overridden {
+		apply(set)
+	}
+	return nil
+}
+
+// OverrideLevels temporarily changes the levels, on top of the configured
+// ones, and reverts them after d. An empty level keeps the configured minimum
+// level.
+func OverrideLevels(level string, modules map[string]string, d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("revert timeout must be positive, got %s", d)
+	}
+	keepBase := level == ""
+	if keepBase {
+		level = zerolog.TraceLevel.String()
+	}
+	set, err := parseLevels(level, modules)
+	if err != nil {
+		return err
+	}
+
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	if levels.timer != nil {
+		levels.timer.Stop()
+	}
+	levels.generation++
+	generation := levels.generation
+	levels.overridden = true
+	levels.revertAt = time.Now().Add(d)
+	levels.timer = time.AfterFunc(d, func() { expire(generation) })
+	apply(levels.configured.merge(set, keepBase))
+	return nil
+}
+
+// expire reverts the override generation once its timeout is over. The timer
+// may fire while a new override waits on levels.mu, Stop does not prevent the
+// call then, so a replaced or reverted override is left alone.
+func expire(generation uint64) {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	if generation == levels.generation {
+		revert()
+	}
+}
+
+// RevertLevels restores the configured levels.
+func RevertLevels() {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	revert()
+}
+
+// revert restores the configured levels, the caller holds levels.mu.
+func revert() {
+	if levels.timer != nil {
+		levels.timer.Stop()
+		levels.timer = nil
+	}
+	levels.generation++
+	levels.overridden = false
+	apply(levels.configured)
+}
+
+// GetLevels returns the effective levels.
+func GetLevels() Levels {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+	level, modules := levels.effective.Load().(*levelSet).strings()
+	l := Levels{Level: level, Modules: modules}
+	if levels.overridden {
+		revertAt := levels.revertAt
+		l.RevertAt = &revertAt
+	}
+	return l
+}
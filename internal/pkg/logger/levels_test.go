@@ -0,0 +1,192 @@
+package logger
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/767829413/normal-frame/internal/pkg/options"
+	"github.com/rs/zerolog"
+)
+
+// resetLevels restores the default levels when the test ends.
+func resetLevels(t *testing.T) {
+	t.Cleanup(func() {
+		RevertLevels()
+		_ = SetLevels(zerolog.TraceLevel.String(), nil)
+	})
+}
+
+func TestLogModulesMatchCategories(t *testing.T) {
+	categories := []string{LogNameDefault}
+	for name := range logNameList {
+		categories = append(categories, name)
+	}
+	modules := append([]string(nil), options.LogModules...)
+	sort.Strings(categories)
+	sort.Strings(modules)
+	if strings.Join(categories, ",") != strings.Join(modules, ",") {
+		t.Errorf("options.LogModules = %v, want the log categories %v", modules, categories)
+	}
+}
+
+func TestSetLevels(t *testing.T) {
+	resetLevels(t)
+	if err := SetLevels("warning", map[string]string{LogNameMysql: "debug", LogNameDefault: "error"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		logName string
+		level   zerolog.Level
+		want    bool
+	}{
+		{LogNameAPI, zerolog.InfoLevel, false},
+		{LogNameAPI, zerolog.WarnLevel, true},
+		{LogNameMysql, zerolog.DebugLevel, true},
+		{LogNameMysql, zerolog.TraceLevel, false},
+		// unknown names log as the default category
+		{"", zerolog.WarnLevel, false},
+		{"unknown", zerolog.ErrorLevel, true},
+	} {
+		if got := enabled(tt.logName, tt.level); got != tt.want {
+			t.Errorf("enabled(%q, %s) = %v, want %v", tt.logName, tt.level, got, tt.want)
+		}
+	}
+
+	for _, modules := range []map[string]string{{"mysq": "debug"}, {LogNameMysql: "verbose"}} {
+		if err := SetLevels("info", modules); err == nil {
+			t.Errorf("SetLevels accepted modules %v", modules)
+		}
+	}
+	if err := SetLevels("verbose", nil); err == nil {
+		t.Error("SetLevels accepted an unknown level")
+	}
+	if got := GetLevels(); got.Level != "warning" || got.Modules[LogNameMysql] != "debug" {
+		t.Errorf("levels = %+v, want the levels kept after errors", got)
+	}
+}
+
+func TestOverrideLevels(t *testing.T) {
+	resetLevels(t)
+	if err := SetLevels("info", map[string]string{LogNameMysql: "warn", LogNameRedis: "error"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// an empty level keeps the configured one, the modules are merged
+	if err := OverrideLevels("", map[string]string{LogNameRedis: "debug", LogNameAPI: "trace"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	got := GetLevels()
+	want := map[string]string{LogNameMysql: "warning", LogNameRedis: "debug", LogNameAPI: "trace"}
+	if got.Level != "info" || len(got.Modules) != len(want) {
+		t.Errorf("levels = %+v, want info and %v", got, want)
+	}
+	for name, level := range want {
+		if got.Modules[name] != level {
+			t.Errorf("level of %s = %q, want %q", name, got.Modules[name], level)
+		}
+	}
+	if got.RevertAt == nil || time.Until(*got.RevertAt) < 59*time.Minute {
+		t.Errorf("revert at %v, want in an hour", got.RevertAt)
+	}
+
+	if err := OverrideLevels("error", nil, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got := GetLevels(); got.Level != "error" || got.Modules[LogNameRedis] != "error" {
+		t.Errorf("levels = %+v, want the override applied on the configured levels only", got)
+	}
+
+	// a reload during the override takes effect once it is reverted
+	if err := SetLevels("debug", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := GetLevels(); got.Level != "error" {
+		t.Errorf("level = %q during the override, want error", got.Level)
+	}
+	RevertLevels()
+	if got := GetLevels(); got.Level != "debug" || len(got.Modules) != 0 || got.RevertAt != nil {
+		t.Errorf("levels = %+v after the revert, want the reloaded ones", got)
+	}
+
+	for _, d := range []time.Duration{0, -time.Second} {
+		if err := OverrideLevels("debug", nil, d); err == nil {
+			t.Errorf("OverrideLevels accepted the duration %s", d)
+		}
+	}
+	if err := OverrideLevels("", map[string]string{"mysq": "debug"}, time.Hour); err == nil {
+		t.Error("OverrideLevels accepted an unknown category")
+	}
+	if got := GetLevels(); got.RevertAt != nil {
+		t.Errorf("levels = %+v, a rejected override is applied", got)
+	}
+}
+
+func TestOverrideLevelsReverts(t *testing.T) {
+	resetLevels(t)
+	if err := SetLevels("info", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := OverrideLevels("debug", nil, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// a new override replaces the timer of the previous one
+	if err := OverrideLevels("trace", nil, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if !enabled(LogNameAPI, zerolog.TraceLevel) {
+		t.Error("trace logs are disabled during the override")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for GetLevels().RevertAt != nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := GetLevels(); got.Level != "info" || got.RevertAt != nil {
+		t.Errorf("levels = %+v, want the configured ones back", got)
+	}
+	if enabled(LogNameAPI, zerolog.DebugLevel) {
+		t.Error("debug logs are enabled after the revert")
+	}
+}
+
+func TestOverrideLevelsAtExpiry(t *testing.T) {
+	resetLevels(t)
+	if err := SetLevels("info", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := OverrideLevels("debug", nil, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	levels.mu.Lock()
+	expired := levels.generation
+	levels.mu.Unlock()
+
+	// the timer of the first override fires while the second one holds the
+	// lock, it runs once the second override is applied
+	if err := OverrideLevels("trace", nil, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	expire(expired)
+	if got := GetLevels(); got.Level != "trace" || got.RevertAt == nil {
+		t.Errorf("levels = %+v, want the second override kept", got)
+	}
+
+	// nor does it undo an override made after a revert
+	RevertLevels()
+	if err := OverrideLevels("debug", nil, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	levels.mu.Lock()
+	current := levels.generation
+	levels.mu.Unlock()
+	expire(current - 1)
+	if got := GetLevels(); got.Level != "debug" || got.RevertAt == nil {
+		t.Errorf("levels = %+v, want the override kept after a stale expiry", got)
+	}
+	expire(current)
+	if got := GetLevels(); got.Level != "info" || got.RevertAt != nil {
+		t.Errorf("levels = %+v, want the override reverted once it expires", got)
+	}
+}
@@ -2,21 +2,17 @@ package logger
 
 import (
 	"bytes"
-	"fmt"
-	"io/ioutil"
 	"log"
 	"net"
 	"os"
 	"runtime"
 	"strconv"
 	"strings"
-	"time"
-
-	logredis "github.com/767829413/normal-frame/fork/logrus-redis-hook"
 
 	"github.com/767829413/normal-frame/internal/pkg/options"
+	"github.com/767829413/normal-frame/pkg/version"
 	"github.com/gin-gonic/gin"
-	"github.com/sirupsen/logrus"
+	"github.com/rs/zerolog"
 )
 
 const defaultTimestampFormat = "2006-01-02T15:04:05.000-0700"
@@ -55,11 +51,20 @@ const (
 	fieldTraceID       = "traceID"       // 全链路TraceId
 	fieldSpanID        = "spanID"        // 全链路SpanId :在非span产生的上下文环境中，可以留空
 	fieldParentID      = "parentID"      // 全链路 上级SpanId :在非span产生的上下文环境中，可以留空
+	fieldSegmentID     = "segmentID"     // 全链路SegmentId
+	fieldSWCtx         = "SW_CTX"        // SkyWalking日志格式 [service,instance,traceId,segmentId,spanId]
 	fieldCustomLog1    = "customLog1"    // 自定义log1
 	fieldCustomLog2    = "customLog2"    // 自定义log2
 	fieldCustomLog3    = "customLog3"    // 自定义log3
 )
 
+// fieldType 的取值
+const (
+	typeAccess = "ACCESS" // 请求访问日志
+	typeEvent  = "EVENT"  // 业务、组件及后台任务日志
+	typeRPC    = "RPC"    // gRPC调用中的日志
+)
+
 const (
 	LogNameDefault = "default"
 	LogNameRedis   = "redis"
@@ -74,6 +79,7 @@ const (
 	LogNameLogic   = "logic"
 	LogNameFile    = "file"
 	LogNameNet     = "net"
+	LogNameHTTP    = "http"
 )
 
 var (
@@ -90,74 +96,63 @@ var (
 		LogNameLogic:   LogNameLogic,
 		LogNameFile:    LogNameFile,
 		LogNameNet:     LogNameNet,
+		LogNameHTTP:    LogNameHTTP,
 	}
-	fields logrus.Fields
+
+	// base 带有静态字段的logger, 每条日志由它创建
+	base = zerolog.New(os.Stderr).With().Timestamp().Logger()
+	// callerLevel 从该等级开始记录调用位置
+	callerLevel = zerolog.ErrorLevel
+	// goroutineID 是否记录协程ID
+	goroutineID = false
 )
 
-type appHook struct {
-}
+// Fields are the extra fields of an entry logged with LogInfoCustom.
+type Fields = map[string]interface{}
 
-func (hook *appHook) Fire(entry *logrus.Entry) error {
-	entry.Data[fieldTime] = time.Now().Format(defaultTimestampFormat)
-	entry.Data[fieldThreadID] = getGID()
-	return nil
-}
-
-func (hook *appHook) Levels() []logrus.Level {
-	return logrus.AllLevels
+func init() {
+	zerolog.TimestampFieldName = fieldTime
+	zerolog.LevelFieldName = fieldLevel
+	zerolog.MessageFieldName = fieldMessage
+	zerolog.TimeFieldFormat = defaultTimestampFormat
+	// logrus的写法, 日志收集按它过滤
+	zerolog.LevelWarnValue = "warning"
 }
 
 // Init 初始化logger
 func Init(opt *options.LogsOptions) {
-	appName := os.Getenv("IDG_SERVICE_NAME")
-	appID := os.Getenv("IDG_APPID")
-	appVer := os.Getenv("IDG_VERSION")
-
-	// 设置日志格式为json格式
-	formatter := &logrus.JSONFormatter{
-		DisableTimestamp: true,
-		FieldMap: logrus.FieldMap{
-			logrus.FieldKeyMsg: fieldMessage,
-		},
-	}
-	logrus.SetFormatter(formatter)
 	// 设置日志等级
-	logrus.SetLevel(logrus.TraceLevel)
-	logrus.AddHook(&appHook{})
-	if strings.ToLower(opt.OutPut) == "stdout" {
-		// 如果指定设置stdout则输出到终端,否则输出到msp redis
-		logrus.SetOutput(os.Stdout)
-	} else {
-		flag, redisHost, redisPort := getMspLogRedis()
-		if flag {
-			logrus.SetOutput(ioutil.Discard)
-			hookConfig := logredis.HookConfig{
-				Host:   redisHost,
-				Key:    "service_" + appID,
-				Format: "origin",
-				Port:   redisPort,
-			}
-			hook, err := logredis.NewHook(hookConfig)
-			if err == nil {
-				logrus.AddHook(hook)
-			} else {
-				log.Printf("logredis error: %q", err)
-			}
-		} else {
-			// 获取redis host失败则输出到终端
-			logrus.SetOutput(os.Stdout)
-		}
+	if err := SetLevels(opt.Level, opt.Modules); err != nil {
+		log.Printf("logger: %v, fall back to trace level", err)
+		_ = SetLevels(zerolog.TraceLevel.String(), nil)
+	}
+	switch strings.ToLower(opt.Caller) {
+	case options.LogCallerNone:
+		callerLevel = zerolog.Disabled
+	case options.LogCallerAll:
+		callerLevel = zerolog.TraceLevel
+	default:
+		callerLevel = zerolog.ErrorLevel
 	}
+	goroutineID = opt.GoroutineID
 
-	fields = logrus.Fields{
-		fieldAppName:       appName,
-		fieldAppID:         appID,
+	// 按配置输出到终端、文件或msp redis, 静态字段只编码一次
+	base = zerolog.New(openOutputs(opt)).With().Fields(staticFields(opt)).Timestamp().Logger()
+}
+
+// staticFields returns the fields added to every entry.
+func staticFields(opt *options.LogsOptions) Fields {
+	appVer := os.Getenv("IDG_VERSION")
+	if appVer == "" {
+		appVer = version.Get().GitVersion
+	}
+	return Fields{
+		fieldAppName:       opt.ServiceName,
+		fieldAppID:         opt.AppID,
 		fieldAppVersion:    appVer,
 		fieldAppKey:        "appkey",
 		fieldChannel:       "1",
 		fieldSubOrgKey:     "sub_org_key",
-		fieldTime:          "",
-		fieldLevel:         "",
 		fieldHostName:      getHostname(),
 		fieldIP:            getInternetIP(),
 		fieldPodName:       os.Getenv("PODNAME"),
@@ -170,21 +165,8 @@ func Init(opt *options.LogsOptions) {
 		fieldUniqueID:      os.Getenv("IDG_UNIQUEID"),
 		fieldSiteUID:       os.Getenv("IDG_SITEUID"),
 		fieldRunEnvType:    os.Getenv("IDG_RUNTIME"),
-		fieldMessage:       "",
-		fieldLogger:        "",
-		fieldType:          "ACCESS",
-		fieldTitle:         "",
 		fieldPID:           os.Getpid(),
 		fieldLanguage:      "ch",
-		fieldURL:           "",
-		fieldClientIP:      "",
-		fieldErrCode:       "",
-		fieldTraceID:       "",
-		fieldSpanID:        "",
-		fieldParentID:      "",
-		fieldCustomLog1:    "",
-		fieldCustomLog2:    "",
-		fieldCustomLog3:    "",
 	}
 }
 
@@ -196,79 +178,85 @@ func getLogName(logName string) string {
 	}
 }
 
+// newEvent starts an entry at level with the fields of the request c, the
+// caller and the goroutine id when they are enabled.
+func newEvent(c *gin.Context, level zerolog.Level) *zerolog.Event {
+	l := ginLogger(c)
+	e := l.start(level).Str(fieldType, l.entryType())
+	if level >= callerLevel {
+		e.Str(fieldLogger, traceFunc())
+	}
+	return e
+}
+
 func LogDebugw(c *gin.Context, logName string, msg string) {
-	logrus.
-		// WithFields(fields).
-		WithFields(getFields(c)).
-		Debug(fmt.Sprintf("%s : %s", getLogName(logName), msg))
+	if !enabled(logName, zerolog.DebugLevel) {
+		return
+	}
+	newEvent(c, zerolog.DebugLevel).Msg(getLogName(logName) + " : " + msg)
 }
 
 func LogDebugf(c *gin.Context, logName string, template string, args ...interface{}) {
-	logrus.
-		// WithFields(fields).
-		WithFields(getFields(c)).
-		Debugf(getLogName(logName)+":"+template, args...)
+	if !enabled(logName, zerolog.DebugLevel) {
+		return
+	}
+	newEvent(c, zerolog.DebugLevel).Msgf(getLogName(logName)+":"+template, args...)
 }
 
 func LogInfow(c *gin.Context, logName string, msg string) {
-	logrus.
-		// WithFields(fields).
-		WithFields(getFields(c)).
-		WithFields(getFields(c)).
-		Info(fmt.Sprintf("%s : %s", getLogName(logName), msg))
+	if !enabled(logName, zerolog.InfoLevel) {
+		return
+	}
+	newEvent(c, zerolog.InfoLevel).Msg(getLogName(logName) + " : " + msg)
 }
 
 func LogInfof(c *gin.Context, logName string, template string, args ...interface{}) {
-	logrus.
-		// WithFields(fields).
-		WithFields(getFields(c)).
-		Infof(getLogName(logName)+":"+template, args...)
+	if !enabled(logName, zerolog.InfoLevel) {
+		return
+	}
+	newEvent(c, zerolog.InfoLevel).Msgf(getLogName(logName)+":"+template, args...)
 }
 
 func LogWarnw(c *gin.Context, logName string, msg string) {
-	logrus.
-		// WithFields(fields).
-		WithFields(getFields(c)).
-		Warn(fmt.Sprintf("%s : %s", getLogName(logName), msg))
+	if !enabled(logName, zerolog.WarnLevel) {
+		return
+	}
+	newEvent(c, zerolog.WarnLevel).Msg(getLogName(logName) + " : " + msg)
 }
 
 func LogWarnf(c *gin.Context, logName string, template string, args ...interface{}) {
-	logrus.
-		// WithFields(fields).
-		WithFields(getFields(c)).
-		Warnf(getLogName(logName)+":"+template, args...)
+	if !enabled(logName, zerolog.WarnLevel) {
+		return
+	}
+	newEvent(c, zerolog.WarnLevel).Msgf(getLogName(logName)+":"+template, args...)
 }
 
 func LogError(c *gin.Context, logName string, msg string) {
-	logrus.
-		// WithFields(fields).
-		WithFields(getFields(c)).
-		WithField(fieldLogger, traceFunc()).
-		Error(fmt.Sprintf("%s : %s", getLogName(logName), msg))
+	if !enabled(logName, zerolog.ErrorLevel) {
+		return
+	}
+	newEvent(c, zerolog.ErrorLevel).Msg(getLogName(logName) + " : " + msg)
 }
 
 func LogErrorw(c *gin.Context, logName string, msg string, err error) {
-	logrus.
-		// WithFields(fields).
-		WithFields(getFields(c)).
-		WithField(fieldLogger, traceFunc()).
-		Error(fmt.Sprintf("%s : %s, %s", getLogName(logName), msg, err.Error()))
+	if !enabled(logName, zerolog.ErrorLevel) {
+		return
+	}
+	newEvent(c, zerolog.ErrorLevel).Msg(getLogName(logName) + " : " + msg + ", " + err.Error())
 }
 
 func LogErrorf(c *gin.Context, logName string, template string, args ...interface{}) {
-	logrus.
-		// WithFields(fields).
-		WithFields(getFields(c)).
-		WithField(fieldLogger, traceFunc()).
-		Errorf(getLogName(logName)+":"+template, args...)
+	if !enabled(logName, zerolog.ErrorLevel) {
+		return
+	}
+	newEvent(c, zerolog.ErrorLevel).Msgf(getLogName(logName)+":"+template, args...)
 }
 
-func LogInfoCustom(c *gin.Context, logName string, fields logrus.Fields, msg string) {
-	logrus.
-		// WithFields(fields).
-		WithFields(getFields(c)).
-		WithFields(getFields(c)).
-		WithFields(fields).Info(fmt.Sprintf("%s : %s", getLogName(logName), msg))
+func LogInfoCustom(c *gin.Context, logName string, fields Fields, msg string) {
+	if !enabled(logName, zerolog.InfoLevel) {
+		return
+	}
+	newEvent(c, zerolog.InfoLevel).Fields(fields).Msg(getLogName(logName) + " : " + msg)
 }
 
 // getInternetIP 用于自动查找本机IP地址
@@ -301,35 +289,37 @@ func getHostname() (hostname string) {
 	return
 }
 
+var goroutinePrefix = []byte("goroutine ")
+
 // 获取协程ID
 func getGID() uint64 {
-	b := make([]byte, 64)
-	b = b[:runtime.Stack(b, false)]
-	b = bytes.TrimPrefix(b, []byte("goroutine "))
-	b = b[:bytes.IndexByte(b, ' ')]
-	n, _ := strconv.ParseUint(string(b), 10, 64)
+	var buf [64]byte
+	b := bytes.TrimPrefix(buf[:runtime.Stack(buf[:], false)], goroutinePrefix)
+	var n uint64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			break
+		}
+		n = n*10 + uint64(c-'0')
+	}
 	return n
 }
 
+// traceFunc 返回调用LogXxx的位置
 func traceFunc() string {
-	pc := make([]uintptr, 15)
-	n := runtime.Callers(3, pc)
-	frames := runtime.CallersFrames(pc[:n])
-	frame, _ := frames.Next()
-	return fmt.Sprintf("%s: %d %s", frame.File, frame.Line, frame.Function)
-}
-
-func getFields(c *gin.Context) logrus.Fields {
-	fields := logrus.Fields{}
-	if c != nil {
-		fields[fieldTraceID] = c.GetString("sw8")
-		fields[fieldURL] = c.Request.Method + "： " + c.Request.URL.Path
+	// 0: traceFunc, 1: newEvent or Logger.event, 2: LogXxx or a Logger method
+	pc, file, line, ok := runtime.Caller(3)
+	if !ok {
+		return ""
+	}
+	name := ""
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		name = fn.Name()
 	}
-	return fields
+	return file + ": " + strconv.Itoa(line) + " " + name
 }
 
-func getMspLogRedis() (flag bool, host string, port int) {
-	str := os.Getenv("MSP_LOG_REDIS_HOST")
+func getMspLogRedis(str string) (flag bool, host string, port int) {
 	strArr := strings.Split(str, ":")
 	if len(strArr) != 2 {
 		return
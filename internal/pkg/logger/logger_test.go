@@ -0,0 +1,487 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky"
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter/grpc/common"
+	logv3 "github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter/grpc/logging"
+	"github.com/767829413/normal-frame/internal/pkg/config"
+	"github.com/767829413/normal-frame/internal/pkg/options"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+)
+
+// setup makes the logger write to w, as Init does with the default options.
+func setup(tb testing.TB, w io.Writer, level string) *gin.Context {
+	tb.Helper()
+	opt := options.NewLogsOptions()
+	if err := SetLevels(level, nil); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(RevertLevels)
+	callerLevel = zerolog.ErrorLevel
+	goroutineID = false
+	base = zerolog.New(&levelWriter{w: w, level: zerolog.TraceLevel}).With().Fields(staticFields(opt)).Timestamp().Logger()
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/v1/users", nil)
+	c.Set("sw8", "trace-id")
+	return c
+}
+
+func TestLogFields(t *testing.T) {
+	var buf bytes.Buffer
+	c := setup(t, &buf, "info")
+
+	LogWarnf(c, LogNameAPI, "user %d", 1)
+	LogErrorw(nil, LogNameRedis, "get failed", errors.New("refused"))
+	LogDebugw(nil, LogNameAPI, "dropped")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d entries, want 2:\n%s", len(lines), buf.String())
+	}
+	var warn, fail map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &warn); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &fail); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]interface{}{
+		fieldLevel:   "warning",
+		fieldMessage: "api:user 1",
+		fieldTraceID: "trace-id",
+		fieldURL:     "GET： /v1/users",
+		fieldType:    typeEvent,
+	} {
+		if warn[key] != want {
+			t.Errorf("%s = %v, want %v", key, warn[key], want)
+		}
+	}
+	if _, ok := warn[fieldLogger]; ok {
+		t.Errorf("unexpected caller on a warning: %v", warn[fieldLogger])
+	}
+	if _, ok := warn[fieldTime]; !ok {
+		t.Errorf("missing %s", fieldTime)
+	}
+
+	if fail[fieldType] != typeEvent {
+		t.Errorf("type = %v, want %s", fail[fieldType], typeEvent)
+	}
+	if fail[fieldMessage] != "redis : get failed, refused" {
+		t.Errorf("message = %v", fail[fieldMessage])
+	}
+	if caller, _ := fail[fieldLogger].(string); !strings.Contains(caller, "logger_test.go") {
+		t.Errorf("caller = %q, want the test file", caller)
+	}
+}
+
+func decode(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	buf.Reset()
+	return entries
+}
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	setup(t, &buf, "info")
+
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/v1/users/:email", func(c *gin.Context) {
+		FromContext(c.Request.Context()).Named(LogNameMysql).With("rows", 1).Info("query")
+		LogInfow(c, LogNameAPI, "handled")
+		if id, want := RequestID(c), c.Writer.Header().Get(RequestIDHeader); id != want {
+			t.Errorf("RequestID = %q, want %q", id, want)
+		}
+	})
+	req := httptest.NewRequest("GET", "/v1/users/a@example.com", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get(RequestIDHeader); got != "req-1" {
+		t.Errorf("%s = %q, want req-1", RequestIDHeader, got)
+	}
+	entries := decode(t, &buf)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	for _, entry := range entries {
+		for key, want := range map[string]interface{}{
+			fieldRequestID: "req-1",
+			fieldRoute:     "/v1/users/:email",
+			fieldURL:       "GET： /v1/users/a@example.com",
+		} {
+			if entry[key] != want {
+				t.Errorf("%s = %v, want %v", key, entry[key], want)
+			}
+		}
+	}
+	if entries[0][fieldMessage] != "mysql : query" || entries[0]["rows"] != float64(1) {
+		t.Errorf("entry = %v", entries[0])
+	}
+
+	// the category levels apply to the context loggers
+	if err := SetLevels("info", map[string]string{LogNameMysql: "error"}); err != nil {
+		t.Fatal(err)
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/users/b@example.com", nil))
+	entries = decode(t, &buf)
+	if len(entries) != 1 || entries[0][fieldRequestID] == "" {
+		t.Errorf("entries = %v, want the api entry with a generated request ID", entries)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	var buf bytes.Buffer
+	setup(t, &buf, "info")
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/user.v1.User/Get"}
+	_, err := UnaryServerInterceptor()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		FromContext(ctx).Named(LogNameMysql).Info("query")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := decode(t, &buf)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	for key, want := range map[string]interface{}{
+		fieldType:  typeRPC,
+		fieldRoute: "/user.v1.User/Get",
+	} {
+		if entries[0][key] != want {
+			t.Errorf("%s = %v, want %v", key, entries[0][key], want)
+		}
+	}
+	if entries[0][fieldRequestID] == "" {
+		t.Error("missing request ID")
+	}
+}
+
+func TestJobContext(t *testing.T) {
+	var buf bytes.Buffer
+	setup(t, &buf, "info")
+
+	ctx := NewJobContext(context.Background(), "reload")
+	FromContext(ctx).Info("first")
+	FromContext(ctx).Info("second")
+	FromContext(NewJobContext(context.Background(), "reload")).Info("next run")
+
+	entries := decode(t, &buf)
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	if entries[0][fieldJob] != "reload" || entries[0][fieldRequestID] != entries[1][fieldRequestID] {
+		t.Errorf("entries of a run = %v, %v", entries[0], entries[1])
+	}
+	if entries[2][fieldRequestID] == entries[0][fieldRequestID] {
+		t.Errorf("runs share request ID %v", entries[0][fieldRequestID])
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	setup(t, &buf, "info")
+
+	r := gin.New()
+	r.Use(Middleware(), AccessLog(config.AccessLogConfig{
+		Enabled:          true,
+		SkipPaths:        []string{"/healthcheck", "/debug/*"},
+		SampleRate:       0,
+		Headers:          true,
+		Body:             true,
+		MaxBodySize:      64,
+		BodyContentTypes: []string{"application/json"},
+		RedactFields:     []string{"password", "items.*.token"},
+		RedactHeaders:    []string{"authorization"},
+	}))
+	r.POST("/v1/users", func(c *gin.Context) {
+		var body map[string]interface{}
+		if err := c.ShouldBindJSON(&body); err != nil || body["password"] != "p" {
+			t.Errorf("handler got %v, %v", body, err)
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"password": "p", "msg": "invalid"})
+	})
+	r.GET("/healthcheck", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+	r.GET("/debug/vars", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+	r.GET("/v1/users", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	req := httptest.NewRequest("POST", "/v1/users", strings.NewReader(`{"password":"p","items":[{"token":"t","n":1}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer t")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	for _, path := range []string{"/healthcheck", "/debug/vars", "/v1/users"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	entries := decode(t, &buf)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want the failed request only: %v", len(entries), entries)
+	}
+	entry := entries[0]
+	for key, want := range map[string]interface{}{
+		fieldLevel:        "warning",
+		fieldType:         typeAccess,
+		fieldMessage:      "api : POST /v1/users 400",
+		fieldMethod:       "POST",
+		fieldStatus:       float64(400),
+		fieldRoute:        "/v1/users",
+		fieldRequestBody:  `{"items":[{"n":1,"token":"***"}],"password":"***"}`,
+		fieldResponseBody: `{"msg":"invalid","password":"***"}`,
+	} {
+		if entry[key] != want {
+			t.Errorf("%s = %v, want %v", key, entry[key], want)
+		}
+	}
+	if headers, _ := entry[fieldHeaders].(map[string]interface{}); headers["Authorization"] != redacted {
+		t.Errorf("headers = %v", entry[fieldHeaders])
+	}
+
+	req = httptest.NewRequest("POST", "/v1/users", strings.NewReader(`{"password":"p","padding":"`+strings.Repeat("x", 64)+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	entries = decode(t, &buf)
+	if len(entries) != 1 || entries[0][fieldRequestBody] != "[larger than 64 bytes]" {
+		t.Errorf("entries = %v, want the large body left out", entries)
+	}
+}
+
+type discardReporter struct{}
+
+func (discardReporter) Boot(service string, serviceInstance string) {}
+func (discardReporter) Send(spans []go2sky.ReportedSpan)            {}
+func (discardReporter) Close()                                      {}
+
+func TestTraceContext(t *testing.T) {
+	var buf bytes.Buffer
+	setup(t, &buf, "info")
+	tracer, err := go2sky.NewTracer("svc", go2sky.WithReporter(discardReporter{}), go2sky.WithInstance("inst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, ctx, _, err := tracer.CreateEntrySpan(context.Background(), "/v1/users", func(string) (string, error) { return "", nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	FromContext(ctx).Info("entry")
+	local, localCtx, _, err := tracer.CreateLocalSpan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	FromContext(localCtx).Info("local")
+	local.End()
+	cancel()
+	entry.End()
+	done := make(chan struct{})
+	go func(ctx context.Context) {
+		defer close(done)
+		if ctx.Err() == nil {
+			FromContext(ctx).Info("detached")
+		}
+	}(Detach(ctx))
+	<-done
+
+	entries := decode(t, &buf)
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	sc := go2sky.FromGoContext(ctx)
+	if sc.TraceID == go2sky.EmptyTraceID || sc.TraceSegmentID == go2sky.EmptyTraceSegmentID {
+		t.Fatalf("context = %+v", sc)
+	}
+	for i, want := range []struct{ span, parent float64 }{{0, -1}, {1, 0}, {0, -1}} {
+		entry := entries[i]
+		if entry[fieldTraceID] != sc.TraceID || entry[fieldSegmentID] != sc.TraceSegmentID ||
+			entry[fieldSpanID] != want.span || entry[fieldParentID] != want.parent {
+			t.Errorf("entry %d = %v", i, entry)
+		}
+	}
+	wantCtx := "[svc,inst," + sc.TraceID + "," + sc.TraceSegmentID + ",1]"
+	if entries[1][fieldSWCtx] != wantCtx {
+		t.Errorf("%s = %v, want %s", fieldSWCtx, entries[1][fieldSWCtx], wantCtx)
+	}
+
+	// an unsampled request only has the noop span
+	noop, err := go2sky.NewTracer("svc", go2sky.WithReporter(discardReporter{}), go2sky.WithSampler(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ctx, _, _ = noop.CreateEntrySpan(context.Background(), "/v1/users", func(string) (string, error) { return "", nil })
+	FromContext(ctx).Info("unsampled")
+	if entries := decode(t, &buf); entries[0][fieldTraceID] != nil {
+		t.Errorf("unexpected trace fields: %v", entries[0])
+	}
+}
+
+func TestLogfmt(t *testing.T) {
+	var buf bytes.Buffer
+	w := newFormatWriter("logfmt", &buf)
+	if _, err := w.Write([]byte(`{"level":"info","message":"api : user created","n":1,"tags":["a"]}` + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	want := `level=info message="api : user created" n=1 tags="[\"a\"]"` + "\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func BenchmarkLogInfof(b *testing.B) {
+	c := setup(b, io.Discard, "info")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		LogInfof(c, LogNameAPI, "user %d created", i)
+	}
+}
+
+func BenchmarkLogInfow(b *testing.B) {
+	setup(b, io.Discard, "info")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		LogInfow(nil, LogNameMysql, "query executed")
+	}
+}
+
+func BenchmarkLogErrorw(b *testing.B) {
+	c := setup(b, io.Discard, "info")
+	err := errors.New("connection refused")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		LogErrorw(c, LogNameRedis, "get failed", err)
+	}
+}
+
+func BenchmarkLogDisabled(b *testing.B) {
+	setup(b, io.Discard, "info")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		LogDebugf(nil, LogNameAPI, "debug %d", i)
+	}
+}
+
+func BenchmarkLogGoroutineID(b *testing.B) {
+	setup(b, io.Discard, "info")
+	goroutineID = true
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		LogInfow(nil, LogNameMysql, "query executed")
+	}
+}
+
+// fakeCollector records the logs received by its LogReportService.
+type fakeCollector struct {
+	mu   sync.Mutex
+	logs []*logv3.LogData
+}
+
+func (c *fakeCollector) Collect(stream logv3.LogReportService_CollectServer) error {
+	for {
+		data, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&common.Commands{})
+		}
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.logs = append(c.logs, data)
+		c.mu.Unlock()
+	}
+}
+
+func TestSkywalkingOutput(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := &fakeCollector{}
+	s := grpc.NewServer()
+	logv3.RegisterLogReportServiceServer(s, collector)
+	go s.Serve(ln)
+	defer s.Stop()
+
+	setup(t, io.Discard, "info")
+	opt := options.NewLogsOptions()
+	opt.OutPut = []string{options.LogOutputSkywalking}
+	opt.ServiceName = "orders"
+	opt.Skywalking.Address = ln.Addr().String()
+	opt.Skywalking.Instance = "host-1"
+	base = zerolog.New(openOutputs(opt)).With().Fields(staticFields(opt)).Timestamp().Logger()
+	defer Close()
+
+	tracer, err := go2sky.NewTracer("svc", go2sky.WithReporter(discardReporter{}), go2sky.WithInstance("inst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	span, ctx, _, err := tracer.CreateEntrySpan(context.Background(), "/v1/orders/:id", func(string) (string, error) { return "", nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = NewContext(ctx, FromContext(ctx).With(fieldRoute, "/v1/orders/:id", "order", 7))
+	FromContext(ctx).Info("order paid")
+	span.End()
+	LogWarnw(nil, LogNameAPI, "slow")
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Flush(flushCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	if len(collector.logs) != 2 {
+		t.Fatalf("collected %d logs, want 2", len(collector.logs))
+	}
+	traced, untraced := collector.logs[0], collector.logs[1]
+	sc := go2sky.FromGoContext(ctx)
+	if traced.Service != "svc" || traced.ServiceInstance != "inst" || traced.Endpoint != "/v1/orders/:id" {
+		t.Errorf("traced log = %v", traced)
+	}
+	if tc := traced.TraceContext; tc == nil || tc.TraceId != sc.TraceID || tc.TraceSegmentId != sc.TraceSegmentID || tc.SpanId != 0 {
+		t.Errorf("trace context = %v, want %+v", traced.TraceContext, sc)
+	}
+	if text := traced.Body.GetText().GetText(); text != "default : order paid" {
+		t.Errorf("body = %q", text)
+	}
+	tags := map[string]string{}
+	for _, tag := range traced.Tags.Data {
+		tags[tag.Key] = tag.Value
+	}
+	if tags[fieldLevel] != "info" || tags["order"] != "7" || tags[fieldAppName] != "" || tags[fieldTraceID] != "" {
+		t.Errorf("tags = %v", tags)
+	}
+	if untraced.Service != "orders" || untraced.ServiceInstance != "host-1" || untraced.TraceContext != nil || untraced.Timestamp == 0 {
+		t.Errorf("untraced log = %v", untraced)
+	}
+}
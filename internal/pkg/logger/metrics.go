@@ -0,0 +1,59 @@
+package logger
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	registerOnce           sync.Once
+	registerSkywalkingOnce sync.Once
+)
+
+// registerMetrics exposes the counters of the redis output.
+func registerMetrics() {
+	registerOnce.Do(func() {
+		prometheus.MustRegister(
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "log_redis_queue_length",
+				Help: "Number of log entries waiting to be pushed to redis.",
+			}, func() float64 { return float64(redisStats().Queued) }),
+			redisCounter("sent", "pushed to redis", func() uint64 { return redisStats().Sent }),
+			redisCounter("dropped", "dropped because the redis queue was full", func() uint64 { return redisStats().Dropped }),
+			redisCounter("failed", "lost because redis kept failing", func() uint64 { return redisStats().Failed }),
+		)
+	})
+}
+
+func redisCounter(result, help string, value func() uint64) prometheus.CounterFunc {
+	return prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name:        "log_redis_entries_total",
+		Help:        "Number of log entries by result of the push to redis.",
+		ConstLabels: prometheus.Labels{"result": result},
+	}, func() float64 { return float64(value()) })
+}
+
+// registerSkywalkingMetrics exposes the counters of the skywalking output.
+func registerSkywalkingMetrics() {
+	registerSkywalkingOnce.Do(func() {
+		prometheus.MustRegister(
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "log_skywalking_queue_length",
+				Help: "Number of log entries waiting to be sent to SkyWalking.",
+			}, func() float64 { return float64(skywalkingStats().Queued) }),
+			skywalkingCounter("sent", func() uint64 { return skywalkingStats().Sent }),
+			skywalkingCounter("dropped", func() uint64 { return skywalkingStats().Dropped }),
+			skywalkingCounter("failed", func() uint64 { return skywalkingStats().Failed }),
+			skywalkingCounter("invalid", func() uint64 { return skywalkingStats().Invalid }),
+		)
+	})
+}
+
+func skywalkingCounter(result string, value func() uint64) prometheus.CounterFunc {
+	return prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name:        "log_skywalking_entries_total",
+		Help:        "Number of log entries by result of the send to SkyWalking.",
+		ConstLabels: prometheus.Labels{"result": result},
+	}, func() float64 { return float64(value()) })
+}
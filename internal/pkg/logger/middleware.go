@@ -0,0 +1,95 @@
+package logger
+
+import (
+	"context"
+	"net"
+
+	"github.com/767829413/normal-frame/pkg/certmanager"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// RequestIDHeader is the header carrying the request ID, it is read from the
+// request and echoed in the response.
+const RequestIDHeader = "X-Request-Id"
+
+// requestIDMetadata is RequestIDHeader in the gRPC metadata.
+const requestIDMetadata = "x-request-id"
+
+// Middleware attaches a logger to the request context carrying the request
+// ID, url, route, client IP and the verified client identity. It must run after
+// the middlewares setting the identity.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" {
+			requestID = NewRequestID()
+		}
+		c.Header(RequestIDHeader, requestID)
+
+		ctx := context.WithValue(c.Request.Context(), requestIDKey{}, requestID)
+		l := FromContext(ctx).With(
+			fieldRequestID, requestID,
+			fieldURL, c.Request.Method+"： "+c.Request.URL.Path,
+			fieldRoute, c.FullPath(),
+			fieldClientIP, c.ClientIP(),
+		)
+		if id, ok := certmanager.FromContext(ctx); ok {
+			l = l.With(fieldUser, id.Name())
+		}
+		c.Request = c.Request.WithContext(NewContext(ctx, l))
+		c.Next()
+	}
+}
+
+// UnaryServerInterceptor attaches a logger to the context of a gRPC call, as
+// Middleware does for HTTP requests. Its entries are of type RPC.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(grpcContext(ctx, info.FullMethod), req)
+	}
+}
+
+// StreamServerInterceptor attaches a logger to the context of a gRPC stream.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &loggerStream{ServerStream: ss, ctx: grpcContext(ss.Context(), info.FullMethod)})
+	}
+}
+
+func grpcContext(ctx context.Context, method string) context.Context {
+	var requestID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(requestIDMetadata); len(ids) > 0 {
+			requestID = ids[0]
+		}
+	}
+	if requestID == "" {
+		requestID = NewRequestID()
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, requestID))
+	ctx = context.WithValue(ctx, requestIDKey{}, requestID)
+
+	l := FromContext(ctx).With(fieldRequestID, requestID, fieldRoute, method)
+	l.typ = typeRPC
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			l = l.With(fieldClientIP, host)
+		}
+	}
+	if id, ok := certmanager.FromContext(ctx); ok {
+		l = l.With(fieldUser, id.Name())
+	}
+	return NewContext(ctx, l)
+}
+
+type loggerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *loggerStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,281 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter"
+	logredis "github.com/767829413/normal-frame/fork/logrus-redis-hook"
+	"github.com/767829413/normal-frame/internal/pkg/options"
+	apmreporter "github.com/767829413/normal-frame/pkg/apm/reporter"
+	"github.com/767829413/normal-frame/pkg/rotate"
+	"github.com/rs/zerolog"
+)
+
+// levelWriter writes the entries at level or above to w.
+type levelWriter struct {
+	w     io.Writer
+	level zerolog.Level
+}
+
+func (w *levelWriter) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
+func (w *levelWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if level < w.level {
+		return len(p), nil
+	}
+	return w.w.Write(p)
+}
+
+// closeTimeout bounds the time spent sending the queued entries on Close.
+const closeTimeout = 5 * time.Second
+
+var outputs struct {
+	mu         sync.Mutex
+	files      []*rotate.File
+	redis      *logredis.AsyncHook
+	skywalking *reporter.LogDataReporter
+	signal     chan os.Signal
+}
+
+// openOutputs returns a writer to the outputs of opt, each formatting the
+// entries in opt.Format but redis and skywalking which receive them as JSON. An
+// output that cannot be opened falls back to stdout.
+func openOutputs(opt *options.LogsOptions) zerolog.LevelWriter {
+	var writers []io.Writer
+	stdout := false
+	addStdout := func(level zerolog.Level) {
+		if !stdout {
+			stdout = true
+			writers = append(writers, &levelWriter{w: newFormatWriter(opt.Format, os.Stdout), level: level})
+		}
+	}
+	for _, output := range opt.OutPut {
+		output = strings.ToLower(output)
+		level := outputLevel(opt.OutputLevels[output])
+		switch output {
+		case options.LogOutputStdout:
+			addStdout(level)
+		case options.LogOutputFile:
+			f, err := rotate.New(opt.File.Path,
+				rotate.WithMaxSize(opt.File.MaxSize),
+				rotate.WithDaily(opt.File.Daily),
+				rotate.WithMaxBackups(opt.File.MaxBackups),
+				rotate.WithMaxAge(time.Duration(opt.File.MaxAge)*24*time.Hour),
+				rotate.WithCompress(opt.File.Compress),
+			)
+			if err != nil {
+				// 打开日志文件失败则输出到终端
+				log.Printf("logger: %v, fall back to stdout", err)
+				addStdout(level)
+				continue
+			}
+			writers = append(writers, &levelWriter{w: newFormatWriter(opt.Format, f), level: level})
+			outputs.mu.Lock()
+			outputs.files = append(outputs.files, f)
+			outputs.mu.Unlock()
+		case options.LogOutputRedis:
+			flag, redisHost, redisPort := getMspLogRedis(opt.RedisAddr)
+			if !flag {
+				// 获取redis host失败则输出到终端
+				addStdout(level)
+				continue
+			}
+			key := opt.Redis.Key
+			if key == "" {
+				key = "service_" + opt.AppID
+			}
+			hookConfig := logredis.HookConfig{
+				Host:          redisHost,
+				Port:          redisPort,
+				Password:      opt.Redis.Password,
+				DB:            opt.Redis.DB,
+				Key:           key,
+				TTL:           opt.Redis.TTL,
+				Format:        "origin",
+				WriteTimeout:  opt.Redis.Timeout,
+				QueueSize:     opt.Redis.QueueSize,
+				BatchSize:     opt.Redis.BatchSize,
+				FlushInterval: opt.Redis.FlushInterval,
+				BlockOnFull:   opt.Redis.Block,
+			}
+			hook, err := logredis.NewAsyncHook(hookConfig)
+			if err != nil {
+				log.Printf("logredis error: %q", err)
+				continue
+			}
+			writers = append(writers, &levelWriter{w: hook, level: level})
+			outputs.mu.Lock()
+			outputs.redis = hook
+			outputs.mu.Unlock()
+			registerMetrics()
+		case options.LogOutputSkywalking:
+			service := opt.Skywalking.Service
+			if service == "" {
+				service = opt.ServiceName
+			}
+			instance := opt.Skywalking.Instance
+			if instance == "" {
+				instance = getHostname()
+			}
+			w := newSkywalkingWriter(service, instance, staticFields(opt))
+			r, err := newSkywalkingReporter(opt.Skywalking, w.decode)
+			if err != nil {
+				log.Printf("logger: skywalking output: %v, fall back to stdout", err)
+				addStdout(level)
+				continue
+			}
+			w.r = r
+			writers = append(writers, &levelWriter{w: w, level: level})
+			outputs.mu.Lock()
+			outputs.skywalking = r
+			outputs.mu.Unlock()
+			registerSkywalkingMetrics()
+		}
+	}
+	reopenOnSignal()
+	return zerolog.MultiLevelWriter(writers...)
+}
+
+// newSkywalkingReporter creates the reporter of the skywalking output, it
+// connects in the background so the backend may be down. decode converts the
+// entries queued by the writer.
+func newSkywalkingReporter(opt *options.LogSkywalking, decode reporter.LogDecoder) (*reporter.LogDataReporter, error) {
+	var transport reporter.LogTransport
+	switch strings.ToLower(opt.Transport) {
+	case options.LogTransportSidecar:
+		transport = apmreporter.NewSidecarLogTransport(opt.Address)
+	default:
+		var grpcOpts []reporter.GRPCLogOption
+		if opt.Authentication != "" {
+			grpcOpts = append(grpcOpts, reporter.WithLogAuthentication(opt.Authentication))
+		}
+		grpcOpts = append(grpcOpts, reporter.WithLogTimeout(opt.Timeout))
+		var err error
+		if transport, err = reporter.NewGRPCLogTransport(opt.Address, grpcOpts...); err != nil {
+			return nil, err
+		}
+	}
+	return reporter.NewLogDataReporter(transport,
+		reporter.WithLogQueueSize(opt.QueueSize),
+		reporter.WithLogBatchSize(opt.BatchSize),
+		reporter.WithLogFlushInterval(opt.FlushInterval),
+		reporter.WithLogRetry(opt.MaxRetries, reporter.DefaultLogMinBackoff, reporter.DefaultLogMaxBackoff),
+		reporter.WithLogDecoder(decode),
+	), nil
+}
+
+// outputLevel parses the level of an output, an output without level receives
+// every entry.
+func outputLevel(level string) zerolog.Level {
+	if level == "" {
+		return zerolog.TraceLevel
+	}
+	lvl, err := parseLevel(level)
+	if err != nil {
+		log.Printf("logger: %v, fall back to trace level", err)
+		return zerolog.TraceLevel
+	}
+	return lvl
+}
+
+// reopenOnSignal reopens the log files on SIGHUP, after logrotate moved them.
+func reopenOnSignal() {
+	outputs.mu.Lock()
+	defer outputs.mu.Unlock()
+	if len(outputs.files) == 0 || outputs.signal != nil {
+		return
+	}
+	outputs.signal = make(chan os.Signal, 1)
+	signal.Notify(outputs.signal, syscall.SIGHUP)
+	go func(ch chan os.Signal) {
+		for range ch {
+			outputs.mu.Lock()
+			for _, f := range outputs.files {
+				if err := f.Reopen(); err != nil {
+					log.Printf("logger: reopen log file: %v", err)
+				}
+			}
+			outputs.mu.Unlock()
+		}
+	}(outputs.signal)
+}
+
+// Flush sends the entries queued for redis and skywalking.
+func Flush(ctx context.Context) error {
+	outputs.mu.Lock()
+	hook, sw := outputs.redis, outputs.skywalking
+	outputs.mu.Unlock()
+	var err error
+	if hook != nil {
+		err = hook.Flush(ctx)
+	}
+	if sw != nil {
+		if ferr := sw.Flush(ctx); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// Close flushes and closes the log outputs, the logs written afterwards are
+// lost.
+func Close() error {
+	outputs.mu.Lock()
+	defer outputs.mu.Unlock()
+	if outputs.signal != nil {
+		signal.Stop(outputs.signal)
+		close(outputs.signal)
+		outputs.signal = nil
+	}
+	var err error
+	if outputs.redis != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+		err = outputs.redis.Close(ctx)
+		cancel()
+	}
+	if outputs.skywalking != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+		if cerr := outputs.skywalking.Close(ctx); err == nil {
+			err = cerr
+		}
+		cancel()
+		outputs.skywalking = nil
+	}
+	for _, f := range outputs.files {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	outputs.files = nil
+	return err
+}
+
+// redisStats returns the counters of the redis output.
+func redisStats() logredis.Stats {
+	outputs.mu.Lock()
+	defer outputs.mu.Unlock()
+	if outputs.redis == nil {
+		return logredis.Stats{}
+	}
+	return outputs.redis.Stats()
+}
+
+// skywalkingStats returns the counters of the skywalking output.
+func skywalkingStats() reporter.LogReporterStats {
+	outputs.mu.Lock()
+	defer outputs.mu.Unlock()
+	if outputs.skywalking == nil {
+		return reporter.LogReporterStats{}
+	}
+	return outputs.skywalking.Stats()
+}
@@ -0,0 +1,122 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter"
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter/grpc/common"
+	logv3 "github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter/grpc/logging"
+	"github.com/rs/zerolog"
+)
+
+// skywalkingWriter queues the JSON entries of the logger on a reporter, which
+// converts them to SkyWalking logs with decode from its own goroutine. The
+// route of an entry is its endpoint, its level and the fields it does not
+// share with every entry are its tags.
+type skywalkingWriter struct {
+	r        *reporter.LogDataReporter
+	service  string
+	instance string
+	// skip are the fields left out of the tags, the static fields and those
+	// mapped to LogData fields.
+	skip map[string]struct{}
+}
+
+// newSkywalkingWriter returns a writer without reporter, r must be set to a
+// reporter decoding the entries with w.decode.
+func newSkywalkingWriter(service, instance string, static Fields) *skywalkingWriter {
+	w := &skywalkingWriter{service: service, instance: instance, skip: map[string]struct{}{}}
+	for key := range static {
+		w.skip[key] = struct{}{}
+	}
+	for _, key := range []string{fieldTime, fieldMessage, fieldRoute, fieldTraceID, fieldSegmentID, fieldSpanID, fieldParentID, fieldSWCtx} {
+		w.skip[key] = struct{}{}
+	}
+	return w
+}
+
+// Write queues a copy of the entry, it is decoded by the reporter so the
+// logging goroutine only pays for the copy.
+func (w *skywalkingWriter) Write(p []byte) (int, error) {
+	w.r.ReportRaw(p)
+	return len(p), nil
+}
+
+func (w *skywalkingWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	return w.Write(p)
+}
+
+// decode converts a JSON entry.
+func (w *skywalkingWriter) decode(p []byte) (*logv3.LogData, error) {
+	d := json.NewDecoder(bytes.NewReader(p))
+	d.UseNumber()
+	var entry map[string]interface{}
+	if err := d.Decode(&entry); err != nil {
+		return nil, err
+	}
+	return w.logData(entry), nil
+}
+
+// logData converts a decoded entry.
+func (w *skywalkingWriter) logData(entry map[string]interface{}) *logv3.LogData {
+	data := &logv3.LogData{
+		Timestamp:       time.Now().UnixNano() / int64(time.Millisecond),
+		Service:         w.service,
+		ServiceInstance: w.instance,
+		Endpoint:        stringField(entry, fieldRoute),
+		Body: &logv3.LogDataBody{
+			Type:    "text",
+			Content: &logv3.LogDataBody_Text{Text: &logv3.TextLog{Text: stringField(entry, fieldMessage)}},
+		},
+		Tags: &logv3.LogTags{},
+	}
+	if t, err := time.Parse(zerolog.TimeFieldFormat, stringField(entry, fieldTime)); err == nil {
+		data.Timestamp = t.UnixNano() / int64(time.Millisecond)
+	}
+
+	// 有链路的日志按链路的服务和实例上报, 以便在链路中查看
+	if segmentID := stringField(entry, fieldSegmentID); segmentID != "" {
+		spanID, _ := strconv.ParseInt(stringField(entry, fieldSpanID), 10, 32)
+		data.TraceContext = &logv3.TraceContext{
+			TraceId:        stringField(entry, fieldTraceID),
+			TraceSegmentId: segmentID,
+			SpanId:         int32(spanID),
+		}
+		if sw := strings.Split(strings.Trim(stringField(entry, fieldSWCtx), "[]"), ","); len(sw) == 5 {
+			data.Service, data.ServiceInstance = sw[0], sw[1]
+		}
+	}
+
+	keys := make([]string, 0, len(entry))
+	for key := range entry {
+		if _, ok := w.skip[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		data.Tags.Data = append(data.Tags.Data, &common.KeyStringValuePair{Key: key, Value: stringField(entry, key)})
+	}
+	return data
+}
+
+// stringField returns the field key of entry as a string, JSON encoded unless
+// it is a string or a number.
+func stringField(entry map[string]interface{}, key string) string {
+	switch v := entry[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		js, _ := json.Marshal(v)
+		return string(js)
+	}
+}
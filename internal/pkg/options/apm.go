@@ -1,32 +1,251 @@
 package options
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
+	cliflag "github.com/767829413/normal-frame/fork/component-base/cli/flag"
 	"github.com/spf13/pflag"
 )
 
+// Reporters accepted in ApmOptions.Reporter.
+const (
+	ApmReporterSidecar = "sidecar"
+	ApmReporterGRPC    = "grpc"
+	ApmReporterLog     = "log"
+	ApmReporterNoop    = "noop"
+	ApmReporterOTLP    = "otlp"
+)
+
+// Protocols accepted in ApmOTLP.Protocol.
+const (
+	ApmOTLPProtocolGRPC = "grpc"
+	ApmOTLPProtocolHTTP = "http"
+)
+
+// Sampling strategies accepted in ApmOptions.Sampler.
+const (
+	ApmSamplerConst         = "const"
+	ApmSamplerProbabilistic = "probabilistic"
+	ApmSamplerRateLimiting  = "rate-limiting"
+)
+
+// Trace context formats accepted in ApmOptions.Propagators.
+const (
+	ApmPropagatorSW8          = "sw8"
+	ApmPropagatorTraceContext = "tracecontext"
+	ApmPropagatorB3           = "b3"
+	ApmPropagatorB3Multi      = "b3multi"
+)
+
 type ApmOptions struct {
-	Enabled bool   `json:"enabled" mapstructure:"enabled" yaml:"enabled"`
-	Address string `mapstructure:"address" json:"address" yaml:"address"`
-	Http    bool   `mapstructure:"http" json:"http" yaml:"http"`
-	Mysql   bool   `mapstructure:"mysql" json:"mysql" yaml:"mysql"`
-	Redis   bool   `mapstructure:"redis" json:"redis" yaml:"redis"`
+	Enabled bool `json:"enabled" mapstructure:"enabled" yaml:"enabled"`
+	// Reporter sends the finished segments: sidecar to the unix socket
+	// Address, grpc to the OAP server at Address, log to stderr, and noop
+	// drops them but keeps the trace context of the logs. otlp exports the
+	// spans to the OpenTelemetry collector at Address instead of SkyWalking.
+	Reporter string `mapstructure:"reporter" json:"reporter" yaml:"reporter"`
+	Address  string `mapstructure:"address" json:"address" yaml:"address"`
+	// Authentication is the token of the OAP server, for the grpc reporter,
+	// or the Authorization header of the otlp exports.
+	Authentication string   `mapstructure:"authentication" json:"authentication" yaml:"authentication" secret:"true"`
+	TLS            *ApmTLS  `mapstructure:"tls" json:"tls" yaml:"tls"`
+	OTLP           *ApmOTLP `mapstructure:"otlp" json:"otlp" yaml:"otlp"`
+	// QueueSize is the number of segments waiting to be sent, the segments
+	// finished when the queue is full are dropped.
+	QueueSize int `mapstructure:"queue-size" json:"queue-size" yaml:"queue-size"`
+	// InstanceProperties are reported with the service instance on top of the
+	// build information, e.g. region: eu-west-1.
+	InstanceProperties map[string]string `mapstructure:"instance-properties" json:"instance-properties" yaml:"instance-properties"`
+	Http               bool              `mapstructure:"http" json:"http" yaml:"http"`
+	Mysql              bool              `mapstructure:"mysql" json:"mysql" yaml:"mysql"`
+	Redis              bool              `mapstructure:"redis" json:"redis" yaml:"redis"`
+	// Grpc traces the calls served by the gRPC server, see GrpcOptions.
+	Grpc bool `mapstructure:"grpc" json:"grpc" yaml:"grpc"`
+	// HttpClient traces the outgoing requests of pkg/httpclient.
+	HttpClient bool `mapstructure:"http-client" json:"http-client" yaml:"http-client"`
+	// Sampler is the sampling strategy of the new traces: const traces every
+	// request, probabilistic SampleRate of them and rate-limiting up to
+	// TracesPerSecond.
+	Sampler string `mapstructure:"sampler" json:"sampler" yaml:"sampler"`
+	// SampleRate is the fraction of requests traced, from 0 to 1.
+	SampleRate float64 `mapstructure:"sample-rate" json:"sample-rate" yaml:"sample-rate"`
+	// TracesPerSecond is the number of requests traced per second.
+	TracesPerSecond float64 `mapstructure:"traces-per-second" json:"traces-per-second" yaml:"traces-per-second"`
+	// AlwaysSample and NeverSample list the operations traced or not whatever
+	// the strategy, e.g. /GET/v1/users/:id or /proto.Service/*. A pattern ending
+	// with * matches its prefix.
+	AlwaysSample []string `mapstructure:"always-sample" json:"always-sample" yaml:"always-sample"`
+	NeverSample  []string `mapstructure:"never-sample" json:"never-sample" yaml:"never-sample"`
+	// Propagators are the formats of the trace context: the first one present
+	// in a request continues its trace, and the outgoing requests carry all of
+	// them.
+	Propagators []string `mapstructure:"propagators" json:"propagators" yaml:"propagators"`
+}
+
+// ApmTLS configures the TLS connection of the grpc and otlp reporters.
+type ApmTLS struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
+	// CAFile verifies the server certificate instead of the system roots.
+	CAFile             string `mapstructure:"ca-file" json:"ca-file" yaml:"ca-file"`
+	ServerName         string `mapstructure:"server-name" json:"server-name" yaml:"server-name"`
+	InsecureSkipVerify bool   `mapstructure:"insecure-skip-verify" json:"insecure-skip-verify" yaml:"insecure-skip-verify"`
+}
+
+// ApmOTLP configures the otlp reporter.
+type ApmOTLP struct {
+	// Protocol is grpc, or http to post the spans to /v1/traces.
+	Protocol string `mapstructure:"protocol" json:"protocol" yaml:"protocol"`
+	// Headers are sent with every export, e.g. X-Scope-OrgID: orders. The
+	// values are secrets, they may hold the token of the collector.
+	Headers map[string]string `mapstructure:"headers" json:"headers" yaml:"headers" secret:"true"`
+	// Timeout bounds an export, retries included.
+	Timeout time.Duration `mapstructure:"timeout" json:"timeout" yaml:"timeout"`
 }
 
 func NewApmOptions() *ApmOptions {
 	return &ApmOptions{
-		Enabled: true,
-		Address: "/sidecar/sky-agent.sock",
-		Http:    false,
-		Mysql:   false,
-		Redis:   false,
+		Enabled:        true,
+		Reporter:       ApmReporterSidecar,
+		Address:        "/sidecar/sky-agent.sock",
+		Authentication: "",
+		TLS: &ApmTLS{
+			Enabled:            false,
+			CAFile:             "",
+			ServerName:         "",
+			InsecureSkipVerify: false,
+		},
+		OTLP: &ApmOTLP{
+			Protocol: ApmOTLPProtocolGRPC,
+			Headers:  map[string]string{},
+			Timeout:  10 * time.Second,
+		},
+		QueueSize:          30000,
+		InstanceProperties: map[string]string{},
+		Http:               false,
+		Mysql:              false,
+		Redis:              false,
+		Grpc:               false,
+		HttpClient:         false,
+
+		Sampler:         ApmSamplerProbabilistic,
+		SampleRate:      1,
+		TracesPerSecond: 10,
+		AlwaysSample:    []string{},
+		NeverSample:     []string{},
+		Propagators:     []string{ApmPropagatorSW8},
 	}
 }
 
+// Validate checks the apm options and returns the problems found.
+func (o *ApmOptions) Validate() []error {
+	var errs []error
+	switch strings.ToLower(o.Reporter) {
+	case ApmReporterSidecar:
+		if o.Enabled && o.Address == "" {
+			errs = append(errs, fieldError("apm.address", "apm.address", "required when --apm.enabled is set"))
+		}
+	case ApmReporterGRPC:
+		if o.Enabled {
+			if msgs := isValidHostPort(o.Address); len(msgs) != 0 {
+				errs = append(errs, fieldError("apm.address", "apm.address", msgs...))
+			}
+		}
+	case ApmReporterOTLP:
+		if o.Enabled {
+			if msgs := isValidHostPort(o.Address); len(msgs) != 0 {
+				errs = append(errs, fieldError("apm.address", "apm.address", msgs...))
+			}
+		}
+		switch strings.ToLower(o.OTLP.Protocol) {
+		case ApmOTLPProtocolGRPC, ApmOTLPProtocolHTTP:
+		default:
+			errs = append(errs, fieldError("apm.otlp.protocol", "apm.otlp.protocol", "must be grpc or http"))
+		}
+		if o.OTLP.Timeout <= 0 {
+			errs = append(errs, fieldError("apm.otlp.timeout", "apm.otlp.timeout", "must be positive"))
+		}
+	case ApmReporterLog, ApmReporterNoop:
+	default:
+		errs = append(errs, fieldError("apm.reporter", "apm.reporter", "must be sidecar, grpc, log, noop or otlp"))
+	}
+	if o.QueueSize <= 0 {
+		errs = append(errs, fieldError("apm.queue-size", "apm.queue-size", "must be positive"))
+	}
+	switch strings.ToLower(o.Sampler) {
+	case ApmSamplerConst, ApmSamplerProbabilistic:
+	case ApmSamplerRateLimiting:
+		if o.TracesPerSecond <= 0 {
+			errs = append(errs, fieldError("apm.traces-per-second", "apm.traces-per-second", "must be positive with the rate-limiting sampler"))
+		}
+	default:
+		errs = append(errs, fieldError("apm.sampler", "apm.sampler", "must be const, probabilistic or rate-limiting"))
+	}
+	if o.SampleRate < 0 || o.SampleRate > 1 {
+		errs = append(errs, fieldError("apm.sample-rate", "apm.sample-rate", "must be between 0 and 1, inclusive"))
+	}
+	if len(o.Propagators) == 0 {
+		errs = append(errs, fieldError("apm.propagators", "apm.propagators", "must not be empty"))
+	}
+	seen := map[string]bool{}
+	for _, p := range o.Propagators {
+		switch strings.ToLower(p) {
+		case ApmPropagatorSW8, ApmPropagatorTraceContext, ApmPropagatorB3, ApmPropagatorB3Multi:
+		default:
+			errs = append(errs, fieldError("apm.propagators", "apm.propagators", fmt.Sprintf("unknown propagator %q, must be sw8, tracecontext, b3 or b3multi", p)))
+		}
+		if seen[strings.ToLower(p)] {
+			errs = append(errs, fieldError("apm.propagators", "apm.propagators", fmt.Sprintf("propagator %q is listed twice", p)))
+		}
+		seen[strings.ToLower(p)] = true
+	}
+	return errs
+}
+
 func (o *ApmOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&o.Enabled, "apm.enabled", o.Enabled, "Whether to enable APM.")
 
+	fs.StringVar(&o.Reporter, "apm.reporter", o.Reporter, ""+
+		"Reporter of the traces: sidecar, grpc to the OAP server, log to stderr, noop to only keep the trace context of the logs, "+
+		"or otlp to export them to an OpenTelemetry collector.")
+
 	fs.StringVar(&o.Address, "apm.address", o.Address, ""+
-		"APM enabled address.")
+		"Unix socket of the sidecar, or address host:port of the OAP server with --apm.reporter=grpc and of the "+
+		"OpenTelemetry collector with --apm.reporter=otlp.")
+
+	fs.StringVar(&o.Authentication, "apm.authentication", o.Authentication, ""+
+		"Authentication token of the OAP server, or Authorization header of the otlp exports. Accepts a reference "+
+		"such as env://SW_AGENT_AUTHENTICATION.")
+	cliflag.MarkSecret(fs, "apm.authentication")
+
+	fs.BoolVar(&o.TLS.Enabled, "apm.tls.enabled", o.TLS.Enabled, "Connect to the OAP server with TLS.")
+
+	fs.StringVar(&o.TLS.CAFile, "apm.tls.ca-file", o.TLS.CAFile, ""+
+		"CA bundle verifying the certificate of the OAP server, the system roots when empty.")
+
+	fs.StringVar(&o.TLS.ServerName, "apm.tls.server-name", o.TLS.ServerName, ""+
+		"Name expected in the certificate of the OAP server, the host of --apm.address when empty.")
+
+	fs.BoolVar(&o.TLS.InsecureSkipVerify, "apm.tls.insecure-skip-verify", o.TLS.InsecureSkipVerify, ""+
+		"Do not verify the certificate of the OAP server, for tests only.")
+
+	fs.StringVar(&o.OTLP.Protocol, "apm.otlp.protocol", o.OTLP.Protocol, ""+
+		"Protocol of the otlp exports, grpc or http.")
+
+	fs.StringToStringVar(&o.OTLP.Headers, "apm.otlp.headers", o.OTLP.Headers, ""+
+		"Headers sent with the otlp exports, e.g. X-Scope-OrgID=orders. Prefer references such as "+
+		"env://OTLP_TOKEN over the tokens themselves.")
+	cliflag.MarkSecret(fs, "apm.otlp.headers")
+
+	fs.DurationVar(&o.OTLP.Timeout, "apm.otlp.timeout", o.OTLP.Timeout, ""+
+		"Maximum duration of an otlp export, retries included.")
+
+	fs.IntVar(&o.QueueSize, "apm.queue-size", o.QueueSize, ""+
+		"Number of segments waiting to be sent, the segments finished when the queue is full are dropped.")
+
+	fs.StringToStringVar(&o.InstanceProperties, "apm.instance-properties", o.InstanceProperties, ""+
+		"Properties reported with the service instance on top of the build information, e.g. region=eu-west-1.")
 
 	fs.BoolVar(&o.Http, "apm.http", o.Http, "Whether to enable Http.")
 
@@ -34,4 +253,30 @@ func (o *ApmOptions) AddFlags(fs *pflag.FlagSet) {
 
 	fs.BoolVar(&o.Redis, "apm.redis", o.Redis, "Whether to enable Redis.")
 
+	fs.BoolVar(&o.Grpc, "apm.grpc", o.Grpc, ""+
+		"Whether to trace the calls served by the gRPC server, the server itself is enabled by --grpc.enabled.")
+
+	fs.BoolVar(&o.HttpClient, "apm.http-client", o.HttpClient, "Whether to trace the outgoing HTTP requests.")
+
+	fs.StringVar(&o.Sampler, "apm.sampler", o.Sampler, ""+
+		"Sampling strategy of the new traces: const traces every request, probabilistic --apm.sample-rate of them "+
+		"and rate-limiting up to --apm.traces-per-second.")
+
+	fs.Float64Var(&o.SampleRate, "apm.sample-rate", o.SampleRate, ""+
+		"Fraction of requests traced by the probabilistic sampler, from 0 to 1. Can be changed without a restart.")
+
+	fs.Float64Var(&o.TracesPerSecond, "apm.traces-per-second", o.TracesPerSecond, ""+
+		"Number of requests traced per second by the rate-limiting sampler. Can be changed without a restart.")
+
+	fs.StringSliceVar(&o.AlwaysSample, "apm.always-sample", o.AlwaysSample, ""+
+		"Operations always traced whatever the sampler, e.g. /POST/v1/orders or /proto.Service/*. Can be changed without a restart.")
+
+	fs.StringSliceVar(&o.NeverSample, "apm.never-sample", o.NeverSample, ""+
+		"Operations never traced, unless called by a traced service, e.g. /GET/healthcheck. Takes precedence over "+
+		"--apm.always-sample. Can be changed without a restart.")
+
+	fs.StringSliceVar(&o.Propagators, "apm.propagators", o.Propagators, ""+
+		"Formats of the trace context, any of sw8, tracecontext (W3C), b3 (single header) and b3multi. The first one "+
+		"present in a request continues its trace, the outgoing requests carry all of them.")
+
 }
@@ -1,6 +1,9 @@
 package options
 
 import (
+	stdgzip "compress/gzip"
+
+	"github.com/767829413/normal-frame/internal/apiserver/validation"
 	"github.com/767829413/normal-frame/internal/pkg/config"
 	"github.com/gin-contrib/gzip"
 	"github.com/spf13/pflag"
@@ -8,9 +11,17 @@ import (
 
 // FeatureOptions contains configuration items related to API server features.
 type FeatureOptions struct {
-	EnablePprof   bool  `json:"enable-pprof" mapstructure:"enable-pprof" yaml:"enable-pprof"`
-	EnableMetrics bool  `json:"enable-metrics" mapstructure:"enable-metrics" yaml:"enable-metrics"`
-	Gzip          *Gzip `json:"gzip" mapstructure:"gzip" yaml:"gzip"`
+	EnablePprof   bool `json:"enable-pprof" mapstructure:"enable-pprof" yaml:"enable-pprof"`
+	EnableMetrics bool `json:"enable-metrics" mapstructure:"enable-metrics" yaml:"enable-metrics"`
+	EnableAdmin   bool `json:"enable-admin" mapstructure:"enable-admin" yaml:"enable-admin"`
+	// AdminIdentities are the SPIFFE IDs or common names of the client
+	// certificates allowed on the admin endpoints.
+	AdminIdentities []string   `json:"admin-identities" mapstructure:"admin-identities" yaml:"admin-identities"`
+	Gzip            *Gzip      `json:"gzip" mapstructure:"gzip" yaml:"gzip"`
+	Cors            *Cors      `json:"cors" mapstructure:"cors" yaml:"cors"`
+	RateLimit       *RateLimit `json:"rate-limit" mapstructure:"rate-limit" yaml:"rate-limit"`
+	// Flags are application feature flags, they can be toggled without a restart.
+	Flags map[string]bool `json:"flags" mapstructure:"flags" yaml:"flags"`
 }
 
 type Gzip struct {
@@ -18,27 +29,74 @@ type Gzip struct {
 	Level   int  `mapstructure:"level" json:"level" yaml:"level"`
 }
 
+type Cors struct {
+	AllowOrigins []string `mapstructure:"allow-origins" json:"allow-origins" yaml:"allow-origins"`
+}
+
+type RateLimit struct {
+	Enabled bool    `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
+	QPS     float64 `mapstructure:"qps" json:"qps" yaml:"qps"`
+	Burst   int     `mapstructure:"burst" json:"burst" yaml:"burst"`
+}
+
 // NewFeatureOptions creates a FeatureOptions object with default parameters.
 func NewFeatureOptions() *FeatureOptions {
 	return &FeatureOptions{
-		EnableMetrics: false,
-		EnablePprof:   false,
+		EnableMetrics:   false,
+		EnablePprof:     false,
+		EnableAdmin:     false,
+		AdminIdentities: []string{},
 		Gzip: &Gzip{
 			Enabled: false,
 			Level:   gzip.DefaultCompression,
 		},
+		Cors: &Cors{
+			AllowOrigins: []string{"*"},
+		},
+		RateLimit: &RateLimit{
+			Enabled: false,
+			QPS:     1000,
+			Burst:   100,
+		},
+		Flags: map[string]bool{},
 	}
 }
 
+// Enabled reports whether the feature flag name is switched on.
+func (s *FeatureOptions) Enabled(name string) bool {
+	return s.Flags[name]
+}
+
 // ApplyTo applies the run options to the method receiver and returns self.
 func (s *FeatureOptions) ApplyTo(c *config.GenericConfig) error {
 	c.EnabledGzip = s.Gzip.Enabled
 	c.GzipLevel = s.Gzip.Level
 	c.EnableMetrics = s.EnableMetrics
 	c.EnablePprof = s.EnablePprof
+	c.EnableAdmin = s.EnableAdmin
+	c.AdminIdentities = s.AdminIdentities
+	c.CorsAllowOrigins = s.Cors.AllowOrigins
+	c.RateLimitEnabled = s.RateLimit.Enabled
+	c.RateLimitQPS = s.RateLimit.QPS
+	c.RateLimitBurst = s.RateLimit.Burst
 	return nil
 }
 
+// Validate checks the feature options and returns the problems found.
+func (s *FeatureOptions) Validate() []error {
+	var errs []error
+	if msgs := validation.IsInRange(s.Gzip.Level, stdgzip.HuffmanOnly, gzip.BestCompression); len(msgs) != 0 {
+		errs = append(errs, fieldError("feature.gzip.level", "feature.gzip.level", msgs...))
+	}
+	if s.RateLimit.QPS < 0 {
+		errs = append(errs, fieldError("feature.rate-limit.qps", "feature.rate-limit.qps", "must be greater than or equal to 0"))
+	}
+	if s.RateLimit.Enabled && s.RateLimit.Burst < 1 {
+		errs = append(errs, fieldError("feature.rate-limit.burst", "feature.rate-limit.burst", "must be greater than 0"))
+	}
+	return errs
+}
+
 func (f *FeatureOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&f.Gzip.Enabled, "feature.gzip.enabled", f.Gzip.Enabled, "Whether to enable Gzip compression.")
 
@@ -49,4 +107,24 @@ func (f *FeatureOptions) AddFlags(fs *pflag.FlagSet) {
 
 	fs.BoolVar(&f.EnableMetrics, "feature.enable-metrics", f.EnableMetrics,
 		"Enables metrics on the apiserver at /metrics")
+
+	fs.BoolVar(&f.EnableAdmin, "feature.enable-admin", f.EnableAdmin,
+		"Enables the administration endpoints at /admin, such as /admin/log-levels. They are only served over HTTPS "+
+			"to clients with a verified certificate, see --secure.client-auth and --feature.admin-identities.")
+
+	fs.StringSliceVar(&f.AdminIdentities, "feature.admin-identities", f.AdminIdentities, ""+
+		"SPIFFE IDs or common names of the client certificates allowed on the administration endpoints, "+
+		"any verified client certificate when empty.")
+
+	fs.StringSliceVar(&f.Cors.AllowOrigins, "feature.cors.allow-origins", f.Cors.AllowOrigins, ""+
+		"Origins allowed by CORS requests, * allows every origin. Can be changed without a restart.")
+
+	fs.BoolVar(&f.RateLimit.Enabled, "feature.rate-limit.enabled", f.RateLimit.Enabled, ""+
+		"Whether to limit the rate of incoming requests. Can be changed without a restart.")
+
+	fs.Float64Var(&f.RateLimit.QPS, "feature.rate-limit.qps", f.RateLimit.QPS, ""+
+		"Requests per second allowed when --feature.rate-limit.enabled is set.")
+
+	fs.IntVar(&f.RateLimit.Burst, "feature.rate-limit.burst", f.RateLimit.Burst, ""+
+		"Maximum burst of requests allowed above --feature.rate-limit.qps.")
 }
@@ -1,6 +1,7 @@
 package options
 
 import (
+	"github.com/767829413/normal-frame/internal/apiserver/validation"
 	"github.com/767829413/normal-frame/internal/pkg/config"
 	"github.com/spf13/pflag"
 )
@@ -32,6 +33,24 @@ func (s *GrpcOptions) ApplyTo(ec *config.ExtraConfig) error {
 	return nil
 }
 
+// Validate checks the grpc options and returns the problems found.
+func (s *GrpcOptions) Validate() []error {
+	if !s.Enabled {
+		return nil
+	}
+	var errs []error
+	if msgs := validation.IsValidIP(s.BindAddress); len(msgs) != 0 {
+		errs = append(errs, fieldError("grpc.bind-address", "grpc.bind-address", msgs...))
+	}
+	if msgs := validation.IsValidPortNum(s.BindPort); len(msgs) != 0 {
+		errs = append(errs, fieldError("grpc.bind-port", "grpc.bind-port", msgs...))
+	}
+	if s.MaxMsgSize <= 0 {
+		errs = append(errs, fieldError("grpc.max-msg-size", "grpc.max-msg-size", "must be greater than 0"))
+	}
+	return errs
+}
+
 func (s *GrpcOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&s.Enabled, "grpc.enabled", s.Enabled, "Whether to enable GRPC.")
 
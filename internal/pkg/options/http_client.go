@@ -0,0 +1,101 @@
+package options
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// HTTPClientOptions configures the clients of pkg/httpclient calling the other
+// services.
+type HTTPClientOptions struct {
+	// Timeout bounds a call, its retries and the read of the response body.
+	// Zero means no timeout.
+	Timeout time.Duration `json:"timeout" mapstructure:"timeout" yaml:"timeout"`
+	// MaxRetries is the number of times an idempotent request is sent again
+	// after a network error or a 502, 503 or 504 response.
+	MaxRetries int `json:"max-retries" mapstructure:"max-retries" yaml:"max-retries"`
+	// RetryBackoff is the wait before the first retry, doubled for each
+	// following one up to MaxRetryBackoff, with a random jitter.
+	RetryBackoff    time.Duration `json:"retry-backoff" mapstructure:"retry-backoff" yaml:"retry-backoff"`
+	MaxRetryBackoff time.Duration `json:"max-retry-backoff" mapstructure:"max-retry-backoff" yaml:"max-retry-backoff"`
+	// MaxIdleConns, MaxIdleConnsPerHost, MaxConnsPerHost and IdleConnTimeout
+	// tune the connection pool, zero means no limit.
+	MaxIdleConns        int           `json:"max-idle-conns" mapstructure:"max-idle-conns" yaml:"max-idle-conns"`
+	MaxIdleConnsPerHost int           `json:"max-idle-conns-per-host" mapstructure:"max-idle-conns-per-host" yaml:"max-idle-conns-per-host"`
+	MaxConnsPerHost     int           `json:"max-conns-per-host" mapstructure:"max-conns-per-host" yaml:"max-conns-per-host"`
+	IdleConnTimeout     time.Duration `json:"idle-conn-timeout" mapstructure:"idle-conn-timeout" yaml:"idle-conn-timeout"`
+}
+
+func NewHTTPClientOptions() *HTTPClientOptions {
+	return &HTTPClientOptions{
+		Timeout:             10 * time.Second,
+		MaxRetries:          2,
+		RetryBackoff:        100 * time.Millisecond,
+		MaxRetryBackoff:     2 * time.Second,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		MaxConnsPerHost:     0,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// Validate checks the http client options and returns the problems found.
+func (o *HTTPClientOptions) Validate() []error {
+	var errs []error
+	if o.Timeout < 0 {
+		errs = append(errs, fieldError("http-client.timeout", "http-client.timeout", "must be greater than or equal to 0"))
+	}
+	if o.MaxRetries < 0 {
+		errs = append(errs, fieldError("http-client.max-retries", "http-client.max-retries", "must be greater than or equal to 0"))
+	}
+	if o.RetryBackoff <= 0 {
+		errs = append(errs, fieldError("http-client.retry-backoff", "http-client.retry-backoff", "must be positive"))
+	}
+	if o.MaxRetryBackoff < o.RetryBackoff {
+		errs = append(errs, fieldError("http-client.max-retry-backoff", "http-client.max-retry-backoff",
+			"must be greater than or equal to --http-client.retry-backoff"))
+	}
+	for _, n := range []struct {
+		flag  string
+		value int
+	}{
+		{"http-client.max-idle-conns", o.MaxIdleConns},
+		{"http-client.max-idle-conns-per-host", o.MaxIdleConnsPerHost},
+		{"http-client.max-conns-per-host", o.MaxConnsPerHost},
+	} {
+		if n.value < 0 {
+			errs = append(errs, fieldError(n.flag, n.flag, "must be greater than or equal to 0"))
+		}
+	}
+	if o.IdleConnTimeout < 0 {
+		errs = append(errs, fieldError("http-client.idle-conn-timeout", "http-client.idle-conn-timeout", "must be greater than or equal to 0"))
+	}
+	return errs
+}
+
+func (o *HTTPClientOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.DurationVar(&o.Timeout, "http-client.timeout", o.Timeout, ""+
+		"Maximum duration of an outgoing HTTP call, retries and response body included. Zero means no timeout.")
+
+	fs.IntVar(&o.MaxRetries, "http-client.max-retries", o.MaxRetries, ""+
+		"Number of retries of the idempotent requests failing with a network error or a 502, 503 or 504 response.")
+
+	fs.DurationVar(&o.RetryBackoff, "http-client.retry-backoff", o.RetryBackoff, ""+
+		"Wait before the first retry, doubled for each following one with a random jitter.")
+
+	fs.DurationVar(&o.MaxRetryBackoff, "http-client.max-retry-backoff", o.MaxRetryBackoff, ""+
+		"Maximum wait between two retries.")
+
+	fs.IntVar(&o.MaxIdleConns, "http-client.max-idle-conns", o.MaxIdleConns, ""+
+		"Maximum number of idle connections kept open to all the hosts, zero means no limit.")
+
+	fs.IntVar(&o.MaxIdleConnsPerHost, "http-client.max-idle-conns-per-host", o.MaxIdleConnsPerHost, ""+
+		"Maximum number of idle connections kept open to each host.")
+
+	fs.IntVar(&o.MaxConnsPerHost, "http-client.max-conns-per-host", o.MaxConnsPerHost, ""+
+		"Maximum number of connections to each host, the requests over it wait for a connection. Zero means no limit.")
+
+	fs.DurationVar(&o.IdleConnTimeout, "http-client.idle-conn-timeout", o.IdleConnTimeout, ""+
+		"Duration an idle connection is kept open, zero means no limit.")
+}
@@ -1,6 +1,7 @@
 package options
 
 import (
+	"github.com/767829413/normal-frame/internal/apiserver/validation"
 	"github.com/767829413/normal-frame/internal/pkg/config"
 	"github.com/spf13/pflag"
 )
@@ -29,6 +30,21 @@ func (s *HttpsOptions) ApplyTo(ec *config.ExtraConfig) error {
 	return nil
 }
 
+// Validate checks the https options and returns the problems found.
+func (s *HttpsOptions) Validate() []error {
+	if !s.Enabled {
+		return nil
+	}
+	var errs []error
+	if msgs := validation.IsValidIP(s.BindAddress); len(msgs) != 0 {
+		errs = append(errs, fieldError("https.bind-address", "https.bind-address", msgs...))
+	}
+	if msgs := validation.IsValidPortNum(s.BindPort); len(msgs) != 0 {
+		errs = append(errs, fieldError("https.bind-port", "https.bind-port", msgs...))
+	}
+	return errs
+}
+
 func (s *HttpsOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&s.Enabled, "https.enabled", s.Enabled, "Whether to enable GRPC.")
 
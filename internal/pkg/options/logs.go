@@ -1,17 +1,491 @@
 package options
 
-import "github.com/spf13/pflag"
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	cliflag "github.com/767829413/normal-frame/fork/component-base/cli/flag"
+	"github.com/767829413/normal-frame/internal/pkg/config"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+)
+
+// Log outputs accepted in LogsOptions.OutPut.
+const (
+	LogOutputStdout     = "stdout"
+	LogOutputFile       = "file"
+	LogOutputRedis      = "redis"
+	LogOutputSkywalking = "skywalking"
+)
+
+// Transports of the skywalking output accepted in LogSkywalking.Transport.
+const (
+	LogTransportGRPC    = "grpc"
+	LogTransportSidecar = "sidecar"
+)
+
+// LogModules are the log categories accepted in LogsOptions.Modules, the
+// LogName constants of the logger.
+var LogModules = []string{
+	"default", "redis", "mysql", "mongodb", "api", "ao", "grpc", "es", "tmq", "amq", "logic", "file", "net", "http",
+}
+
+// Caller modes accepted in LogsOptions.Caller.
+const (
+	LogCallerNone  = "none"
+	LogCallerError = "error"
+	LogCallerAll   = "all"
+)
 
 type LogsOptions struct {
-	OutPut string `json:"out-put" mapstructure:"out-put" yaml:"out-put"`
+	// OutPut lists the outputs receiving the logs, any of stdout, file, redis
+	// and skywalking.
+	OutPut []string `json:"out-put" mapstructure:"out-put" yaml:"out-put"`
+	// OutputLevels sets the minimum level of single outputs, e.g. stdout: warn.
+	OutputLevels map[string]string `json:"output-levels" mapstructure:"output-levels" yaml:"output-levels"`
+	File         *LogFile          `json:"file" mapstructure:"file" yaml:"file"`
+	Level        string            `json:"level" mapstructure:"level" yaml:"level"`
+	Format       string            `json:"format" mapstructure:"format" yaml:"format"`
+	// Modules overrides the level of log categories, e.g. mysql: warn.
+	Modules map[string]string `json:"modules" mapstructure:"modules" yaml:"modules"`
+	// Caller adds the file, line and function logging an entry: none, error
+	// for the entries at error level and above, or all.
+	Caller string `json:"caller" mapstructure:"caller" yaml:"caller"`
+	// GoroutineID adds the id of the goroutine logging an entry, it is costly
+	// to compute.
+	GoroutineID bool           `json:"goroutine-id" mapstructure:"goroutine-id" yaml:"goroutine-id"`
+	ServiceName string         `json:"service-name" mapstructure:"service-name" yaml:"service-name"`
+	AppID       string         `json:"app-id" mapstructure:"app-id" yaml:"app-id"`
+	RedisAddr   string         `json:"redis-addr" mapstructure:"redis-addr" yaml:"redis-addr"`
+	Redis       *LogRedis      `json:"redis" mapstructure:"redis" yaml:"redis"`
+	Skywalking  *LogSkywalking `json:"skywalking" mapstructure:"skywalking" yaml:"skywalking"`
+	Access      *LogAccess     `json:"access" mapstructure:"access" yaml:"access"`
+}
+
+// LogFile configures the file output, it is rotated when it reaches MaxSize
+// megabytes and every day when Daily is set.
+type LogFile struct {
+	Path       string `json:"path" mapstructure:"path" yaml:"path"`
+	MaxSize    int    `json:"max-size" mapstructure:"max-size" yaml:"max-size"`
+	Daily      bool   `json:"daily" mapstructure:"daily" yaml:"daily"`
+	MaxBackups int    `json:"max-backups" mapstructure:"max-backups" yaml:"max-backups"`
+	MaxAge     int    `json:"max-age" mapstructure:"max-age" yaml:"max-age"`
+	Compress   bool   `json:"compress" mapstructure:"compress" yaml:"compress"`
+}
+
+// LogRedis configures the redis output. Entries are queued and pushed in
+// batches by a background goroutine, when the queue is full they are dropped
+// unless Block is set.
+type LogRedis struct {
+	Password string `json:"password" mapstructure:"password" yaml:"password" secret:"true"`
+	DB       int    `json:"db" mapstructure:"db" yaml:"db"`
+	// Key defaults to service_<app-id>.
+	Key           string        `json:"key" mapstructure:"key" yaml:"key"`
+	TTL           int           `json:"ttl" mapstructure:"ttl" yaml:"ttl"`
+	QueueSize     int           `json:"queue-size" mapstructure:"queue-size" yaml:"queue-size"`
+	BatchSize     int           `json:"batch-size" mapstructure:"batch-size" yaml:"batch-size"`
+	FlushInterval time.Duration `json:"flush-interval" mapstructure:"flush-interval" yaml:"flush-interval"`
+	Timeout       time.Duration `json:"timeout" mapstructure:"timeout" yaml:"timeout"`
+	Block         bool          `json:"block" mapstructure:"block" yaml:"block"`
+}
+
+// LogSkywalking configures the skywalking output, sending the logs to the
+// SkyWalking backend with the service, instance, endpoint and trace context of
+// each entry. Entries are queued and sent in batches, a failed batch is retried
+// MaxRetries times with a backoff.
+type LogSkywalking struct {
+	// Transport is grpc to send the logs to the OAP server at Address, or
+	// sidecar to the sidecar listening on the unix socket Address.
+	Transport      string `json:"transport" mapstructure:"transport" yaml:"transport"`
+	Address        string `json:"address" mapstructure:"address" yaml:"address"`
+	Authentication string `json:"authentication" mapstructure:"authentication" yaml:"authentication" secret:"true"`
+	// Service defaults to the service name, Instance to the hostname. Traced
+	// entries are reported with the service and instance of their trace.
+	Service       string        `json:"service" mapstructure:"service" yaml:"service"`
+	Instance      string        `json:"instance" mapstructure:"instance" yaml:"instance"`
+	QueueSize     int           `json:"queue-size" mapstructure:"queue-size" yaml:"queue-size"`
+	BatchSize     int           `json:"batch-size" mapstructure:"batch-size" yaml:"batch-size"`
+	FlushInterval time.Duration `json:"flush-interval" mapstructure:"flush-interval" yaml:"flush-interval"`
+	Timeout       time.Duration `json:"timeout" mapstructure:"timeout" yaml:"timeout"`
+	MaxRetries    int           `json:"max-retries" mapstructure:"max-retries" yaml:"max-retries"`
 }
 
+// LogAccess configures the access log of the HTTP requests, written to the api
+// category. Bodies are only logged for BodyContentTypes, up to MaxBodySize
+// bytes, and the RedactFields and RedactHeaders are masked.
+type LogAccess struct {
+	Enabled bool `json:"enabled" mapstructure:"enabled" yaml:"enabled"`
+	// SkipPaths are not logged, a path ending with * matches its prefix.
+	SkipPaths []string `json:"skip-paths" mapstructure:"skip-paths" yaml:"skip-paths"`
+	// SampleRate is the fraction of the successful requests logged.
+	SampleRate       float64  `json:"sample-rate" mapstructure:"sample-rate" yaml:"sample-rate"`
+	Headers          bool     `json:"headers" mapstructure:"headers" yaml:"headers"`
+	Body             bool     `json:"body" mapstructure:"body" yaml:"body"`
+	MaxBodySize      int      `json:"max-body-size" mapstructure:"max-body-size" yaml:"max-body-size"`
+	BodyContentTypes []string `json:"body-content-types" mapstructure:"body-content-types" yaml:"body-content-types"`
+	// RedactFields are JSON paths such as user.password or items.*.token.
+	RedactFields  []string `json:"redact-fields" mapstructure:"redact-fields" yaml:"redact-fields"`
+	RedactHeaders []string `json:"redact-headers" mapstructure:"redact-headers" yaml:"redact-headers"`
+}
+
+// NewLogsOptions creates a LogsOptions object with default parameters, the
+// service name, app id and redis address default to the legacy IDG_SERVICE_NAME,
+// IDG_APPID and MSP_LOG_REDIS_HOST environment variables.
 func NewLogsOptions() *LogsOptions {
 	return &LogsOptions{
-		OutPut: "redis",
+		OutPut:       []string{LogOutputRedis},
+		OutputLevels: map[string]string{},
+		File: &LogFile{
+			Path:       "",
+			MaxSize:    100,
+			Daily:      true,
+			MaxBackups: 7,
+			MaxAge:     30,
+			Compress:   true,
+		},
+		Level:       logrus.TraceLevel.String(),
+		Format:      "json",
+		Modules:     map[string]string{},
+		Caller:      LogCallerError,
+		GoroutineID: false,
+		ServiceName: os.Getenv("IDG_SERVICE_NAME"),
+		AppID:       os.Getenv("IDG_APPID"),
+		RedisAddr:   os.Getenv("MSP_LOG_REDIS_HOST"),
+		Redis: &LogRedis{
+			Password:      "",
+			DB:            0,
+			Key:           "",
+			TTL:           0,
+			QueueSize:     10000,
+			BatchSize:     100,
+			FlushInterval: time.Second,
+			Timeout:       time.Second,
+			Block:         false,
+		},
+		Skywalking: &LogSkywalking{
+			Transport:      LogTransportGRPC,
+			Address:        "127.0.0.1:11800",
+			Authentication: "",
+			Service:        "",
+			Instance:       "",
+			QueueSize:      10000,
+			BatchSize:      100,
+			FlushInterval:  time.Second,
+			Timeout:        5 * time.Second,
+			MaxRetries:     3,
+		},
+		Access: &LogAccess{
+			Enabled:          true,
+			SkipPaths:        []string{"/healthcheck", "/metrics"},
+			SampleRate:       1,
+			Headers:          false,
+			Body:             false,
+			MaxBodySize:      4096,
+			BodyContentTypes: []string{"application/json", "application/x-www-form-urlencoded"},
+			RedactFields:     []string{"password", "token", "secret"},
+			RedactHeaders:    []string{"Authorization", "Cookie", "Set-Cookie", "X-Api-Key"},
+		},
+	}
+}
+
+// Validate checks the logs options and returns the problems found.
+func (o *LogsOptions) Validate() []error {
+	var errs []error
+	if _, err := logrus.ParseLevel(o.Level); err != nil {
+		errs = append(errs, fieldError("logs.level", "logs.level", err.Error()))
+	}
+	for name, level := range o.Modules {
+		if !isLogModule(name) {
+			errs = append(errs, fieldError("logs.modules", "logs.modules."+name,
+				fmt.Sprintf("unknown log category %q, must be one of %s", name, strings.Join(LogModules, ", "))))
+		}
+		if _, err := logrus.ParseLevel(level); err != nil {
+			errs = append(errs, fieldError("logs.modules", "logs.modules."+name, err.Error()))
+		}
+	}
+	switch strings.ToLower(o.Format) {
+	case "json", "text", "logfmt":
+	default:
+		errs = append(errs, fieldError("logs.format", "logs.format", "must be json, text or logfmt"))
+	}
+	switch strings.ToLower(o.Caller) {
+	case LogCallerNone, LogCallerError, LogCallerAll:
+	default:
+		errs = append(errs, fieldError("logs.caller", "logs.caller", "must be none, error or all"))
+	}
+	if len(o.OutPut) == 0 {
+		errs = append(errs, fieldError("log.output", "logs.out-put", "at least one output is required"))
+	}
+	for _, output := range o.OutPut {
+		if !isLogOutput(output) {
+			errs = append(errs, fieldError("log.output", "logs.out-put", fmt.Sprintf("unknown output %q, must be stdout, file, redis or skywalking", output)))
+		}
+	}
+	for output, level := range o.OutputLevels {
+		if !isLogOutput(output) {
+			errs = append(errs, fieldError("logs.output-levels", "logs.output-levels."+output, "must be stdout, file, redis or skywalking"))
+		} else if _, err := logrus.ParseLevel(level); err != nil {
+			errs = append(errs, fieldError("logs.output-levels", "logs.output-levels."+output, err.Error()))
+		}
+	}
+	if o.HasOutput(LogOutputFile) {
+		if o.File.Path == "" {
+			errs = append(errs, fieldError("logs.file.path", "logs.file.path", "is required when the file output is enabled"))
+		}
+		if o.File.MaxSize < 0 {
+			errs = append(errs, fieldError("logs.file.max-size", "logs.file.max-size", "must not be negative"))
+		}
+		if o.File.MaxBackups < 0 {
+			errs = append(errs, fieldError("logs.file.max-backups", "logs.file.max-backups", "must not be negative"))
+		}
+		if o.File.MaxAge < 0 {
+			errs = append(errs, fieldError("logs.file.max-age", "logs.file.max-age", "must not be negative"))
+		}
+	}
+	if o.RedisAddr != "" {
+		if msgs := isValidHostPort(o.RedisAddr); len(msgs) != 0 {
+			errs = append(errs, fieldError("logs.redis-addr", "logs.redis-addr", msgs...))
+		}
+	}
+	if o.HasOutput(LogOutputRedis) {
+		if o.Redis.DB < 0 {
+			errs = append(errs, fieldError("logs.redis.db", "logs.redis.db", "must not be negative"))
+		}
+		if o.Redis.TTL < 0 {
+			errs = append(errs, fieldError("logs.redis.ttl", "logs.redis.ttl", "must not be negative"))
+		}
+		if o.Redis.QueueSize <= 0 {
+			errs = append(errs, fieldError("logs.redis.queue-size", "logs.redis.queue-size", "must be positive"))
+		}
+		if o.Redis.BatchSize <= 0 {
+			errs = append(errs, fieldError("logs.redis.batch-size", "logs.redis.batch-size", "must be positive"))
+		}
+		if o.Redis.FlushInterval <= 0 {
+			errs = append(errs, fieldError("logs.redis.flush-interval", "logs.redis.flush-interval", "must be positive"))
+		}
+		if o.Redis.Timeout <= 0 {
+			errs = append(errs, fieldError("logs.redis.timeout", "logs.redis.timeout", "must be positive"))
+		}
+	}
+	if o.HasOutput(LogOutputSkywalking) {
+		errs = append(errs, o.Skywalking.validate(o.ServiceName)...)
+	}
+	if o.Access.Enabled {
+		if o.Access.SampleRate < 0 || o.Access.SampleRate > 1 {
+			errs = append(errs, fieldError("logs.access.sample-rate", "logs.access.sample-rate", "must be between 0 and 1, inclusive"))
+		}
+		if o.Access.Body && o.Access.MaxBodySize <= 0 {
+			errs = append(errs, fieldError("logs.access.max-body-size", "logs.access.max-body-size", "must be positive when bodies are logged"))
+		}
+	}
+	return errs
+}
+
+func (o *LogSkywalking) validate(serviceName string) []error {
+	var errs []error
+	switch strings.ToLower(o.Transport) {
+	case LogTransportGRPC:
+		if msgs := isValidHostPort(o.Address); len(msgs) != 0 {
+			errs = append(errs, fieldError("logs.skywalking.address", "logs.skywalking.address", msgs...))
+		}
+	case LogTransportSidecar:
+		if o.Address == "" {
+			errs = append(errs, fieldError("logs.skywalking.address", "logs.skywalking.address", "is required when the skywalking output is enabled"))
+		}
+	default:
+		errs = append(errs, fieldError("logs.skywalking.transport", "logs.skywalking.transport", "must be grpc or sidecar"))
+	}
+	if o.Service == "" && serviceName == "" {
+		errs = append(errs, fieldError("logs.skywalking.service", "logs.skywalking.service", "is required when logs.service-name is empty"))
+	}
+	if o.QueueSize <= 0 {
+		errs = append(errs, fieldError("logs.skywalking.queue-size", "logs.skywalking.queue-size", "must be positive"))
+	}
+	if o.BatchSize <= 0 {
+		errs = append(errs, fieldError("logs.skywalking.batch-size", "logs.skywalking.batch-size", "must be positive"))
+	}
+	if o.FlushInterval <= 0 {
+		errs = append(errs, fieldError("logs.skywalking.flush-interval", "logs.skywalking.flush-interval", "must be positive"))
+	}
+	if o.Timeout <= 0 {
+		errs = append(errs, fieldError("logs.skywalking.timeout", "logs.skywalking.timeout", "must be positive"))
+	}
+	if o.MaxRetries < 0 {
+		errs = append(errs, fieldError("logs.skywalking.max-retries", "logs.skywalking.max-retries", "must not be negative"))
+	}
+	return errs
+}
+
+// ApplyTo applies the access log options to the server config.
+func (o *LogsOptions) ApplyTo(c *config.GenericConfig) error {
+	c.AccessLog = config.AccessLogConfig{
+		Enabled:          o.Access.Enabled,
+		SkipPaths:        o.Access.SkipPaths,
+		SampleRate:       o.Access.SampleRate,
+		Headers:          o.Access.Headers,
+		Body:             o.Access.Body,
+		MaxBodySize:      o.Access.MaxBodySize,
+		BodyContentTypes: o.Access.BodyContentTypes,
+		RedactFields:     o.Access.RedactFields,
+		RedactHeaders:    o.Access.RedactHeaders,
+	}
+	return nil
+}
+
+// HasOutput reports whether the logs are written to output.
+func (o *LogsOptions) HasOutput(output string) bool {
+	for _, out := range o.OutPut {
+		if strings.EqualFold(out, output) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLogOutput(output string) bool {
+	switch strings.ToLower(output) {
+	case LogOutputStdout, LogOutputFile, LogOutputRedis, LogOutputSkywalking:
+		return true
 	}
+	return false
+}
+
+func isLogModule(name string) bool {
+	for _, module := range LogModules {
+		if name == module {
+			return true
+		}
+	}
+	return false
 }
 
 func (o *LogsOptions) AddFlags(fs *pflag.FlagSet) {
-	fs.StringVar(&o.OutPut, "log.output", o.OutPut, "Log output path, stdout or redis, default redis.")
+	fs.StringSliceVar(&o.OutPut, "log.output", o.OutPut, ""+
+		"Log outputs, any of stdout, file, redis and skywalking, e.g. stdout,file.")
+
+	fs.StringToStringVar(&o.OutputLevels, "logs.output-levels", o.OutputLevels, ""+
+		"Minimum level of single outputs on top of --logs.level and --logs.modules, e.g. stdout=warn,file=debug.")
+
+	fs.StringVar(&o.File.Path, "logs.file.path", o.File.Path, ""+
+		"Path of the log file when --log.output includes file. It is reopened on SIGHUP, for logrotate.")
+
+	fs.IntVar(&o.File.MaxSize, "logs.file.max-size", o.File.MaxSize, ""+
+		"Size in megabytes at which the log file is rotated, 0 disables rotation by size.")
+
+	fs.BoolVar(&o.File.Daily, "logs.file.daily", o.File.Daily, "Rotate the log file every day.")
+
+	fs.IntVar(&o.File.MaxBackups, "logs.file.max-backups", o.File.MaxBackups, ""+
+		"Number of rotated log files to keep, 0 keeps them all.")
+
+	fs.IntVar(&o.File.MaxAge, "logs.file.max-age", o.File.MaxAge, ""+
+		"Days to keep rotated log files, 0 keeps them regardless of their age.")
+
+	fs.BoolVar(&o.File.Compress, "logs.file.compress", o.File.Compress, "Gzip the rotated log files.")
+
+	fs.StringVar(&o.Level, "logs.level", o.Level, ""+
+		"Minimum log level: trace, debug, info, warn, error, fatal or panic. Can be changed without a restart.")
+
+	fs.StringVar(&o.Format, "logs.format", o.Format, "Log format: json, text or logfmt.")
+
+	fs.StringToStringVar(&o.Modules, "logs.modules", o.Modules, ""+
+		"Level of log categories overriding --logs.level, e.g. mysql=warn,api=info. Categories are default, redis, "+
+		"mysql, mongodb, api, ao, grpc, es, tmq, amq, logic, file, net and http. Can be changed without a restart.")
+
+	fs.StringVar(&o.Caller, "logs.caller", o.Caller, ""+
+		"Add the file, line and function logging an entry: none, error for the entries at error level and above, or all.")
+
+	fs.BoolVar(&o.GoroutineID, "logs.goroutine-id", o.GoroutineID, ""+
+		"Add the id of the goroutine logging an entry, it slows logging down.")
+
+	fs.StringVar(&o.ServiceName, "logs.service-name", o.ServiceName, "Service name added to every log entry.")
+
+	fs.StringVar(&o.AppID, "logs.app-id", o.AppID, "App id added to every log entry, also names the redis log key service_<app-id>.")
+
+	fs.StringVar(&o.RedisAddr, "logs.redis-addr", o.RedisAddr, ""+
+		"Address host:port of the redis receiving the logs when --log.output includes redis.")
+
+	fs.StringVar(&o.Redis.Password, "logs.redis.password", o.Redis.Password, ""+
+		"Password of the redis receiving the logs, or a reference such as env://LOG_REDIS_PASS.")
+	cliflag.MarkSecret(fs, "logs.redis.password")
+
+	fs.IntVar(&o.Redis.DB, "logs.redis.db", o.Redis.DB, "Database of the redis receiving the logs.")
+
+	fs.StringVar(&o.Redis.Key, "logs.redis.key", o.Redis.Key, ""+
+		"List the logs are pushed to, service_<app-id> when empty.")
+
+	fs.IntVar(&o.Redis.TTL, "logs.redis.ttl", o.Redis.TTL, ""+
+		"Expiration in seconds set on the list of logs after each push, 0 disables it.")
+
+	fs.IntVar(&o.Redis.QueueSize, "logs.redis.queue-size", o.Redis.QueueSize, ""+
+		"Number of log entries queued for redis, entries logged when the queue is full are dropped unless --logs.redis.block is set.")
+
+	fs.IntVar(&o.Redis.BatchSize, "logs.redis.batch-size", o.Redis.BatchSize, ""+
+		"Maximum number of log entries pushed to redis at once.")
+
+	fs.DurationVar(&o.Redis.FlushInterval, "logs.redis.flush-interval", o.Redis.FlushInterval, ""+
+		"Maximum time a log entry waits in the queue before being pushed to redis.")
+
+	fs.DurationVar(&o.Redis.Timeout, "logs.redis.timeout", o.Redis.Timeout, ""+
+		"Timeout of the connection, reads and writes to redis.")
+
+	fs.BoolVar(&o.Redis.Block, "logs.redis.block", o.Redis.Block, ""+
+		"Make logging wait for room when the redis queue is full instead of dropping the entry.")
+
+	fs.StringVar(&o.Skywalking.Transport, "logs.skywalking.transport", o.Skywalking.Transport, ""+
+		"Transport of the logs to SkyWalking when --log.output includes skywalking: grpc to the OAP server or sidecar.")
+
+	fs.StringVar(&o.Skywalking.Address, "logs.skywalking.address", o.Skywalking.Address, ""+
+		"Address host:port of the OAP server, or unix socket of the sidecar, receiving the logs.")
+
+	fs.StringVar(&o.Skywalking.Authentication, "logs.skywalking.authentication", o.Skywalking.Authentication, ""+
+		"Authentication token of the OAP server, or a reference such as env://SW_AGENT_AUTHENTICATION.")
+	cliflag.MarkSecret(fs, "logs.skywalking.authentication")
+
+	fs.StringVar(&o.Skywalking.Service, "logs.skywalking.service", o.Skywalking.Service, ""+
+		"Service of the logs sent to SkyWalking, --logs.service-name when empty. Traced entries keep the service of their trace.")
+
+	fs.StringVar(&o.Skywalking.Instance, "logs.skywalking.instance", o.Skywalking.Instance, ""+
+		"Service instance of the logs sent to SkyWalking, the hostname when empty.")
+
+	fs.IntVar(&o.Skywalking.QueueSize, "logs.skywalking.queue-size", o.Skywalking.QueueSize, ""+
+		"Number of log entries queued for SkyWalking, entries logged when the queue is full are dropped.")
+
+	fs.IntVar(&o.Skywalking.BatchSize, "logs.skywalking.batch-size", o.Skywalking.BatchSize, ""+
+		"Maximum number of log entries sent to SkyWalking at once.")
+
+	fs.DurationVar(&o.Skywalking.FlushInterval, "logs.skywalking.flush-interval", o.Skywalking.FlushInterval, ""+
+		"Maximum time a log entry waits in the queue before being sent to SkyWalking.")
+
+	fs.DurationVar(&o.Skywalking.Timeout, "logs.skywalking.timeout", o.Skywalking.Timeout, ""+
+		"Timeout of sending one batch of log entries to SkyWalking.")
+
+	fs.IntVar(&o.Skywalking.MaxRetries, "logs.skywalking.max-retries", o.Skywalking.MaxRetries, ""+
+		"Number of retries of a batch SkyWalking failed to receive, with a backoff, before its entries are lost.")
+
+	fs.BoolVar(&o.Access.Enabled, "logs.access.enabled", o.Access.Enabled, "Log every HTTP request to the api category.")
+
+	fs.StringSliceVar(&o.Access.SkipPaths, "logs.access.skip-paths", o.Access.SkipPaths, ""+
+		"Paths of the requests not logged, a path ending with * matches its prefix.")
+
+	fs.Float64Var(&o.Access.SampleRate, "logs.access.sample-rate", o.Access.SampleRate, ""+
+		"Fraction of the successful requests logged between 0 and 1, the failed ones are always logged.")
+
+	fs.BoolVar(&o.Access.Headers, "logs.access.headers", o.Access.Headers, "Log the request headers.")
+
+	fs.BoolVar(&o.Access.Body, "logs.access.body", o.Access.Body, ""+
+		"Log the request and response bodies of --logs.access.body-content-types.")
+
+	fs.IntVar(&o.Access.MaxBodySize, "logs.access.max-body-size", o.Access.MaxBodySize, ""+
+		"Maximum size in bytes of a logged body, larger bodies are left out.")
+
+	fs.StringSliceVar(&o.Access.BodyContentTypes, "logs.access.body-content-types", o.Access.BodyContentTypes, ""+
+		"Content types of the logged bodies.")
+
+	fs.StringSliceVar(&o.Access.RedactFields, "logs.access.redact-fields", o.Access.RedactFields, ""+
+		"JSON paths and form fields masked in the logged bodies, e.g. password,user.token,items.*.secret.")
+
+	fs.StringSliceVar(&o.Access.RedactHeaders, "logs.access.redact-headers", o.Access.RedactHeaders, ""+
+		"Headers masked in the logged request headers.")
 }
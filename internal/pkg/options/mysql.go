@@ -1,6 +1,8 @@
 package options
 
 import (
+	cliflag "github.com/767829413/normal-frame/fork/component-base/cli/flag"
+	"github.com/767829413/normal-frame/internal/apiserver/validation"
 	"github.com/spf13/pflag"
 	glogger "gorm.io/gorm/logger"
 )
@@ -11,7 +13,7 @@ type MySQLOptions struct {
 	Host                  string `json:"host,omitempty" mapstructure:"host" yaml:"host"`
 	Port                  int    `json:"port,omitempty" mapstructure:"port" yaml:"port"`
 	Username              string `json:"username,omitempty" mapstructure:"username" yaml:"username"`
-	Password              string `json:"-" mapstructure:"password" yaml:"password"`
+	Password              string `json:"-" mapstructure:"password" yaml:"password" secret:"true"`
 	Database              string `json:"database"  mapstructure:"database" yaml:"database"`
 	MaxIdleConnections    int    `json:"max-idle-connections,omitempty" mapstructure:"max-idle-connections" yaml:"max-idle-connections"`
 	MaxOpenConnections    int    `json:"max-open-connections,omitempty" mapstructure:"max-open-connections" yaml:"max-open-connections"`
@@ -35,6 +37,40 @@ func NewMySQLOptions() *MySQLOptions {
 	}
 }
 
+// Validate checks the mysql options and returns the problems found, the
+// connection settings are only checked when mysql is enabled.
+func (o *MySQLOptions) Validate() []error {
+	if !o.Enabled {
+		return nil
+	}
+	var errs []error
+	if o.Host == "" {
+		errs = append(errs, fieldError("mysql.host", "mysql.host", validation.EmptyError()))
+	}
+	if msgs := validation.IsValidPortNum(o.Port); len(msgs) != 0 {
+		errs = append(errs, fieldError("mysql.port", "mysql.port", msgs...))
+	}
+	if o.Username == "" {
+		errs = append(errs, fieldError("mysql.username", "mysql.username", validation.EmptyError()))
+	}
+	if o.Database == "" {
+		errs = append(errs, fieldError("mysql.database", "mysql.database", validation.EmptyError()))
+	}
+	if o.MaxIdleConnections < 0 {
+		errs = append(errs, fieldError("mysql.max-idle-connections", "mysql.max-idle-connections", "must be greater than or equal to 0"))
+	}
+	if o.MaxOpenConnections < 0 {
+		errs = append(errs, fieldError("mysql.max-open-connections", "mysql.max-open-connections", "must be greater than or equal to 0"))
+	}
+	if o.MaxConnectionLifeTime < 0 {
+		errs = append(errs, fieldError("mysql.max-connection-life-time", "mysql.max-connection-life-time", "must be greater than or equal to 0"))
+	}
+	if msgs := validation.IsInRange(o.LogLevel, int(glogger.Silent), int(glogger.Info)); len(msgs) != 0 {
+		errs = append(errs, fieldError("mysql.log-level", "mysql.log-level", msgs...))
+	}
+	return errs
+}
+
 func (o *MySQLOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&o.Enabled, "mysql.enabled", o.Enabled, "Whether to enable MySQL.")
 
@@ -50,7 +86,9 @@ func (o *MySQLOptions) AddFlags(fs *pflag.FlagSet) {
 		"Username for access to mysql service.")
 
 	fs.StringVar(&o.Password, "mysql.password", o.Password, ""+
-		"Password for access to mysql, should be used pair with password.")
+		"Password for access to mysql, should be used pair with password. Prefer a reference such as "+
+		"file:///run/secrets/db, env://DB_PASS or vault://secret/data/db#password over the password itself.")
+	cliflag.MarkSecret(fs, "mysql.password")
 
 	fs.StringVar(&o.Database, "mysql.database", o.Database, ""+
 		"Database name for the server to use.")
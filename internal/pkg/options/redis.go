@@ -1,6 +1,10 @@
 package options
 
 import (
+	"net"
+	"strconv"
+
+	"github.com/767829413/normal-frame/internal/apiserver/validation"
 	"github.com/spf13/pflag"
 )
 
@@ -18,6 +22,34 @@ func NewRedisOptions() *RedisOptions {
 	}
 }
 
+// Validate checks the redis options and returns the problems found.
+func (o *RedisOptions) Validate() []error {
+	if !o.Enabled {
+		return nil
+	}
+	var errs []error
+	if msgs := isValidHostPort(o.Address); len(msgs) != 0 {
+		errs = append(errs, fieldError("redis.address", "redis.address", msgs...))
+	}
+	return errs
+}
+
+// isValidHostPort tests for a host:port address with a valid port number.
+func isValidHostPort(address string) []string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	if host == "" {
+		return []string{"host " + validation.EmptyError()}
+	}
+	num, err := strconv.Atoi(port)
+	if err != nil {
+		return []string{"port must be a number"}
+	}
+	return validation.IsValidPortNum(num)
+}
+
 func (o *RedisOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&o.Enabled, "redis.enabled", o.Enabled, "Whether to enable Redis.")
 
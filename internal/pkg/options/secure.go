@@ -1,7 +1,11 @@
 package options
 
 import (
+	"crypto/tls"
+	"path/filepath"
+
 	"github.com/767829413/normal-frame/internal/pkg/config"
+	"github.com/767829413/normal-frame/pkg/certmanager"
 	"github.com/spf13/pflag"
 )
 
@@ -9,6 +13,10 @@ import (
 type SecureOptions struct {
 	// ServerCert is the TLS cert info for serving secure traffic
 	ServerCert GeneratableKeyCert `json:"tls" mapstructure:"tls"`
+	// ClientCAFile is a PEM bundle of the CAs allowed to sign client certificates.
+	ClientCAFile string `json:"client-ca-file" mapstructure:"client-ca-file"`
+	// ClientAuth is the client certificate policy, none, request or require-and-verify.
+	ClientAuth string `json:"client-auth" mapstructure:"client-auth"`
 	// AdvertiseAddress net.IP
 }
 
@@ -19,6 +27,8 @@ func NewSecureOptions() *SecureOptions {
 			PairName:      "",
 			CertDirectory: "",
 		},
+		ClientCAFile: "",
+		ClientAuth:   "none",
 	}
 }
 
@@ -28,9 +38,40 @@ func (s *SecureOptions) ApplyTo(ec *config.ExtraConfig) error {
 	ec.PairName = s.ServerCert.PairName
 	ec.CertFile = s.ServerCert.CertKey.CertFile
 	ec.KeyFile = s.ServerCert.CertKey.KeyFile
+	ec.ClientCAFile = s.ClientCAFile
+	ec.ClientAuth = s.ClientAuth
+	if (ec.CertFile == "" || ec.KeyFile == "") && ec.CertDirectory != "" && ec.PairName != "" {
+		ec.CertFile = filepath.Join(ec.CertDirectory, ec.PairName+".crt")
+		ec.KeyFile = filepath.Join(ec.CertDirectory, ec.PairName+".key")
+	}
 	return nil
 }
 
+// Validate checks the secure options and returns the problems found.
+func (s *SecureOptions) Validate() []error {
+	var errs []error
+	mode, err := certmanager.ParseClientAuth(s.ClientAuth)
+	if err != nil {
+		errs = append(errs, fieldError("secure.client-auth", "secure.client-auth", err.Error()))
+	} else if mode != tls.NoClientCert && s.ClientCAFile == "" {
+		errs = append(errs, fieldError("secure.client-ca-file", "secure.client-ca-file",
+			"required when --secure.client-auth is "+s.ClientAuth))
+	}
+	if (s.ServerCert.CertKey.CertFile == "") != (s.ServerCert.CertKey.KeyFile == "") {
+		errs = append(errs, fieldError("secure.tls.cert-key.private-key-file", "secure.tls.cert-key.private-key-file",
+			"must be set together with --secure.tls.cert-key.cert-file"))
+	}
+	return errs
+}
+
+// HasServerCert reports whether a server certificate is configured, either
+// explicitly or through the certificate directory and pair name.
+func (s *SecureOptions) HasServerCert() bool {
+	cert := s.ServerCert
+	return (cert.CertKey.CertFile != "" && cert.CertKey.KeyFile != "") ||
+		(cert.CertDirectory != "" && cert.PairName != "")
+}
+
 func (s *SecureOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&s.ServerCert.CertDirectory, "secure.tls.cert-dir", s.ServerCert.CertDirectory, ""+
 		"The directory where the TLS certs are located. "+
@@ -48,6 +89,14 @@ func (s *SecureOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&s.ServerCert.CertKey.KeyFile, "secure.tls.cert-key.private-key-file",
 		s.ServerCert.CertKey.KeyFile, ""+
 			"File containing the default x509 private key matching --secure.tls.cert-key.cert-file.")
+
+	fs.StringVar(&s.ClientCAFile, "secure.client-ca-file", s.ClientCAFile, ""+
+		"File containing the PEM encoded CA bundle used to verify client certificates "+
+		"of the HTTPS and gRPC servers. It is reloaded with the certificate when it changes.")
+
+	fs.StringVar(&s.ClientAuth, "secure.client-auth", s.ClientAuth, ""+
+		"Client certificate policy of the HTTPS and gRPC servers. Supported values: none, "+
+		"request (verify a certificate when one is sent), require-and-verify.")
 }
 
 // GeneratableKeyCert contains configuration items related to certificate.
@@ -1,6 +1,7 @@
 package options
 
 import (
+	"github.com/767829413/normal-frame/internal/apiserver/validation"
 	"github.com/767829413/normal-frame/internal/pkg/config"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/pflag"
@@ -31,6 +32,26 @@ func (s *ServerRunOptions) ApplyTo(c *config.GenericConfig) error {
 	return nil
 }
 
+// Validate checks the server run options and returns the problems found.
+func (s *ServerRunOptions) Validate() []error {
+	var errs []error
+	switch s.Mode {
+	// gin falls back to debug mode when none is given
+	case "", gin.DebugMode, gin.TestMode, gin.ReleaseMode:
+	default:
+		errs = append(errs, fieldError("server.mode", "server.mode", "must be one of debug, test or release"))
+	}
+	if s.BindAddress != "" {
+		if msgs := validation.IsValidIP(s.BindAddress); len(msgs) != 0 {
+			errs = append(errs, fieldError("server.bind-address", "server.bind-address", msgs...))
+		}
+	}
+	if msgs := validation.IsValidPortNum(s.BindPort); len(msgs) != 0 {
+		errs = append(errs, fieldError("server.bind-port", "server.bind-port", msgs...))
+	}
+	return errs
+}
+
 func (s *ServerRunOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&s.Mode, "server.mode", s.Mode, ""+
 		"Start the server in a specified server mode. Supported server mode: debug, test, release.")
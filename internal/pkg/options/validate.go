@@ -0,0 +1,12 @@
+package options
+
+import (
+	"fmt"
+	"strings"
+)
+
+// fieldError reports a problem with an option, naming both the command line
+// flag and the YAML key that set it.
+func fieldError(flag, key string, msgs ...string) error {
+	return fmt.Errorf("--%s (%s): %s", flag, key, strings.Join(msgs, ", "))
+}
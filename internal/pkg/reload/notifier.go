@@ -0,0 +1,155 @@
+// Package reload publishes the configuration sections that change when the
+// configuration file is rewritten to the components subscribed to them.
+package reload
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/767829413/normal-frame/internal/apiserver/options"
+	"github.com/767829413/normal-frame/internal/pkg/logger"
+	extDep "github.com/767829413/normal-frame/internal/pkg/options"
+)
+
+// Notifier keeps the effective options and notifies subscribers when a
+// reloaded configuration changes the section they are interested in. Only the
+// settings that are safe to change at runtime are published, any other
+// difference is logged as requiring a restart.
+type Notifier struct {
+	// applying serializes Apply, so that subscribers see the changes in order
+	applying sync.Mutex
+
+	mu      sync.Mutex
+	current *options.Options
+
+	logs    []func(*extDep.LogsOptions)
+	feature []func(*extDep.FeatureOptions)
+	apm     []func(*extDep.ApmOptions)
+}
+
+// NewNotifier creates a Notifier for the options the server was started with.
+func NewNotifier(opts *options.Options) *Notifier {
+	return &Notifier{current: opts}
+}
+
+// Current returns the effective options.
+func (n *Notifier) Current() *options.Options {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.current
+}
+
+// OnLogsChange subscribes fn to changes of logs.level and logs.modules.
+func (n *Notifier) OnLogsChange(fn func(*extDep.LogsOptions)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.logs = append(n.logs, fn)
+}
+
+// OnFeatureChange subscribes fn to changes of feature.cors, feature.rate-limit
+// and feature.flags.
+func (n *Notifier) OnFeatureChange(fn func(*extDep.FeatureOptions)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.feature = append(n.feature, fn)
+}
+
+// OnApmChange subscribes fn to changes of apm.sample-rate.
+func (n *Notifier) OnApmChange(fn func(*extDep.ApmOptions)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.apm = append(n.apm, fn)
+}
+
+// Apply makes next the effective options and notifies the subscribers of the
+// sections that changed. next must already be validated. The subscribers are
+// called without holding the lock, they may call Current or subscribe.
+func (n *Notifier) Apply(next *options.Options) {
+	n.applying.Lock()
+	defer n.applying.Unlock()
+
+	n.mu.Lock()
+	prev := n.current
+	logs, feature, apm := n.logs, n.feature, n.apm
+	n.current = next
+	n.mu.Unlock()
+
+	log := logger.FromContext(logger.NewJobContext(context.Background(), "reload"))
+
+	sections := []struct {
+		name    string
+		changed bool
+	}{
+		{"server", !reflect.DeepEqual(prev.GenericServerRunOptions, next.GenericServerRunOptions)},
+		{"mysql", !reflect.DeepEqual(prev.MySQLOptions, next.MySQLOptions)},
+		{"redis", !reflect.DeepEqual(prev.RedisOptions, next.RedisOptions)},
+		{"grpc", !reflect.DeepEqual(prev.GrpcOptions, next.GrpcOptions)},
+		{"secure", !reflect.DeepEqual(prev.SecureOptions, next.SecureOptions)},
+		{"https", !reflect.DeepEqual(prev.HttpsOptions, next.HttpsOptions)},
+		{"logs", !reflect.DeepEqual(staticLogs(*prev.LogsOptions), staticLogs(*next.LogsOptions))},
+		{"feature", !reflect.DeepEqual(staticFeature(*prev.FeatureOptions), staticFeature(*next.FeatureOptions))},
+		{"apm", !reflect.DeepEqual(staticApm(*prev.ApmOptions), staticApm(*next.ApmOptions))},
+		{"http-client", !reflect.DeepEqual(prev.HTTPClientOptions, next.HTTPClientOptions)},
+	}
+	for _, section := range sections {
+		if section.changed {
+			log.Warnf("configuration section %q changed in a way that cannot be applied at runtime, restart the server to apply it", section.name)
+		}
+	}
+
+	if !reflect.DeepEqual(runtimeLogs(*prev.LogsOptions), runtimeLogs(*next.LogsOptions)) {
+		log.Infof("reload logs.level: %s -> %s, logs.modules: %v -> %v",
+			prev.LogsOptions.Level, next.LogsOptions.Level, prev.LogsOptions.Modules, next.LogsOptions.Modules)
+		for _, fn := range logs {
+			fn(next.LogsOptions)
+		}
+	}
+	if !reflect.DeepEqual(runtimeFeature(*prev.FeatureOptions), runtimeFeature(*next.FeatureOptions)) {
+		log.Infof("reload feature cors, rate-limit and flags")
+		for _, fn := range feature {
+			fn(next.FeatureOptions)
+		}
+	}
+	if !reflect.DeepEqual(runtimeApm(*prev.ApmOptions), runtimeApm(*next.ApmOptions)) {
+		log.Infof("reload apm.sample-rate: %v -> %v, apm.traces-per-second: %v -> %v, apm.always-sample: %v -> %v, apm.never-sample: %v -> %v",
+			prev.ApmOptions.SampleRate, next.ApmOptions.SampleRate, prev.ApmOptions.TracesPerSecond, next.ApmOptions.TracesPerSecond,
+			prev.ApmOptions.AlwaysSample, next.ApmOptions.AlwaysSample, prev.ApmOptions.NeverSample, next.ApmOptions.NeverSample)
+		for _, fn := range apm {
+			fn(next.ApmOptions)
+		}
+	}
+}
+
+// staticLogs returns o without the settings that can change at runtime.
+func staticLogs(o extDep.LogsOptions) extDep.LogsOptions {
+	o.Level, o.Modules = "", nil
+	return o
+}
+
+// runtimeLogs returns only the settings of o that can change at runtime.
+func runtimeLogs(o extDep.LogsOptions) extDep.LogsOptions {
+	return extDep.LogsOptions{Level: o.Level, Modules: o.Modules}
+}
+
+// staticFeature returns o without the settings that can change at runtime.
+func staticFeature(o extDep.FeatureOptions) extDep.FeatureOptions {
+	o.Cors, o.RateLimit, o.Flags = nil, nil, nil
+	return o
+}
+
+// runtimeFeature returns only the settings of o that can change at runtime.
+func runtimeFeature(o extDep.FeatureOptions) extDep.FeatureOptions {
+	return extDep.FeatureOptions{Cors: o.Cors, RateLimit: o.RateLimit, Flags: o.Flags}
+}
+
+// staticApm returns o without the settings that can change at runtime.
+func staticApm(o extDep.ApmOptions) extDep.ApmOptions {
+	o.SampleRate, o.TracesPerSecond, o.AlwaysSample, o.NeverSample = 0, 0, nil, nil
+	return o
+}
+
+// runtimeApm returns only the settings of o that can change at runtime.
+func runtimeApm(o extDep.ApmOptions) extDep.ApmOptions {
+	return extDep.ApmOptions{SampleRate: o.SampleRate, TracesPerSecond: o.TracesPerSecond, AlwaysSample: o.AlwaysSample, NeverSample: o.NeverSample}
+}
@@ -0,0 +1,114 @@
+package reload
+
+import (
+	"testing"
+	"time"
+
+	"github.com/767829413/normal-frame/internal/apiserver/options"
+	extDep "github.com/767829413/normal-frame/internal/pkg/options"
+)
+
+// recorder counts the notifications of each section.
+type recorder struct {
+	logs, feature, apm int
+}
+
+func subscribe(n *Notifier) *recorder {
+	r := &recorder{}
+	n.OnLogsChange(func(*extDep.LogsOptions) { r.logs++ })
+	n.OnFeatureChange(func(*extDep.FeatureOptions) { r.feature++ })
+	n.OnApmChange(func(*extDep.ApmOptions) { r.apm++ })
+	return r
+}
+
+func TestApply(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		change func(*options.Options)
+		want   recorder
+	}{
+		{name: "unchanged", change: func(*options.Options) {}},
+		{name: "static mysql", change: func(o *options.Options) { o.MySQLOptions.Host = "db:3306" }},
+		{name: "static logs", change: func(o *options.Options) { o.LogsOptions.Format = "json" }},
+		{name: "static feature", change: func(o *options.Options) { o.FeatureOptions.EnablePprof = !o.FeatureOptions.EnablePprof }},
+		{name: "static apm", change: func(o *options.Options) { o.ApmOptions.Address = "oap:11800" }},
+		{name: "static http client", change: func(o *options.Options) { o.HTTPClientOptions.Timeout = time.Minute }},
+		{name: "logs level", change: func(o *options.Options) { o.LogsOptions.Level = "debug" }, want: recorder{logs: 1}},
+		{name: "logs modules", change: func(o *options.Options) { o.LogsOptions.Modules = map[string]string{"mysql": "warn"} }, want: recorder{logs: 1}},
+		{name: "feature flags", change: func(o *options.Options) { o.FeatureOptions.Flags = map[string]bool{"checkout": true} }, want: recorder{feature: 1}},
+		{name: "rate limit", change: func(o *options.Options) { o.FeatureOptions.RateLimit.QPS++ }, want: recorder{feature: 1}},
+		{name: "apm sampling", change: func(o *options.Options) { o.ApmOptions.SampleRate = 0.5 }, want: recorder{apm: 1}},
+		{name: "static and runtime", change: func(o *options.Options) {
+			o.LogsOptions.Format, o.LogsOptions.Level = "json", "debug"
+			o.ApmOptions.NeverSample = []string{"/GET/healthcheck"}
+		}, want: recorder{logs: 1, apm: 1}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			n := NewNotifier(options.NewOptions())
+			r := subscribe(n)
+			next := options.NewOptions()
+			tt.change(next)
+			n.Apply(next)
+			if *r != tt.want {
+				t.Errorf("notifications = %+v, want %+v", *r, tt.want)
+			}
+			if n.Current() != next {
+				t.Error("the applied options are not the current ones")
+			}
+		})
+	}
+}
+
+func TestApplyPassesTheNewSection(t *testing.T) {
+	n := NewNotifier(options.NewOptions())
+	next := options.NewOptions()
+	next.LogsOptions.Level = "debug"
+	var got *extDep.LogsOptions
+	n.OnLogsChange(func(o *extDep.LogsOptions) { got = o })
+	n.Apply(next)
+	if got != next.LogsOptions {
+		t.Errorf("notified with %+v, want the reloaded logs section", got)
+	}
+
+	// applying the same options again notifies nobody
+	got = nil
+	n.Apply(next)
+	if got != nil {
+		t.Error("notified although nothing changed")
+	}
+}
+
+func TestSubscribersMayUseTheNotifier(t *testing.T) {
+	n := NewNotifier(options.NewOptions())
+	next := options.NewOptions()
+	next.FeatureOptions.Flags = map[string]bool{"checkout": true}
+	var current *options.Options
+	late := 0
+	n.OnFeatureChange(func(*extDep.FeatureOptions) {
+		current = n.Current()
+		n.OnFeatureChange(func(*extDep.FeatureOptions) { late++ })
+	})
+
+	done := make(chan struct{})
+	go func() {
+		n.Apply(next)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Apply deadlocked on a subscriber calling the notifier")
+	}
+	if current != next {
+		t.Error("subscribers do not see the applied options as the current ones")
+	}
+	if late != 0 {
+		t.Error("a subscriber added during a notification was notified of it")
+	}
+
+	again := options.NewOptions()
+	n.Apply(again)
+	if late != 1 {
+		t.Errorf("late subscriber notified %d times, want 1", late)
+	}
+}
@@ -1,17 +1,19 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"time"
 
-	gormPlugin "github.com/767829413/normal-frame/fork/SkyAPM/go2sky-plugins/gorm"
-
-	v3 "github.com/767829413/normal-frame/fork/SkyAPM/go2sky-plugins/gin/v3"
-	redisSkyHook "github.com/767829413/normal-frame/fork/SkyAPM/go2sky-plugins/redis-go2sky-hook"
 	"github.com/767829413/normal-frame/internal/apiserver/options"
+	"github.com/767829413/normal-frame/internal/pkg/config"
 	"github.com/767829413/normal-frame/internal/pkg/logger"
 	extDep "github.com/767829413/normal-frame/internal/pkg/options"
+	"github.com/767829413/normal-frame/internal/pkg/reload"
 	"github.com/767829413/normal-frame/internal/pkg/store"
 	"github.com/767829413/normal-frame/pkg/apm"
+	"github.com/767829413/normal-frame/pkg/certmanager"
+	"github.com/767829413/normal-frame/pkg/httpclient"
 	"github.com/767829413/normal-frame/pkg/shutdown"
 	"github.com/767829413/normal-frame/pkg/shutdown/shutdownmanagers/posixsignal"
 )
@@ -20,12 +22,17 @@ type ApiServer struct {
 	gs            *shutdown.GracefulShutdown
 	genericServer *genericServer
 	grpcServer    *grpcServer
+	certManager   *certmanager.Manager
+	notifier      *reload.Notifier
+	// closed is closed once the shutdown callback released the resources.
+	closed chan struct{}
 	*extDep.MySQLOptions
 	*extDep.RedisOptions
 	*extDep.ApmOptions
+	*extDep.HTTPClientOptions
 }
 
-func CreateAPIServer(opts *options.Options) (*ApiServer, error) {
+func CreateAPIServer(opts *options.Options, notifier *reload.Notifier) (*ApiServer, error) {
 	gs := shutdown.New()
 	gs.AddShutdownManager(posixsignal.NewPosixSignalManager())
 
@@ -37,19 +44,45 @@ func CreateAPIServer(opts *options.Options) (*ApiServer, error) {
 	if err != nil {
 		return nil, err
 	}
-	genericServer, err := NewGenericServer(genericConfig, extraConfig)
+	// HTTPS and gRPC share one certificate manager so a rotated pair is
+	// picked up by both servers at once.
+	var certManager *certmanager.Manager
+	if (extraConfig.EnableHttps || extraConfig.EnableGRPC) && extraConfig.CertFile != "" && extraConfig.KeyFile != "" {
+		clientAuth, err := certmanager.ParseClientAuth(extraConfig.ClientAuth)
+		if err != nil {
+			return nil, err
+		}
+		certManager, err = certmanager.New(extraConfig.CertFile, extraConfig.KeyFile,
+			certmanager.WithClientAuth(extraConfig.ClientCAFile, clientAuth))
+		if err != nil {
+			return nil, err
+		}
+	}
+	var httpTracer apm.Tracer
+	if opts.ApmOptions.Http {
+		httpTracer = apm.GetApmTracer(opts.ApmOptions)
+	}
+	genericServer, err := NewGenericServer(genericConfig, extraConfig, certManager, httpTracer)
 	if err != nil {
 		return nil, err
 	}
 	server := &ApiServer{
-		gs:            gs,
-		genericServer: genericServer,
-		MySQLOptions:  opts.MySQLOptions,
-		RedisOptions:  opts.RedisOptions,
-		ApmOptions:    opts.ApmOptions,
+		gs:                gs,
+		genericServer:     genericServer,
+		certManager:       certManager,
+		notifier:          notifier,
+		closed:            make(chan struct{}),
+		MySQLOptions:      opts.MySQLOptions,
+		RedisOptions:      opts.RedisOptions,
+		ApmOptions:        opts.ApmOptions,
+		HTTPClientOptions: opts.HTTPClientOptions,
 	}
 	if extraConfig.EnableGRPC {
-		extraServer, err := NewGrpcServer(extraConfig)
+		var tracer apm.Tracer
+		if opts.ApmOptions.Grpc {
+			tracer = apm.GetApmTracer(opts.ApmOptions)
+		}
+		extraServer, err := NewGrpcServer(extraConfig, certManager, tracer)
 		if err != nil {
 			return nil, err
 		}
@@ -65,20 +98,12 @@ func (s *ApiServer) setGrpcServer(grpcServer *grpcServer) {
 
 func (s *ApiServer) PrepareRun() *ApiServer {
 	tracer := apm.GetApmTracer(s.ApmOptions)
-	if s.ApmOptions.Http && tracer != nil {
-		s.genericServer.Use(v3.Middleware(s.genericServer.Engine, tracer.Tracer))
-	}
 
 	//初始化外部依赖 数据库,redis等等
 	st := store.GetMySQLIncOr(s.MySQLOptions)
 	if st != nil {
 		if s.ApmOptions.Mysql && tracer != nil {
-			err := st.GetDb().Use(gormPlugin.New(tracer.Tracer,
-				gormPlugin.WithPeerAddr(fmt.Sprintf("%s:%d", s.MySQLOptions.Host, s.MySQLOptions.Port)),
-				gormPlugin.WithSqlDBType(gormPlugin.MYSQL),
-				gormPlugin.WithParamReport(),
-				gormPlugin.WithQueryReport(),
-			))
+			err := st.GetDb().Use(tracer.GormPlugin(fmt.Sprintf("%s:%d", s.MySQLOptions.Host, s.MySQLOptions.Port)))
 			if err != nil {
 				logger.LogErrorf(nil, logger.LogNameMysql, "mysql set apm plugin,error: %v", err)
 			}
@@ -87,15 +112,47 @@ func (s *ApiServer) PrepareRun() *ApiServer {
 
 	}
 
+	// 调用其他服务的http客户端
+	var clientTracer apm.Tracer
+	if s.ApmOptions.HttpClient {
+		clientTracer = tracer
+	}
+	httpclient.GetClientOr(s.HTTPClientOptions, clientTracer)
+
+	// 配置热更新
+	s.notifier.OnLogsChange(func(o *extDep.LogsOptions) {
+		if err := logger.SetLevels(o.Level, o.Modules); err != nil {
+			logger.LogErrorf(nil, logger.LogNameDefault, "reload log level failed: %v", err)
+		}
+	})
+	s.notifier.OnFeatureChange(func(o *extDep.FeatureOptions) {
+		c := config.NewGenericConfig()
+		_ = o.ApplyTo(c)
+		s.genericServer.UpdateFeatures(c)
+	})
+	s.notifier.OnApmChange(func(o *extDep.ApmOptions) {
+		if tracer != nil {
+			tracer.SetSampling(o)
+		}
+	})
+
 	r := store.GetRedisIncOr(s.RedisOptions)
 	if r != nil {
 		if s.ApmOptions.Redis && tracer != nil {
-			r.Getclient().AddHook(redisSkyHook.NewSkyWalkingHook(tracer.Tracer))
+			r.Getclient().AddHook(tracer.RedisHook())
 		}
 	}
 
 	// 优雅关停
+	// 关停开始时先把队列中的日志发送到redis
 	s.gs.AddShutdownCallback(shutdown.ShutdownFunc(func(string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return logger.Flush(ctx)
+	}))
+	s.gs.AddShutdownCallback(shutdown.ShutdownFunc(func(string) error {
+		defer close(s.closed)
+
 		tr := apm.GetApmTracer(nil)
 		if tr != nil {
 			_ = tr.Close()
@@ -111,6 +168,10 @@ func (s *ApiServer) PrepareRun() *ApiServer {
 			_ = r.Close()
 		}
 
+		if c := httpclient.GetClientOr(nil, nil); c != nil {
+			c.CloseIdleConnections()
+		}
+
 		if s.genericServer != nil {
 			s.genericServer.Close()
 		}
@@ -119,6 +180,11 @@ func (s *ApiServer) PrepareRun() *ApiServer {
 			s.grpcServer.Close()
 		}
 
+		if s.certManager != nil {
+			_ = s.certManager.Close()
+		}
+
+		_ = logger.Close()
 		return nil
 	}))
 	return s
@@ -128,9 +194,20 @@ func (s *ApiServer) Run() error {
 	if s.grpcServer != nil && s.grpcServer.enable {
 		go s.grpcServer.Run()
 	}
+	if s.certManager != nil {
+		if err := s.certManager.Watch(); err != nil {
+			logger.LogErrorf(nil, logger.LogNameNet, "watch tls certificates failed: %s", err.Error())
+		}
+	}
 	// start shutdown managers
 	if err := s.gs.Start(); err != nil {
 		logger.LogErrorf(nil, logger.LogNameNet, "start shutdown manager failed: %s", err.Error())
 	}
-	return s.genericServer.Run()
+	if err := s.genericServer.Run(); err != nil {
+		return err
+	}
+	// the http server stops as soon as shutdown begins, wait for the resources
+	// to be released and the logs to be flushed before returning
+	<-s.closed
+	return nil
 }
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky"
+	"github.com/767829413/normal-frame/internal/apiserver/options"
+	"github.com/767829413/normal-frame/internal/pkg/logger"
+	extDep "github.com/767829413/normal-frame/internal/pkg/options"
+	"github.com/767829413/normal-frame/internal/pkg/reload"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPIServerTracesRequests(t *testing.T) {
+	opts := options.NewOptions()
+	opts.GenericServerRunOptions.Mode = gin.TestMode
+	opts.ApmOptions.Enabled, opts.ApmOptions.Http = true, true
+	opts.ApmOptions.Reporter = extDep.ApmReporterNoop
+	opts.ApmOptions.Sampler = extDep.ApmSamplerConst
+	s, err := CreateAPIServer(opts, reload.NewNotifier(opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// routes registered after the server was created, as the ones of the
+	// application, run behind the middlewares too
+	var traceID, requestID string
+	s.genericServer.GET("/v1/probe", func(c *gin.Context) {
+		traceID = go2sky.TraceID(c.Request.Context())
+		requestID = logger.RequestID(c.Request.Context())
+	})
+	w := httptest.NewRecorder()
+	s.genericServer.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/probe", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if traceID == "" || traceID == go2sky.EmptyTraceID || traceID == go2sky.NoopTraceID {
+		t.Errorf("trace ID = %q, want the request traced", traceID)
+	}
+	if requestID == "" || requestID != w.Header().Get(logger.RequestIDHeader) {
+		t.Errorf("request ID = %q, want the one of the request logger", requestID)
+	}
+}
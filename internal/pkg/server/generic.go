@@ -9,10 +9,15 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/767829413/normal-frame/internal/apiserver/controller/v1/logging"
 	"github.com/767829413/normal-frame/internal/apiserver/options"
 	customerRouter "github.com/767829413/normal-frame/internal/apiserver/router"
 	"github.com/767829413/normal-frame/internal/pkg/config"
+	"github.com/767829413/normal-frame/internal/pkg/logger"
+	"github.com/767829413/normal-frame/pkg/apm"
+	"github.com/767829413/normal-frame/pkg/certmanager"
 	"github.com/767829413/normal-frame/pkg/middleware"
+	"github.com/767829413/normal-frame/pkg/version"
 	"github.com/gin-contrib/pprof"
 	"github.com/gin-gonic/gin"
 	ginprometheus "github.com/zsais/go-gin-prometheus"
@@ -27,12 +32,17 @@ type genericServer struct {
 	gzipLevel     int
 	enableMetrics bool
 	enablePprof   bool
+	enableAdmin   bool
+	adminIDs      []string
+	corsOrigins   *middleware.CorsOrigins
+	rateLimiter   *middleware.RateLimiter
+	accessLog     config.AccessLogConfig
+	tracer        apm.Tracer
 
 	enableHttps  bool
 	httpsAddress string
 	httpsPort    int
-	certFile     string
-	keyFile      string
+	certManager  *certmanager.Manager
 
 	// ShutdownTimeout is the timeout used for server shutdown. This specifies the timeout before server
 	// gracefully shutdown returns.
@@ -41,7 +51,10 @@ type genericServer struct {
 	http, https *http.Server
 }
 
-func NewGenericServer(genericConfig *config.GenericConfig, extraConfig *config.ExtraConfig) (*genericServer, error) {
+// NewGenericServer creates the HTTP server, the requests are traced when a
+// tracer is given.
+func NewGenericServer(genericConfig *config.GenericConfig, extraConfig *config.ExtraConfig, certManager *certmanager.Manager,
+	tracer apm.Tracer) (*genericServer, error) {
 	// setMode before gin.New()
 	gin.SetMode(genericConfig.Mode)
 
@@ -53,11 +66,16 @@ func NewGenericServer(genericConfig *config.GenericConfig, extraConfig *config.E
 		gzipLevel:     genericConfig.GzipLevel,
 		enableMetrics: genericConfig.EnableMetrics,
 		enablePprof:   genericConfig.EnablePprof,
+		enableAdmin:   genericConfig.EnableAdmin,
+		adminIDs:      genericConfig.AdminIdentities,
+		corsOrigins:   middleware.NewCorsOrigins(genericConfig.CorsAllowOrigins),
+		rateLimiter:   middleware.NewRateLimiter(genericConfig.RateLimitEnabled, genericConfig.RateLimitQPS, genericConfig.RateLimitBurst),
+		accessLog:     genericConfig.AccessLog,
+		tracer:        tracer,
 		enableHttps:   extraConfig.EnableHttps,
 		httpsAddress:  extraConfig.HttpsAddress,
 		httpsPort:     extraConfig.HttpsPort,
-		certFile:      extraConfig.CertFile,
-		keyFile:       extraConfig.KeyFile,
+		certManager:   certManager,
 		Engine:        gin.New(),
 	}
 	s.initGenericAPIServer()
@@ -82,8 +100,19 @@ func (s *genericServer) InstallMiddlewares() {
 	if s.enabledGzip {
 		s.Use(middleware.Gzip(s.gzipLevel))
 	}
-	s.Use(middleware.Dump())
-	s.Use(middleware.Cors())
+	// the request logger reads the client identity and the trace context, the
+	// access log needs the request logger and sees the requests rejected by the
+	// next middlewares
+	if s.certManager != nil {
+		s.Use(middleware.ClientIdentity())
+	}
+	if s.tracer != nil {
+		s.Use(s.tracer.GinMiddleware(s.Engine))
+	}
+	s.Use(logger.Middleware())
+	s.Use(logger.AccessLog(s.accessLog))
+	s.Use(s.rateLimiter.Handler())
+	s.Use(middleware.Cors(s.corsOrigins))
 	s.Use(middleware.Recovery())
 	// install custom middlewares
 	for k, m := range middleware.Middlewares {
@@ -92,6 +121,13 @@ func (s *genericServer) InstallMiddlewares() {
 	}
 }
 
+// UpdateFeatures applies the feature settings that can change while the
+// server is running.
+func (s *genericServer) UpdateFeatures(c *config.GenericConfig) {
+	s.corsOrigins.Set(c.CorsAllowOrigins)
+	s.rateLimiter.Update(c.RateLimitEnabled, c.RateLimitQPS, c.RateLimitBurst)
+}
+
 func (s *genericServer) InstallAPIs() {
 	// install healthz handler
 	if s.healthz {
@@ -104,6 +140,7 @@ func (s *genericServer) InstallAPIs() {
 	if s.enableMetrics {
 		prometheus := ginprometheus.NewPrometheus("gin")
 		prometheus.Use(s.Engine)
+		version.RegisterMetric()
 	}
 
 	// install pprof handler
@@ -111,6 +148,15 @@ func (s *genericServer) InstallAPIs() {
 		pprof.Register(s.Engine)
 	}
 
+	// install admin handlers, only served to verified client certificates
+	if s.enableAdmin {
+		levelController := logging.NewLevelController()
+		admin := s.Group("/admin", middleware.RequireIdentity(s.adminIDs))
+		admin.GET("/log-levels", levelController.Get)
+		admin.PUT("/log-levels", levelController.Update)
+		admin.DELETE("/log-levels", levelController.Revert)
+	}
+
 	// install customer API
 	customerRouter.InitRouter(s.Engine)
 }
@@ -142,11 +188,12 @@ func (s *genericServer) Run() error {
 		return nil
 	})
 
-	if s.enableHttps && (s.certFile != "" && s.keyFile != "" && s.httpsPort != 0) {
+	if s.enableHttps && (s.certManager != nil && s.httpsPort != 0) {
 		httpsAddr := net.JoinHostPort(s.httpsAddress, strconv.Itoa(s.httpsPort))
 		s.https = &http.Server{
-			Addr:    httpsAddr,
-			Handler: s,
+			Addr:      httpsAddr,
+			Handler:   s,
+			TLSConfig: s.certManager.TLSConfig(),
 			// ReadTimeout:    10 * time.Second,
 			// WriteTimeout:   10 * time.Second,
 			// MaxHeaderBytes: 1 << 20,
@@ -154,7 +201,7 @@ func (s *genericServer) Run() error {
 
 		eg.Go(func() error {
 			log.Printf("Start to listening the incoming requests on https address: %s", httpsAddr)
-			if err := s.https.ListenAndServeTLS(s.certFile, s.keyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			if err := s.https.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				log.Printf("Start to listening the incoming requests on https failed : %s", err.Error())
 				return err
 			}
@@ -199,6 +246,10 @@ func buildGenericConfig(opts *options.Options) (genericConfig *config.GenericCon
 	if lastErr = opts.FeatureOptions.ApplyTo(genericConfig); lastErr != nil {
 		return
 	}
+
+	if lastErr = opts.LogsOptions.ApplyTo(genericConfig); lastErr != nil {
+		return
+	}
 	return
 }
 
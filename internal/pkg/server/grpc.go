@@ -3,10 +3,14 @@ package server
 import (
 	"log"
 	"net"
+	"strconv"
 
 	"github.com/767829413/normal-frame/internal/pkg/config"
 	"github.com/767829413/normal-frame/internal/pkg/logger"
+	"github.com/767829413/normal-frame/pkg/apm"
+	"github.com/767829413/normal-frame/pkg/certmanager"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 type grpcServer struct {
@@ -15,23 +19,39 @@ type grpcServer struct {
 	address string
 }
 
-func NewGrpcServer(extraConfig *config.ExtraConfig) (*grpcServer, error) {
-	// creds, err := credentials.NewServerTLSFromFile(extraConfig.CertFile, extraConfig.KeyFile)
-	// if err != nil {
-	// 	logger.LogErrorf(nil,logger.LogNameGRpc,"Failed to generate credentials %s", err.Error())
-	// }
-	// opts := []grpc.ServerOption{grpc.MaxRecvMsgSize(extraConfig.MaxMsgSize), grpc.Creds(creds)}
-	// storeIns := mysql.GetMySQLIncOr(c.mysqlOptions)
-	// storeIns, _ := etcd.GetEtcdFactoryOr(c.etcdOptions, nil)
-	// store.SetClient(storeIns)
-
-	return nil, nil
+// NewGrpcServer creates the grpc server, when a certificate manager is given
+// the server is secured with the same certificates as the HTTPS server. The
+// calls are traced when a tracer is given.
+func NewGrpcServer(extraConfig *config.ExtraConfig, certManager *certmanager.Manager, tracer apm.Tracer) (*grpcServer, error) {
+	opts := []grpc.ServerOption{grpc.MaxRecvMsgSize(extraConfig.MaxMsgSize)}
+	var unary []grpc.UnaryServerInterceptor
+	var stream []grpc.StreamServerInterceptor
+	if certManager != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(certManager.TLSConfig())))
+		unary = append(unary, certmanager.UnaryServerInterceptor())
+		stream = append(stream, certmanager.StreamServerInterceptor())
+	}
+	if tracer != nil {
+		unary = append(unary, tracer.UnaryServerInterceptor())
+		stream = append(stream, tracer.StreamServerInterceptor())
+	}
+	// the logger reads the client identity, it runs after certmanager
+	unary = append(unary, logger.UnaryServerInterceptor())
+	stream = append(stream, logger.StreamServerInterceptor())
+	opts = append(opts, grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...))
+
+	return &grpcServer{
+		enable:  extraConfig.EnableGRPC,
+		Server:  grpc.NewServer(opts...),
+		address: net.JoinHostPort(extraConfig.GrpcAddress, strconv.Itoa(extraConfig.GrpcPort)),
+	}, nil
 }
 
 func (s *grpcServer) Run() {
 	listen, err := net.Listen("tcp", s.address)
 	if err != nil {
 		logger.LogErrorf(nil, logger.LogNameGRpc, "failed to listen: %s", err.Error())
+		return
 	}
 
 	go func() {
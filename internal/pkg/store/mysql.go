@@ -14,7 +14,10 @@ import (
 
 var (
 	dbHandler *datastore
-	once      sync.Once
+	// dbErr is the error of the connection, it is returned by every call
+	// once the connection failed
+	dbErr error
+	once  sync.Once
 )
 
 type datastore struct {
@@ -27,20 +30,29 @@ type datastore struct {
 
 // GetMySQLIncOr create mysql factory with the given config.
 func GetMySQLIncOr(opts *options.MySQLOptions) *datastore {
+	ds, err := GetMySQLFactoryOr(opts)
+	if err != nil {
+		panic(fmt.Sprintf("GetMySQLIncOr err : %v", err))
+	}
+	return ds
+}
+
+// GetMySQLFactoryOr is GetMySQLIncOr returning the connection error instead
+// of panicking. It returns nil when mysql is not enabled.
+func GetMySQLFactoryOr(opts *options.MySQLOptions) (*datastore, error) {
 	if dbHandler != nil {
-		return dbHandler
+		return dbHandler, nil
 	}
 	if opts != nil && !opts.Enabled {
-		return nil
+		return nil, nil
 	}
 	if opts == nil && dbHandler == nil {
-		return nil
+		return nil, nil
 	}
-	var err error
-	var dbIns *gorm.DB
 	once.Do(func() {
 		options := &db.Options{
 			Host:                  opts.Host,
+			Port:                  opts.Port,
 			Username:              opts.Username,
 			Password:              opts.Password,
 			Database:              opts.Database,
@@ -48,15 +60,19 @@ func GetMySQLIncOr(opts *options.MySQLOptions) *datastore {
 			MaxOpenConnections:    opts.MaxOpenConnections,
 			MaxConnectionLifeTime: opts.MaxConnectionLifeTime,
 			LogLevel:              opts.LogLevel,
+			IsDebug:               opts.IsDebug,
+		}
+		dbIns, err := db.New(options)
+		if err != nil {
+			dbErr = err
+			return
 		}
-		dbIns, err = db.New(options)
 		dbHandler = &datastore{dbIns}
 	})
-	if err != nil {
-		panic(fmt.Sprintf("GetMySQLIncOr err : %v", err))
+	if dbErr != nil {
+		return nil, dbErr
 	}
-	return dbHandler
-
+	return dbHandler, nil
 }
 
 func (d *datastore) GetDb() *gorm.DB {
@@ -0,0 +1,33 @@
+package store
+
+import (
+	"net"
+	"testing"
+
+	"github.com/767829413/normal-frame/internal/pkg/options"
+)
+
+func TestGetMySQLFactoryOrKeepsTheError(t *testing.T) {
+	// a port nothing listens on
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := lis.Addr().(*net.TCPAddr).Port
+	lis.Close()
+
+	opts := options.NewMySQLOptions()
+	opts.Enabled, opts.Port = true, port
+	opts.Username, opts.Database = "root", "shop"
+	for i := 0; i < 3; i++ {
+		st, err := GetMySQLFactoryOr(opts)
+		if err == nil || st != nil {
+			t.Fatalf("call %d = %v, %v, want the connection error", i+1, st, err)
+		}
+	}
+
+	opts.Enabled = false
+	if st, err := GetMySQLFactoryOr(opts); st != nil || err != nil {
+		t.Errorf("mysql disabled = %v, %v, want neither a store nor an error", st, err)
+	}
+}
@@ -1,54 +1,169 @@
 package apm
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky"
+	v3 "github.com/767829413/normal-frame/fork/SkyAPM/go2sky-plugins/gin/v3"
+	gormPlugin "github.com/767829413/normal-frame/fork/SkyAPM/go2sky-plugins/gorm"
+	grpcPlugin "github.com/767829413/normal-frame/fork/SkyAPM/go2sky-plugins/grpc"
+	redisSkyHook "github.com/767829413/normal-frame/fork/SkyAPM/go2sky-plugins/redis-go2sky-hook"
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky/propagation"
+	go2skyreporter "github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter"
+	agentv3 "github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter/grpc/language-agent"
 	"github.com/767829413/normal-frame/pkg/apm/reporter"
+	"github.com/gin-gonic/gin"
+	goredis "github.com/go-redis/redis/v8"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"gorm.io/gorm"
 
-	//"go-api-frame/pkg/SkyAPM/go2sky/reporter"
 	"github.com/767829413/normal-frame/internal/pkg/logger"
 	"github.com/767829413/normal-frame/internal/pkg/options"
 	"github.com/767829413/normal-frame/pkg/util"
+	"github.com/767829413/normal-frame/pkg/version"
 )
 
 var (
 	re     go2sky.Reporter
 	once   sync.Once
-	tracer *tracerInc
+	tracer Tracer
 )
 
+// Tracer traces the HTTP and gRPC servers and the MySQL and Redis clients,
+// whatever the backend the spans are reported to.
+type Tracer interface {
+	// GinMiddleware starts a span for each request of engine.
+	GinMiddleware(engine *gin.Engine) gin.HandlerFunc
+	// UnaryServerInterceptor and StreamServerInterceptor start a span for each
+	// gRPC call.
+	UnaryServerInterceptor() grpc.UnaryServerInterceptor
+	StreamServerInterceptor() grpc.StreamServerInterceptor
+	// GormPlugin starts a span for each statement sent to the MySQL server at
+	// peer.
+	GormPlugin(peer string) gorm.Plugin
+	// RedisHook starts a span for each Redis command and pipeline.
+	RedisHook() goredis.Hook
+	// StartHTTPClient starts an exit span named operation for the outgoing
+	// request req and writes its trace context in the headers of req. The
+	// returned function ends the span with the response or the error of req.
+	StartHTTPClient(req *http.Request, operation string) func(resp *http.Response, err error)
+	// SetSampling applies the sample rate, traces per second and operation
+	// lists of opts, the sampling strategy cannot change.
+	SetSampling(opts *options.ApmOptions)
+	// Close flushes the spans not reported yet.
+	Close() error
+}
+
+// tracerInc reports the spans to SkyWalking.
 type tracerInc struct {
+	*sampling
 	mutex  sync.Mutex
 	Tracer *go2sky.Tracer
 }
 
-func GetApmTracer(opts *options.ApmOptions) *tracerInc {
+// GetApmTracer returns the tracer of opts, created on the first call. The
+// otlp reporter exports the spans with OpenTelemetry, the other ones with
+// go2sky.
+func GetApmTracer(opts *options.ApmOptions) Tracer {
 	if opts != nil && !opts.Enabled {
 		return nil
 	}
 	if opts == nil && tracer == nil {
 		return nil
 	}
-	var err error
 	once.Do(func() {
-		// 	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter"
-		//re, err := reporter.NewGRPCReporter(confer.GetGlobalConfig().APM.Addr)
-		re, err = reporter.NewSidecarReporter(opts.Address)
-		if err != nil {
+		if strings.ToLower(opts.Reporter) == options.ApmReporterOTLP {
+			t, err := newOTelTracer(opts)
+			if err != nil {
+				logger.LogErrorf(nil, logger.LogNameDefault, "apm %s reporter: %v", opts.Reporter, err)
+				return
+			}
+			tracer = t
 			return
 		}
-		tmpTra, err := go2sky.NewTracer(util.GetUniqueID(), go2sky.WithReporter(re))
+		var err error
+		re, err = newReporter(opts)
+		if err != nil {
+			// 上报端不可用时仍然创建tracer, 日志中保留链路信息
+			logger.LogErrorf(nil, logger.LogNameDefault, "apm %s reporter: %v, the traces are not reported", opts.Reporter, err)
+			re = reporter.NewNoopReporter()
+		}
+		t := &tracerInc{sampling: newSampling(opts)}
+		tmpTra, err := go2sky.NewTracer(util.GetUniqueID(), go2sky.WithReporter(re), go2sky.WithCustomSampler(t.sampler),
+			go2sky.WithPropagator(newPropagator(opts.Propagators)))
 		if err != nil {
-			logger.LogErrorf(nil, logger.LogNameAmq, "once.Do GetApmTracer: %v", err)
+			logger.LogErrorf(nil, logger.LogNameDefault, "apm tracer: %v", err)
 			return
 		}
-		tracer = &tracerInc{Tracer: tmpTra}
+		t.Tracer = tmpTra
+		tracer = t
 		//defer re.Close()
 	})
 	return tracer
 }
 
+func (t *tracerInc) GinMiddleware(engine *gin.Engine) gin.HandlerFunc {
+	return v3.Middleware(engine, t.Tracer)
+}
+
+func (t *tracerInc) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return grpcPlugin.UnaryServerInterceptor(t.Tracer)
+}
+
+func (t *tracerInc) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return grpcPlugin.StreamServerInterceptor(t.Tracer)
+}
+
+func (t *tracerInc) GormPlugin(peer string) gorm.Plugin {
+	return gormPlugin.New(t.Tracer,
+		gormPlugin.WithPeerAddr(peer),
+		gormPlugin.WithSqlDBType(gormPlugin.MYSQL),
+		gormPlugin.WithParamReport(),
+		gormPlugin.WithQueryReport(),
+	)
+}
+
+func (t *tracerInc) RedisHook() goredis.Hook {
+	return redisSkyHook.NewSkyWalkingHook(t.Tracer)
+}
+
+// componentIDGoHttpClient is the SkyWalking component of the net/http client.
+const componentIDGoHttpClient = 5005
+
+func (t *tracerInc) StartHTTPClient(req *http.Request, operation string) func(*http.Response, error) {
+	span, err := t.Tracer.CreateExitSpan(req.Context(), operation, req.URL.Host, func(key, value string) error {
+		req.Header.Set(key, value)
+		return nil
+	})
+	if err != nil {
+		return func(*http.Response, error) {}
+	}
+	span.SetComponent(componentIDGoHttpClient)
+	span.SetSpanLayer(agentv3.SpanLayer_Http)
+	span.Tag(go2sky.TagHTTPMethod, req.Method)
+	span.Tag(go2sky.TagURL, req.URL.Host+req.URL.Path)
+	return func(resp *http.Response, err error) {
+		if err != nil {
+			span.Error(time.Now(), err.Error())
+		} else {
+			span.Tag(go2sky.TagStatusCode, strconv.Itoa(resp.StatusCode))
+			if resp.StatusCode >= http.StatusBadRequest {
+				span.Error(time.Now(), resp.Status)
+			}
+		}
+		span.End()
+	}
+}
+
 func (t *tracerInc) Close() error {
 	defer t.mutex.Unlock()
 	t.mutex.Lock()
@@ -57,3 +172,136 @@ func (t *tracerInc) Close() error {
 	}
 	return nil
 }
+
+// newPropagator returns the propagator of the formats names, in their order
+// of priority.
+func newPropagator(names []string) propagation.Propagator {
+	propagators := make([]propagation.Propagator, 0, len(names))
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case options.ApmPropagatorSW8:
+			propagators = append(propagators, propagation.SW8)
+		case options.ApmPropagatorTraceContext:
+			propagators = append(propagators, propagation.W3C)
+		case options.ApmPropagatorB3:
+			propagators = append(propagators, propagation.B3)
+		case options.ApmPropagatorB3Multi:
+			propagators = append(propagators, propagation.B3Multi)
+		}
+	}
+	if len(propagators) == 1 {
+		return propagators[0]
+	}
+	return propagation.NewCompositePropagator(propagators...)
+}
+
+// newReporter returns the reporter selected by opts. The sidecar and grpc
+// reporters connect in the background, so they are created while the backend
+// is down.
+func newReporter(opts *options.ApmOptions) (go2sky.Reporter, error) {
+	props := instanceProps(opts)
+	switch strings.ToLower(opts.Reporter) {
+	case options.ApmReporterGRPC:
+		grpcOpts := []go2skyreporter.GRPCReporterOption{
+			go2skyreporter.WithInstanceProps(props),
+			go2skyreporter.WithMaxSendQueueSize(opts.QueueSize),
+		}
+		if opts.Authentication != "" {
+			grpcOpts = append(grpcOpts, go2skyreporter.WithAuthentication(opts.Authentication))
+		}
+		if opts.TLS.Enabled {
+			creds, err := transportCredentials(opts.TLS)
+			if err != nil {
+				return nil, err
+			}
+			grpcOpts = append(grpcOpts, go2skyreporter.WithTransportCredentials(creds))
+		}
+		return go2skyreporter.NewGRPCReporter(opts.Address, grpcOpts...)
+	case options.ApmReporterLog:
+		return go2skyreporter.NewLogReporter()
+	case options.ApmReporterNoop:
+		return reporter.NewNoopReporter(), nil
+	default:
+		r, err := reporter.NewSidecarReporter(opts.Address, reporter.WithInstanceProps(props), reporter.WithQueueSize(opts.QueueSize))
+		if err != nil {
+			return nil, err
+		}
+		registerMetrics(r)
+		return r, nil
+	}
+}
+
+// instanceProps returns the build information and the instance properties of
+// opts.
+func instanceProps(opts *options.ApmOptions) map[string]string {
+	props := version.Get().Labels()
+	for k, v := range opts.InstanceProperties {
+		props[k] = v
+	}
+	return props
+}
+
+func transportCredentials(o *options.ApmTLS) (credentials.TransportCredentials, error) {
+	cfg, err := tlsConfig(o)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+func tlsConfig(o *options.ApmTLS) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify, //nolint:gosec // opt-in for tests
+		MinVersion:         tls.VersionTLS12,
+	}
+	if o.CAFile != "" {
+		data, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA bundle %s: %w", o.CAFile, err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", o.CAFile)
+		}
+	}
+	return cfg, nil
+}
+
+// sampling decides which operations start a trace, for both tracers. Its
+// rates and operation lists are changed when the configuration is reloaded.
+type sampling struct {
+	sampler *go2sky.OperationSampler
+	// random or limiter is the sampler of the strategy, to change its rate.
+	random  *go2sky.RandomSampler
+	limiter *go2sky.RateLimitingSampler
+}
+
+// newSampling returns the sampler of the strategy of opts with its operation
+// lists.
+func newSampling(opts *options.ApmOptions) *sampling {
+	s := &sampling{}
+	var sampler go2sky.Sampler
+	switch strings.ToLower(opts.Sampler) {
+	case options.ApmSamplerConst:
+		sampler = go2sky.NewConstSampler(true)
+	case options.ApmSamplerRateLimiting:
+		s.limiter = go2sky.NewRateLimitingSampler(opts.TracesPerSecond)
+		sampler = s.limiter
+	default:
+		s.random = go2sky.NewRandomSampler(opts.SampleRate)
+		sampler = s.random
+	}
+	s.sampler = go2sky.NewOperationSampler(sampler, opts.AlwaysSample, opts.NeverSample)
+	return s
+}
+
+func (s *sampling) SetSampling(opts *options.ApmOptions) {
+	s.sampler.SetOperations(opts.AlwaysSample, opts.NeverSample)
+	if s.random != nil {
+		s.random.SetSamplingRate(opts.SampleRate)
+	}
+	if s.limiter != nil {
+		s.limiter.SetTracesPerSecond(opts.TracesPerSecond)
+	}
+}
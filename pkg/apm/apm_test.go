@@ -0,0 +1,94 @@
+package apm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky"
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky/propagation"
+	"github.com/767829413/normal-frame/internal/pkg/options"
+	"github.com/767829413/normal-frame/pkg/apm/reporter"
+)
+
+func TestNewReporterBackendDown(t *testing.T) {
+	for _, tt := range []struct {
+		reporter, address string
+	}{
+		{options.ApmReporterSidecar, filepath.Join(t.TempDir(), "missing.sock")},
+		{options.ApmReporterGRPC, "127.0.0.1:1"},
+		{options.ApmReporterLog, ""},
+		{options.ApmReporterNoop, ""},
+	} {
+		opts := options.NewApmOptions()
+		opts.Reporter, opts.Address = tt.reporter, tt.address
+		opts.InstanceProperties = map[string]string{"region": "eu"}
+		r, err := newReporter(opts)
+		if err != nil || r == nil {
+			t.Errorf("%s reporter: %v, want it created while the backend is down", tt.reporter, err)
+			continue
+		}
+		r.Close()
+	}
+
+	opts := options.NewApmOptions()
+	opts.Reporter, opts.Address = options.ApmReporterGRPC, "127.0.0.1:1"
+	opts.TLS.Enabled, opts.TLS.CAFile = true, filepath.Join(t.TempDir(), "missing.pem")
+	if _, err := newReporter(opts); err == nil {
+		t.Error("grpc reporter created with a missing CA bundle")
+	}
+}
+
+func TestStartHTTPClient(t *testing.T) {
+	tr, err := go2sky.NewTracer("orders", go2sky.WithReporter(reporter.NewNoopReporter()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := &tracerInc{sampling: newSampling(options.NewApmOptions()), Tracer: tr}
+
+	req := httptest.NewRequest(http.MethodGet, "http://users:8080/v1/users/42", nil)
+	end := tracer.StartHTTPClient(req, "/GET/v1/users/:id")
+	end(&http.Response{StatusCode: http.StatusOK}, nil)
+
+	if _, ok := req.Header[http.CanonicalHeaderKey(propagation.HeaderCorrelation)]; !ok {
+		t.Errorf("headers = %v, want %s", req.Header, propagation.HeaderCorrelation)
+	}
+	var tc propagation.SpanContext
+	if err := tc.Decode(func(key string) (string, error) { return req.Header.Get(key), nil }); err != nil {
+		t.Fatal(err)
+	}
+	if tc.ParentService != "orders" || tc.AddressUsedAtClient != "users:8080" {
+		t.Errorf("sw8 context = %+v", tc)
+	}
+}
+
+func TestTraceStatePassedOn(t *testing.T) {
+	tr, err := go2sky.NewTracer("orders", go2sky.WithReporter(reporter.NewNoopReporter()),
+		go2sky.WithPropagator(newPropagator([]string{options.ApmPropagatorTraceContext})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := &tracerInc{sampling: newSampling(options.NewApmOptions()), Tracer: tr}
+
+	in := http.Header{}
+	in.Set(propagation.HeaderTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	in.Set(propagation.HeaderTraceState, "congo=t61rcWkgMzE,sw8=stale")
+	span, ctx, _, err := tr.CreateEntrySpan(context.Background(), "/GET/v1/orders", func(key string) (string, error) {
+		return in.Get(key), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer span.End()
+
+	req := httptest.NewRequest(http.MethodGet, "http://users:8080/v1/users/42", nil).WithContext(ctx)
+	end := tracer.StartHTTPClient(req, "/GET/v1/users/:id")
+	end(&http.Response{StatusCode: http.StatusOK}, nil)
+	members := strings.Split(req.Header.Get(propagation.HeaderTraceState), ",")
+	if len(members) != 2 || !strings.HasPrefix(members[0], "sw8=") || members[0] == "sw8=stale" || members[1] != "congo=t61rcWkgMzE" {
+		t.Errorf("tracestate = %v, want the sw8 entry of the exit span and the congo member", members)
+	}
+}
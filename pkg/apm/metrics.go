@@ -0,0 +1,36 @@
+package apm
+
+import (
+	"sync"
+
+	"github.com/767829413/normal-frame/pkg/apm/reporter"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var registerOnce sync.Once
+
+// registerMetrics exposes the counters of the sidecar reporter r.
+func registerMetrics(r *reporter.SidecarReporter) {
+	registerOnce.Do(func() {
+		prometheus.MustRegister(
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "apm_sidecar_queue_length",
+				Help: "Number of trace segments waiting to be sent to the sidecar.",
+			}, func() float64 { return float64(r.Stats().Queued) }),
+			segmentCounter("sent", func() uint64 { return r.Stats().Sent }),
+			segmentCounter("dropped", func() uint64 { return r.Stats().Dropped }),
+			prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name: "apm_sidecar_reconnects_total",
+				Help: "Number of times the connection to the sidecar was established again after it failed.",
+			}, func() float64 { return float64(r.Stats().Reconnects) }),
+		)
+	})
+}
+
+func segmentCounter(result string, value func() uint64) prometheus.CounterFunc {
+	return prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name:        "apm_sidecar_segments_total",
+		Help:        "Number of trace segments by result of the send to the sidecar.",
+		ConstLabels: prometheus.Labels{"result": result},
+	}, func() float64 { return float64(value()) })
+}
@@ -0,0 +1,241 @@
+package apm
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky"
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky/propagation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	otelpropagation "go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/767829413/normal-frame/internal/pkg/options"
+	"github.com/767829413/normal-frame/pkg/util"
+)
+
+const instrumentationName = "github.com/767829413/normal-frame/pkg/apm"
+
+// otelTracer exports the spans with OpenTelemetry over OTLP. The spans are
+// named, sampled and propagated like the SkyWalking ones.
+type otelTracer struct {
+	*sampling
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	propagator otelpropagation.TextMapPropagator
+}
+
+func newOTelTracer(opts *options.ApmOptions) (*otelTracer, error) {
+	exporter, err := newOTLPExporter(opts)
+	if err != nil {
+		return nil, err
+	}
+	service := util.GetUniqueID()
+	instance, _ := os.Hostname()
+	attrs := []attribute.KeyValue{
+		semconv.ServiceNameKey.String(service),
+		semconv.ServiceInstanceIDKey.String(instance),
+	}
+	for k, v := range instanceProps(opts) {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+	s := newSampling(opts)
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, sdktrace.WithMaxQueueSize(opts.QueueSize)),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, attrs...)),
+		sdktrace.WithSampler(otelSampler{sampler: s.sampler}),
+	)
+	return &otelTracer{
+		sampling: s,
+		provider: provider,
+		tracer:   provider.Tracer(instrumentationName),
+		propagator: &textMapPropagator{
+			propagator: newPropagator(opts.Propagators),
+			fields:     propagatorFields(opts.Propagators),
+			service:    service,
+			instance:   instance,
+		},
+	}, nil
+}
+
+// newOTLPExporter returns the exporter of the OTLP protocol of opts, it
+// connects in the background so it is created while the collector is down.
+func newOTLPExporter(opts *options.ApmOptions) (sdktrace.SpanExporter, error) {
+	headers := make(map[string]string, len(opts.OTLP.Headers)+1)
+	for k, v := range opts.OTLP.Headers {
+		headers[k] = v
+	}
+	if opts.Authentication != "" {
+		headers["Authorization"] = opts.Authentication
+	}
+	var cfg *tls.Config
+	if opts.TLS.Enabled {
+		var err error
+		if cfg, err = tlsConfig(opts.TLS); err != nil {
+			return nil, err
+		}
+	}
+
+	if strings.ToLower(opts.OTLP.Protocol) == options.ApmOTLPProtocolHTTP {
+		httpOpts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(opts.Address),
+			otlptracehttp.WithHeaders(headers),
+			otlptracehttp.WithTimeout(opts.OTLP.Timeout),
+		}
+		if cfg != nil {
+			httpOpts = append(httpOpts, otlptracehttp.WithTLSClientConfig(cfg))
+		} else {
+			httpOpts = append(httpOpts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(context.Background(), httpOpts...)
+	}
+	grpcOpts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(opts.Address),
+		otlptracegrpc.WithHeaders(headers),
+		otlptracegrpc.WithTimeout(opts.OTLP.Timeout),
+	}
+	if cfg != nil {
+		grpcOpts = append(grpcOpts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(cfg)))
+	} else {
+		grpcOpts = append(grpcOpts, otlptracegrpc.WithInsecure())
+	}
+	return otlptracegrpc.New(context.Background(), grpcOpts...)
+}
+
+// Close exports the spans not sent yet, for up to 5s.
+func (t *otelTracer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return t.provider.Shutdown(ctx)
+}
+
+// start starts a span of kind, continuing the trace of the caller found in
+// carrier when given.
+func (t *otelTracer) start(ctx context.Context, name string, kind trace.SpanKind, carrier otelpropagation.TextMapCarrier,
+	attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if carrier != nil {
+		ctx = t.propagator.Extract(ctx, carrier)
+	}
+	return t.tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// otelSampler samples the traces like go2sky: the requests of a traced caller
+// are always traced, the local spans follow their parent and the root spans
+// are sampled by operation name.
+type otelSampler struct {
+	sampler go2sky.Sampler
+}
+
+func (s otelSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	psc := trace.SpanContextFromContext(p.ParentContext)
+	var sampled bool
+	switch {
+	case psc.IsRemote():
+		sampled = true
+	case psc.IsValid():
+		sampled = psc.IsSampled()
+	default:
+		sampled = s.sampler.IsSampled(p.Name)
+	}
+	decision := sdktrace.Drop
+	if sampled {
+		decision = sdktrace.RecordAndSample
+	}
+	return sdktrace.SamplingResult{Decision: decision, Tracestate: psc.TraceState()}
+}
+
+func (s otelSampler) Description() string {
+	return "OperationSampler"
+}
+
+// textMapPropagator reads and writes the OpenTelemetry span context in the
+// formats of apm.propagators, the IDs are mapped like the SkyWalking ones.
+type textMapPropagator struct {
+	propagator propagation.Propagator
+	fields     []string
+	// service and instance are written in the sw8 header.
+	service, instance string
+}
+
+func (p *textMapPropagator) Inject(ctx context.Context, carrier otelpropagation.TextMapCarrier) {
+	span := trace.SpanFromContext(ctx)
+	sc := span.SpanContext()
+	if !sc.IsValid() {
+		return
+	}
+	tc := &propagation.SpanContext{
+		TraceID:               sc.TraceID().String(),
+		ParentSegmentID:       sc.SpanID().String(),
+		ParentService:         p.service,
+		ParentServiceInstance: p.instance,
+		CorrelationContext:    map[string]string{},
+		TraceState:            sc.TraceState().String(),
+	}
+	if sc.IsSampled() {
+		tc.Sample = 1
+	}
+	if s, ok := span.(sdktrace.ReadOnlySpan); ok {
+		tc.ParentEndpoint = s.Name()
+	}
+	_ = p.propagator.Inject(tc, func(key, value string) error {
+		carrier.Set(key, value)
+		return nil
+	})
+}
+
+func (p *textMapPropagator) Extract(ctx context.Context, carrier otelpropagation.TextMapCarrier) context.Context {
+	var tc propagation.SpanContext
+	err := p.propagator.Extract(&tc, func(key string) (string, error) {
+		return carrier.Get(key), nil
+	})
+	if err != nil || !tc.Valid {
+		return ctx
+	}
+	traceID, err := trace.TraceIDFromHex(propagation.TraceIDToHex(tc.TraceID))
+	if err != nil {
+		return ctx
+	}
+	spanID, err := trace.SpanIDFromHex(propagation.SpanIDToHex(tc.ParentSegmentID, tc.ParentSpanID))
+	if err != nil {
+		return ctx
+	}
+	cfg := trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, Remote: true}
+	if tc.Sample == 1 {
+		cfg.TraceFlags = trace.FlagsSampled
+	}
+	if state, err := trace.ParseTraceState(tc.TraceState); err == nil {
+		cfg.TraceState = state
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(cfg))
+}
+
+func (p *textMapPropagator) Fields() []string {
+	return p.fields
+}
+
+// propagatorFields returns the headers written by the formats names.
+func propagatorFields(names []string) []string {
+	var fields []string
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case options.ApmPropagatorSW8:
+			fields = append(fields, propagation.Header, propagation.HeaderCorrelation)
+		case options.ApmPropagatorTraceContext:
+			fields = append(fields, propagation.HeaderTraceParent, propagation.HeaderTraceState)
+		case options.ApmPropagatorB3:
+			fields = append(fields, propagation.HeaderB3)
+		case options.ApmPropagatorB3Multi:
+			fields = append(fields, propagation.HeaderB3TraceID, propagation.HeaderB3SpanID, propagation.HeaderB3Sampled)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,292 @@
+package apm
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky/propagation"
+	"github.com/gin-gonic/gin"
+	goredis "github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	otelpropagation "go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// The spans are named like the ones of the go2sky plugins, so that the
+// sampled operations are the same with both tracers.
+
+func (t *otelTracer) GinMiddleware(engine *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, span := t.start(c.Request.Context(), fmt.Sprintf("/%s%s", c.Request.Method, c.FullPath()),
+			trace.SpanKindServer, otelpropagation.HeaderCarrier(c.Request.Header),
+			semconv.HTTPMethodKey.String(c.Request.Method),
+			semconv.HTTPTargetKey.String(c.Request.URL.Path),
+			semconv.HTTPRouteKey.String(c.FullPath()),
+			semconv.HTTPUserAgentKey.String(c.Request.UserAgent()),
+			semconv.NetHostNameKey.String(c.Request.Host),
+		)
+		if sc := span.SpanContext(); sc.IsSampled() {
+			c.Set(propagation.Header, sc.TraceID().String())
+		} else {
+			c.Set(propagation.Header, c.Request.Header.Get(propagation.Header))
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		code := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(code))
+		if len(c.Errors) > 0 {
+			span.SetStatus(codes.Error, c.Errors.String())
+		} else if code >= 500 {
+			span.SetStatus(codes.Error, "")
+		}
+		span.End()
+	}
+}
+
+func (t *otelTracer) StartHTTPClient(req *http.Request, operation string) func(*http.Response, error) {
+	attrs := []attribute.KeyValue{
+		semconv.HTTPMethodKey.String(req.Method),
+		semconv.HTTPURLKey.String(req.URL.Scheme + "://" + req.URL.Host + req.URL.Path),
+		semconv.NetPeerNameKey.String(req.URL.Hostname()),
+	}
+	if port, err := strconv.Atoi(req.URL.Port()); err == nil {
+		attrs = append(attrs, semconv.NetPeerPortKey.Int(port))
+	}
+	ctx, span := t.tracer.Start(req.Context(), operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	t.propagator.Inject(ctx, otelpropagation.HeaderCarrier(req.Header))
+	return func(resp *http.Response, err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else {
+			span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+			if resp.StatusCode >= http.StatusBadRequest {
+				span.SetStatus(codes.Error, resp.Status)
+			}
+		}
+		span.End()
+	}
+}
+
+func (t *otelTracer) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := t.startRPC(ctx, info.FullMethod)
+		resp, err := handler(ctx, req)
+		endRPC(span, err)
+		return resp, err
+	}
+}
+
+func (t *otelTracer) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := t.startRPC(ss.Context(), info.FullMethod)
+		err := handler(srv, &tracedStream{ServerStream: ss, ctx: ctx})
+		endRPC(span, err)
+		return err
+	}
+}
+
+func (t *otelTracer) startRPC(ctx context.Context, method string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	service, name := strings.TrimPrefix(method, "/"), ""
+	if i := strings.LastIndex(service, "/"); i >= 0 {
+		service, name = service[:i], service[i+1:]
+	}
+	return t.start(ctx, method, trace.SpanKindServer, metadataCarrier(md),
+		semconv.RPCSystemGRPC,
+		semconv.RPCServiceKey.String(service),
+		semconv.RPCMethodKey.String(name),
+	)
+}
+
+func endRPC(span trace.Span, err error) {
+	s := status.Convert(err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(s.Code())))
+	if err != nil {
+		span.SetStatus(codes.Error, s.Message())
+	}
+	span.End()
+}
+
+type tracedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedStream) Context() context.Context {
+	return s.ctx
+}
+
+// metadataCarrier reads and writes the trace context in the gRPC metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+const otelSpanKey = "otel:span"
+
+// otelGorm starts a span for each statement, around the callbacks of gorm.
+type otelGorm struct {
+	tracer trace.Tracer
+	attrs  []attribute.KeyValue
+}
+
+func (t *otelTracer) GormPlugin(peer string) gorm.Plugin {
+	attrs := []attribute.KeyValue{semconv.DBSystemMySQL}
+	if host, port, err := net.SplitHostPort(peer); err == nil {
+		attrs = append(attrs, semconv.NetPeerNameKey.String(host))
+		if p, err := strconv.Atoi(port); err == nil {
+			attrs = append(attrs, semconv.NetPeerPortKey.Int(p))
+		}
+	}
+	return &otelGorm{tracer: t.tracer, attrs: attrs}
+}
+
+func (g *otelGorm) Name() string {
+	return "gorm:otel"
+}
+
+func (g *otelGorm) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("otel_start_span", g.before("create")),
+		cb.Query().Before("gorm:query").Register("otel_start_span", g.before("query")),
+		cb.Update().Before("gorm:update").Register("otel_start_span", g.before("update")),
+		cb.Delete().Before("gorm:delete").Register("otel_start_span", g.before("delete")),
+		cb.Row().Before("gorm:row").Register("otel_start_span", g.before("row")),
+		cb.Raw().Before("gorm:raw").Register("otel_start_span", g.before("raw")),
+
+		cb.Create().After("gorm:create").Register("otel_end_span", g.after),
+		cb.Query().After("gorm:query").Register("otel_end_span", g.after),
+		cb.Update().After("gorm:update").Register("otel_end_span", g.after),
+		cb.Delete().After("gorm:delete").Register("otel_end_span", g.after),
+		cb.Row().After("gorm:row").Register("otel_end_span", g.after),
+		cb.Raw().After("gorm:raw").Register("otel_end_span", g.after),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *otelGorm) before(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		table := db.Statement.Table
+		_, span := g.tracer.Start(db.Statement.Context, fmt.Sprintf("%s/%s", table, operation),
+			trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(g.attrs...),
+			trace.WithAttributes(semconv.DBSQLTableKey.String(table), semconv.DBOperationKey.String(operation)))
+		db.Set(otelSpanKey, span)
+	}
+}
+
+func (g *otelGorm) after(db *gorm.DB) {
+	v, _ := db.Get(otelSpanKey)
+	span, ok := v.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	span.SetAttributes(semconv.DBStatementKey.String(db.Statement.SQL.String()))
+	if vars := db.Statement.Vars; len(vars) > 0 {
+		params := make([]string, len(vars))
+		for i, v := range vars {
+			params[i] = fmt.Sprintf("%v", v)
+		}
+		span.SetAttributes(attribute.String("db.sql.parameters", strings.Join(params, ", ")))
+	}
+	if err := db.Statement.Error; err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// otelRedisHook starts a span for each command and pipeline, the span is kept
+// in the context given to the After methods.
+type otelRedisHook struct {
+	tracer trace.Tracer
+}
+
+func (t *otelTracer) RedisHook() goredis.Hook {
+	return &otelRedisHook{tracer: t.tracer}
+}
+
+func (h *otelRedisHook) start(ctx context.Context, name, statement string) context.Context {
+	peer := "redis"
+	if p, ok := ctx.Value("peer").(string); ok {
+		peer = p
+	}
+	ctx, _ = h.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.DBSystemRedis,
+		semconv.DBStatementKey.String(statement),
+		semconv.NetPeerNameKey.String(peer),
+	))
+	return ctx
+}
+
+func (h *otelRedisHook) end(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+	if err != nil && err != goredis.Nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (h *otelRedisHook) BeforeProcess(ctx context.Context, cmd goredis.Cmder) (context.Context, error) {
+	args := fmt.Sprintf("%v", cmd.Args())
+	return h.start(ctx, fmt.Sprintf("%v %v", cmd.Name(), args), args), nil
+}
+
+func (h *otelRedisHook) AfterProcess(ctx context.Context, cmd goredis.Cmder) error {
+	h.end(ctx, cmd.Err())
+	return nil
+}
+
+func (h *otelRedisHook) BeforeProcessPipeline(ctx context.Context, cmds []goredis.Cmder) (context.Context, error) {
+	pipeline := ""
+	for _, cmd := range cmds {
+		pipeline += fmt.Sprintf("%v %v", cmd.Name(), cmd.Args())
+	}
+	return h.start(ctx, pipeline, pipeline), nil
+}
+
+func (h *otelRedisHook) AfterProcessPipeline(ctx context.Context, cmds []goredis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if err = cmd.Err(); err != nil && err != goredis.Nil {
+			break
+		}
+	}
+	h.end(ctx, err)
+	return nil
+}
@@ -0,0 +1,215 @@
+package apm
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	goredis "github.com/go-redis/redis/v8"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/767829413/normal-frame/internal/pkg/options"
+)
+
+// otlpReceiver collects the spans exported to it over OTLP/gRPC or OTLP/HTTP.
+type otlpReceiver struct {
+	coltracepb.UnimplementedTraceServiceServer
+	mutex   sync.Mutex
+	spans   []*tracepb.Span
+	service string
+	auth    string
+	tenant  string
+}
+
+func (r *otlpReceiver) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	r.receive(req, get("authorization"), get("x-tenant"))
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+func (r *otlpReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	var export coltracepb.ExportTraceServiceRequest
+	if req.URL.Path != "/v1/traces" || proto.Unmarshal(body, &export) != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	r.receive(&export, req.Header.Get("Authorization"), req.Header.Get("X-Tenant"))
+	resp, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(resp)
+}
+
+func (r *otlpReceiver) receive(req *coltracepb.ExportTraceServiceRequest, auth, tenant string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.auth, r.tenant = auth, tenant
+	for _, rs := range req.ResourceSpans {
+		for _, attr := range rs.Resource.GetAttributes() {
+			if attr.Key == "service.name" {
+				r.service = attr.Value.GetStringValue()
+			}
+		}
+		for _, ss := range rs.ScopeSpans {
+			r.spans = append(r.spans, ss.Spans...)
+		}
+	}
+}
+
+// span returns the received span named name.
+func (r *otlpReceiver) span(t *testing.T, name string) *tracepb.Span {
+	t.Helper()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, s := range r.spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("span %s not received, got %v", name, r.spans)
+	return nil
+}
+
+func attr(s *tracepb.Span, key string) string {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			if v, ok := a.Value.Value.(*commonpb.AnyValue_IntValue); ok {
+				return strconv.FormatInt(v.IntValue, 10)
+			}
+			return a.Value.GetStringValue()
+		}
+	}
+	return ""
+}
+
+func TestOTelTracer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, protocol := range []string{options.ApmOTLPProtocolGRPC, options.ApmOTLPProtocolHTTP} {
+		t.Run(protocol, func(t *testing.T) {
+			receiver := &otlpReceiver{}
+			var address string
+			if protocol == options.ApmOTLPProtocolGRPC {
+				lis, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				srv := grpc.NewServer()
+				coltracepb.RegisterTraceServiceServer(srv, receiver)
+				go func() { _ = srv.Serve(lis) }()
+				defer srv.Stop()
+				address = lis.Addr().String()
+			} else {
+				srv := httptest.NewServer(receiver)
+				defer srv.Close()
+				address = strings.TrimPrefix(srv.URL, "http://")
+			}
+
+			opts := options.NewApmOptions()
+			opts.Reporter, opts.Address = options.ApmReporterOTLP, address
+			opts.OTLP.Protocol = protocol
+			opts.OTLP.Headers = map[string]string{"X-Tenant": "shop"}
+			opts.Authentication = "Bearer token"
+			opts.Sampler = options.ApmSamplerConst
+			opts.NeverSample = []string{"/GET/healthcheck"}
+			opts.Propagators = []string{options.ApmPropagatorTraceContext}
+			tracer, err := newOTelTracer(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hook := tracer.RedisHook()
+			engine := gin.New()
+			engine.Use(tracer.GinMiddleware(engine))
+			engine.GET("/users/:id", func(c *gin.Context) {
+				cmd := goredis.NewStringCmd(c.Request.Context(), "get", "user")
+				ctx, _ := hook.BeforeProcess(c.Request.Context(), cmd)
+				cmd.SetErr(goredis.Nil)
+				_ = hook.AfterProcess(ctx, cmd)
+
+				out := httptest.NewRequest(http.MethodGet, "http://stock:8080/v1/stock", nil).WithContext(c.Request.Context())
+				end := tracer.StartHTTPClient(out, "/GET/v1/stock")
+				end(&http.Response{StatusCode: http.StatusOK}, nil)
+				if !strings.Contains(out.Header.Get("traceparent"), "4bf92f3577b34da6a3ce929d0e0e4736") {
+					t.Errorf("outgoing traceparent = %q", out.Header.Get("traceparent"))
+				}
+				c.Status(http.StatusNotFound)
+			})
+			engine.GET("/healthcheck", func(c *gin.Context) {})
+
+			for _, target := range []string{"/users/1", "/healthcheck"} {
+				req := httptest.NewRequest(http.MethodGet, target, nil)
+				req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+				engine.ServeHTTP(httptest.NewRecorder(), req)
+			}
+			// a root span of a never sampled operation is dropped
+			req := httptest.NewRequest(http.MethodGet, "/healthcheck", nil)
+			engine.ServeHTTP(httptest.NewRecorder(), req)
+
+			if err := tracer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			server := receiver.span(t, "/GET/users/:id")
+			if string(server.TraceId) != string(mustHex(t, "4bf92f3577b34da6a3ce929d0e0e4736")) {
+				t.Errorf("trace ID = %x, want the traceparent one", server.TraceId)
+			}
+			if string(server.ParentSpanId) != string(mustHex(t, "00f067aa0ba902b7")) {
+				t.Errorf("parent span ID = %x, want the traceparent one", server.ParentSpanId)
+			}
+			if server.Kind != tracepb.Span_SPAN_KIND_SERVER || attr(server, "http.route") != "/users/:id" ||
+				attr(server, "http.status_code") != "404" {
+				t.Errorf("server span = %v", server)
+			}
+			client := receiver.span(t, "get [get user]")
+			if string(client.ParentSpanId) != string(server.SpanId) || attr(client, "db.system") != "redis" {
+				t.Errorf("redis span = %v, want a child of %x", client, server.SpanId)
+			}
+			if client.Status.GetCode() == tracepb.Status_STATUS_CODE_ERROR {
+				t.Errorf("redis span status = %v, a missing key is not an error", client.Status)
+			}
+			exit := receiver.span(t, "/GET/v1/stock")
+			if string(exit.ParentSpanId) != string(server.SpanId) || exit.Kind != tracepb.Span_SPAN_KIND_CLIENT ||
+				attr(exit, "http.status_code") != "200" {
+				t.Errorf("http client span = %v, want a child of %x", exit, server.SpanId)
+			}
+			receiver.span(t, "/GET/healthcheck")
+			if n := len(receiver.spans); n != 4 {
+				t.Errorf("received %d spans, want 4", n)
+			}
+			if receiver.auth != "Bearer token" || receiver.tenant != "shop" {
+				t.Errorf("headers = %q, %q", receiver.auth, receiver.tenant)
+			}
+			if receiver.service == "" {
+				t.Error("the resource has no service name")
+			}
+		})
+	}
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
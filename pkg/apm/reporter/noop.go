@@ -0,0 +1,17 @@
+package reporter
+
+import "github.com/767829413/normal-frame/fork/SkyAPM/go2sky"
+
+// NewNoopReporter create a reporter dropping the segments. The tracer still
+// creates the spans, so the logs carry their trace context.
+func NewNoopReporter() go2sky.Reporter {
+	return noopReporter{}
+}
+
+type noopReporter struct{}
+
+func (noopReporter) Boot(service string, serviceInstance string) {}
+
+func (noopReporter) Send(spans []go2sky.ReportedSpan) {}
+
+func (noopReporter) Close() {}
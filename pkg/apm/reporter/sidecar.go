@@ -2,44 +2,193 @@ package reporter
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky"
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter/grpc/common"
 	agentv3 "github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter/grpc/language-agent"
 )
 
+// Defaults of a sidecar reporter.
+const (
+	DefaultQueueSize     = 30000
+	DefaultBatchSize     = 50
+	DefaultFlushInterval = 100 * time.Millisecond
+	DefaultCloseTimeout  = 5 * time.Second
+	DefaultMinBackoff    = 100 * time.Millisecond
+	DefaultMaxBackoff    = 5 * time.Second
+
+	writeTimeout = 5 * time.Second
+)
+
+// 链路在sidecar协议中的类型
+const sidecarSegmentType = '1'
+
+// ErrClosed is returned when flushing a closed reporter.
+var ErrClosed = errors.New("sidecar reporter closed")
+
+// marshalSegment encodes the segments written to the sidecar, the tests
+// replace it to fail.
+var marshalSegment = json.Marshal
+
+// Stats counts the segments handled by a sidecar reporter.
+type Stats struct {
+	// Queued is the number of segments waiting to be sent.
+	Queued int
+	// Sent is the number of segments written to the sidecar.
+	Sent uint64
+	// Dropped is the number of segments discarded because the queue was full,
+	// or still queued when the reporter closed.
+	Dropped uint64
+	// Reconnects is the number of times the connection was established again
+	// after it failed.
+	Reconnects uint64
+}
+
+// SidecarReporterOption allows for functional options to adjust behaviour
+// of a sidecar reporter to be created by NewSidecarReporter
+type SidecarReporterOption func(r *SidecarReporter)
+
+// WithInstanceProps setup service instance properties eg: version=v1.2.0,
+// they are sent along with every segment.
+func WithInstanceProps(props map[string]string) SidecarReporterOption {
+	return func(r *SidecarReporter) {
+		r.instanceProps = props
+	}
+}
+
+// WithQueueSize setup the number of segments queued, the segments finished
+// when the queue is full are dropped.
+func WithQueueSize(size int) SidecarReporterOption {
+	return func(r *SidecarReporter) {
+		if size > 0 {
+			r.queue = make(chan *SegmentObject, size)
+		}
+	}
+}
+
+// WithBatchSize setup the maximum number of segments sent in one write.
+func WithBatchSize(size int) SidecarReporterOption {
+	return func(r *SidecarReporter) {
+		if size > 0 {
+			r.batchSize = size
+		}
+	}
+}
+
+// WithFlushInterval setup the maximum time a segment waits in the queue.
+func WithFlushInterval(interval time.Duration) SidecarReporterOption {
+	return func(r *SidecarReporter) {
+		if interval > 0 {
+			r.flushInterval = interval
+		}
+	}
+}
+
+// WithCloseTimeout setup the time Close spends sending the queued segments.
+func WithCloseTimeout(timeout time.Duration) SidecarReporterOption {
+	return func(r *SidecarReporter) {
+		r.closeTimeout = timeout
+	}
+}
+
+// WithReconnectBackoff setup the wait before dialing the sidecar again after a
+// failure, doubling from min up to max while it keeps failing.
+func WithReconnectBackoff(min, max time.Duration) SidecarReporterOption {
+	return func(r *SidecarReporter) {
+		r.minBackoff, r.maxBackoff = min, max
+	}
+}
+
 // NewSidecarReporter create a new reporter to send data to sidecar. Only one backend address is allowed.
-func NewSidecarReporter(serverAddr string) (go2sky.Reporter, error) {
-	r := &sidecarReporter{}
-	conn, err := net.Dial("unix", serverAddr)
-	if err != nil {
-		return nil, err
+// Segments are queued by Send and written in batches by a background goroutine, which dials the
+// socket again with a backoff whenever the sidecar is not listening.
+func NewSidecarReporter(serverAddr string, opts ...SidecarReporterOption) (*SidecarReporter, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &SidecarReporter{
+		addr:          serverAddr,
+		batchSize:     DefaultBatchSize,
+		flushInterval: DefaultFlushInterval,
+		closeTimeout:  DefaultCloseTimeout,
+		minBackoff:    DefaultMinBackoff,
+		maxBackoff:    DefaultMaxBackoff,
+		ctx:           ctx,
+		cancel:        cancel,
+		queue:         make(chan *SegmentObject, DefaultQueueSize),
+		flush:         make(chan flushRequest),
+		done:          make(chan struct{}),
 	}
-	r.conn = conn
+	for _, o := range opts {
+		o(r)
+	}
+	go r.run()
 	return r, nil
 }
 
-type sidecarReporter struct {
+// SidecarReporter sends the segments to the sidecar listening on a unix
+// socket, as JSON lines prefixed with their type.
+type SidecarReporter struct {
 	service         string
 	serviceInstance string
 	instanceProps   map[string]string
-	conn            net.Conn
-	bootFlag        bool
+	addr            string
+
+	batchSize     int
+	flushInterval time.Duration
+	closeTimeout  time.Duration
+	minBackoff    time.Duration
+	maxBackoff    time.Duration
+
+	// ctx is canceled when Close gives up, to abort the pending writes.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan *SegmentObject
+	flush  chan flushRequest
+	done   chan struct{}
+
+	// conn and backoff are only used by the writer goroutine.
+	conn    net.Conn
+	backoff time.Duration
+	// lost is set while the sidecar is unreachable, to log the outage once.
+	lost bool
+
+	sent       uint64
+	dropped    uint64
+	reconnects uint64
 }
 
-func (r *sidecarReporter) Boot(service string, serviceInstance string) {
+type flushRequest struct {
+	ctx  context.Context
+	done chan error
+}
+
+func (r *SidecarReporter) Boot(service string, serviceInstance string) {
 	r.service = service
 	r.serviceInstance = serviceInstance
-	r.bootFlag = true
 }
 
-func (r *sidecarReporter) Send(spans []go2sky.ReportedSpan) {
-	spanSize := len(spans)
-	if spanSize < 1 {
+// Send queues the segment of spans, it is dropped when the queue is full.
+func (r *SidecarReporter) Send(spans []go2sky.ReportedSpan) {
+	if len(spans) < 1 {
 		return
 	}
+	r.enqueue(r.segment(spans))
+}
+
+// segment converts spans to the sidecar format, which carries the content the
+// gRPC reporter sends with the tags and the log fields as objects.
+func (r *SidecarReporter) segment(spans []go2sky.ReportedSpan) *SegmentObject {
+	spanSize := len(spans)
 	rootSpan := spans[spanSize-1]
 	rootCtx := rootSpan.Context()
 	segmentObject := &agentv3.SegmentObject{
@@ -92,12 +241,6 @@ func (r *sidecarReporter) Send(spans []go2sky.ReportedSpan) {
 		}
 		segmentObject.Spans[i].Refs = srr
 	}
-	defer func() {
-		// recover the panic caused by close sendCh
-		if err := recover(); err != nil {
-			log.Printf("reporter segment err %v", err)
-		}
-	}()
 	// 组合成符合sidecar格式的数据
 	var segment = &SegmentObject{
 		TraceId: segmentObject.TraceId,
@@ -108,6 +251,7 @@ func (r *sidecarReporter) Send(spans []go2sky.ReportedSpan) {
 		},
 		Service:         segmentObject.Service,
 		ServiceInstance: segmentObject.ServiceInstance,
+		InstanceProps:   r.instanceProps,
 	}
 	for _, value := range segmentObject.Spans {
 		span := &SpanObject{
@@ -115,31 +259,20 @@ func (r *sidecarReporter) Send(spans []go2sky.ReportedSpan) {
 			ParentSpanId:  value.ParentSpanId,
 			StartTime:     value.StartTime,
 			EndTime:       value.EndTime,
+			Refs:          value.Refs,
 			OperationName: value.OperationName,
 			Peer:          value.Peer,
 			SpanType:      value.SpanType,
 			SpanLayer:     value.SpanLayer,
 			ComponentId:   value.ComponentId,
 			IsError:       value.IsError,
-			//Tags:          nil,
-			SkipAnalysis: value.SkipAnalysis,
+			Tags:          value.Tags,
+			Logs:          value.Logs,
+			SkipAnalysis:  value.SkipAnalysis,
 		}
-		tags := make(map[string]string)
-		for _, v := range value.Tags {
-			tags[v.Key] = v.Value
-		}
-		span.Tags = tags
 		segment.Segment.Spans = append(segment.Segment.Spans, span)
 	}
-	byteSli, _ := json.Marshal(segment)
-	var buf bytes.Buffer
-	buf.WriteByte(49)
-	buf.Write(byteSli)
-	buf.WriteByte(10)
-	if _, err := r.conn.Write(buf.Bytes()); err != nil {
-		log.Printf("conn Write error %v", err)
-		r.Close()
-	}
+	return segment
 }
 
 type SegmentObject struct {
@@ -147,6 +280,9 @@ type SegmentObject struct {
 	Segment         Segment `json:"segment,omitempty"`
 	Service         string  `json:"service,omitempty"`
 	ServiceInstance string  `json:"serviceInstance,omitempty"`
+	// InstanceProps are the service instance properties, sidecars which do not
+	// know them ignore the field.
+	InstanceProps map[string]string `json:"serviceInstanceProperties,omitempty"`
 }
 
 type Segment struct {
@@ -155,29 +291,243 @@ type Segment struct {
 	Spans          []*SpanObject `json:"spans,omitempty"`
 }
 
+// SpanObject is agentv3.SpanObject with the protobuf field names. The tags and
+// the log fields stay lists of pairs, a key may be repeated.
 type SpanObject struct {
-	SpanId        int32             `protobuf:"varint,1,opt,name=spanId,proto3" json:"spanId,omitempty"`
-	ParentSpanId  int32             `protobuf:"varint,2,opt,name=parentSpanId,proto3" json:"parentSpanId,omitempty"`
-	StartTime     int64             `protobuf:"varint,3,opt,name=startTime,proto3" json:"startTime,omitempty"`
-	EndTime       int64             `protobuf:"varint,4,opt,name=endTime,proto3" json:"endTime,omitempty"`
-	OperationName string            `protobuf:"bytes,6,opt,name=operationName,proto3" json:"operationName,omitempty"`
-	Peer          string            `protobuf:"bytes,7,opt,name=peer,proto3" json:"peer,omitempty"`
-	SpanType      agentv3.SpanType  `protobuf:"varint,8,opt,name=spanType,proto3,enum=SpanType" json:"spanType,omitempty"`
-	SpanLayer     agentv3.SpanLayer `protobuf:"varint,9,opt,name=spanLayer,proto3,enum=SpanLayer" json:"spanLayer,omitempty"`
-	ComponentId   int32             `protobuf:"varint,10,opt,name=componentId,proto3" json:"componentId,omitempty"`
-	IsError       bool              `protobuf:"varint,11,opt,name=isError,proto3" json:"isError,omitempty"`
-	Tags          map[string]string `protobuf:"bytes,12,rep,name=tags,proto3" json:"tags,omitempty"`
-	SkipAnalysis  bool              `protobuf:"varint,14,opt,name=skipAnalysis,proto3" json:"skipAnalysis,omitempty"`
+	SpanId        int32                        `protobuf:"varint,1,opt,name=spanId,proto3" json:"spanId,omitempty"`
+	ParentSpanId  int32                        `protobuf:"varint,2,opt,name=parentSpanId,proto3" json:"parentSpanId,omitempty"`
+	StartTime     int64                        `protobuf:"varint,3,opt,name=startTime,proto3" json:"startTime,omitempty"`
+	EndTime       int64                        `protobuf:"varint,4,opt,name=endTime,proto3" json:"endTime,omitempty"`
+	Refs          []*agentv3.SegmentReference  `protobuf:"bytes,5,rep,name=refs,proto3" json:"refs,omitempty"`
+	OperationName string                       `protobuf:"bytes,6,opt,name=operationName,proto3" json:"operationName,omitempty"`
+	Peer          string                       `protobuf:"bytes,7,opt,name=peer,proto3" json:"peer,omitempty"`
+	SpanType      agentv3.SpanType             `protobuf:"varint,8,opt,name=spanType,proto3,enum=SpanType" json:"spanType,omitempty"`
+	SpanLayer     agentv3.SpanLayer            `protobuf:"varint,9,opt,name=spanLayer,proto3,enum=SpanLayer" json:"spanLayer,omitempty"`
+	ComponentId   int32                        `protobuf:"varint,10,opt,name=componentId,proto3" json:"componentId,omitempty"`
+	IsError       bool                         `protobuf:"varint,11,opt,name=isError,proto3" json:"isError,omitempty"`
+	Tags          []*common.KeyStringValuePair `protobuf:"bytes,12,rep,name=tags,proto3" json:"tags,omitempty"`
+	Logs          []*agentv3.Log               `protobuf:"bytes,13,rep,name=logs,proto3" json:"logs,omitempty"`
+	SkipAnalysis  bool                         `protobuf:"varint,14,opt,name=skipAnalysis,proto3" json:"skipAnalysis,omitempty"`
 }
 
-func (r *sidecarReporter) Close() {
-	r.closeConn()
+func (r *SidecarReporter) enqueue(segment *SegmentObject) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		atomic.AddUint64(&r.dropped, 1)
+		return
+	}
+	select {
+	case r.queue <- segment:
+	default:
+		atomic.AddUint64(&r.dropped, 1)
+	}
+}
+
+// Flush sends the queued segments and returns when they are written or ctx is
+// done.
+func (r *SidecarReporter) Flush(ctx context.Context) error {
+	r.mu.RLock()
+	closed := r.closed
+	r.mu.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+
+	req := flushRequest{ctx: ctx, done: make(chan error, 1)}
+	select {
+	case r.flush <- req:
+	case <-r.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-req.done
+}
+
+// Close stops accepting segments and sends the queued ones for up to the
+// close timeout, the segments still queued then are dropped.
+func (r *SidecarReporter) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), r.closeTimeout)
+	defer cancel()
+	if err := r.CloseContext(ctx); err != nil {
+		log.Printf("sidecar reporter: close: %v, %d segments dropped", err, atomic.LoadUint64(&r.dropped))
+	}
+}
+
+// CloseContext is Close sending the queued segments until ctx is done.
+func (r *SidecarReporter) CloseContext(ctx context.Context) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		<-r.done
+		return nil
+	}
+	r.closed = true
+	close(r.queue)
+	r.mu.Unlock()
+
+	defer r.cancel()
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		<-r.done
+		return ctx.Err()
+	}
+}
+
+// Stats returns the counters of the reporter.
+func (r *SidecarReporter) Stats() Stats {
+	return Stats{
+		Queued:     len(r.queue),
+		Sent:       atomic.LoadUint64(&r.sent),
+		Dropped:    atomic.LoadUint64(&r.dropped),
+		Reconnects: atomic.LoadUint64(&r.reconnects),
+	}
+}
+
+// run batches the queued segments until the queue is closed.
+func (r *SidecarReporter) run() {
+	defer close(r.done)
+	defer r.closeConn()
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*SegmentObject, 0, r.batchSize)
+	for {
+		select {
+		case segment, ok := <-r.queue:
+			if !ok {
+				r.drain(batch)
+				return
+			}
+			batch = append(batch, segment)
+			if len(batch) >= r.batchSize {
+				r.write(r.ctx, batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			r.write(r.ctx, batch)
+			batch = batch[:0]
+		case req := <-r.flush:
+			req.done <- r.flushQueued(req.ctx, batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flushQueued sends batch and the segments queued when it is called.
+func (r *SidecarReporter) flushQueued(ctx context.Context, batch []*SegmentObject) error {
+	for n := len(r.queue); n > 0; n-- {
+		segment, ok := <-r.queue
+		if !ok {
+			break
+		}
+		batch = append(batch, segment)
+		if len(batch) >= r.batchSize {
+			r.write(ctx, batch)
+			batch = batch[:0]
+		}
+	}
+	r.write(ctx, batch)
+	return ctx.Err()
+}
+
+// drain sends batch and the rest of the closed queue, until Close gives up.
+func (r *SidecarReporter) drain(batch []*SegmentObject) {
+	for segment := range r.queue {
+		batch = append(batch, segment)
+		if len(batch) >= r.batchSize {
+			r.write(r.ctx, batch)
+			batch = batch[:0]
+		}
+	}
+	r.write(r.ctx, batch)
+}
+
+// write sends batch in one write, dialing the sidecar again with a backoff
+// until it succeeds. The batch is dropped once ctx is done.
+func (r *SidecarReporter) write(ctx context.Context, batch []*SegmentObject) {
+	if len(batch) == 0 {
+		return
+	}
+	// n counts the segments encoded, those failing to are already dropped
+	var buf bytes.Buffer
+	n := 0
+	for _, segment := range batch {
+		js, err := marshalSegment(segment)
+		if err != nil {
+			log.Printf("sidecar reporter: %v, segment dropped", err)
+			atomic.AddUint64(&r.dropped, 1)
+			continue
+		}
+		buf.WriteByte(sidecarSegmentType)
+		buf.Write(js)
+		buf.WriteByte('\n')
+		n++
+	}
+	if n == 0 {
+		return
+	}
+
+	for {
+		if r.backoff > 0 {
+			select {
+			case <-time.After(r.backoff):
+			case <-ctx.Done():
+				atomic.AddUint64(&r.dropped, uint64(n))
+				return
+			}
+		}
+		err := r.writeConn(buf.Bytes())
+		if err == nil {
+			if r.lost {
+				r.lost = false
+				atomic.AddUint64(&r.reconnects, 1)
+				log.Printf("sidecar reporter: reconnected to %s", r.addr)
+			}
+			r.backoff = 0
+			atomic.AddUint64(&r.sent, uint64(n))
+			return
+		}
+		if !r.lost {
+			r.lost = true
+			log.Printf("sidecar reporter: %v, reconnecting", err)
+		}
+		if r.backoff *= 2; r.backoff < r.minBackoff {
+			r.backoff = r.minBackoff
+		} else if r.backoff > r.maxBackoff {
+			r.backoff = r.maxBackoff
+		}
+	}
+}
+
+// writeConn writes b, dialing the sidecar when there is no connection. The
+// connection is closed when the write fails, a batch partly written is sent
+// again whole.
+func (r *SidecarReporter) writeConn(b []byte) error {
+	if r.conn == nil {
+		conn, err := net.DialTimeout("unix", r.addr, writeTimeout)
+		if err != nil {
+			return err
+		}
+		r.conn = conn
+	}
+	_ = r.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := r.conn.Write(b); err != nil {
+		r.closeConn()
+		return err
+	}
+	return nil
 }
 
-func (r *sidecarReporter) closeConn() {
+func (r *SidecarReporter) closeConn() {
 	if r.conn != nil {
 		if err := r.conn.Close(); err != nil {
 			log.Println(err)
 		}
+		r.conn = nil
 	}
 }
@@ -0,0 +1,78 @@
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	go2skyreporter "github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter"
+	logv3 "github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter/grpc/logging"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// 日志在sidecar协议中的类型, 链路为'1'
+const sidecarLogType = '2'
+
+// NewSidecarLogTransport create a transport writing logs to the sidecar
+// listening on the unix socket serverAddr, one JSON LogData per line. The
+// socket is dialed on the first send and again after a failed write, so the
+// transport can be created before the sidecar is up.
+func NewSidecarLogTransport(serverAddr string) go2skyreporter.LogTransport {
+	return &sidecarLogTransport{addr: serverAddr}
+}
+
+type sidecarLogTransport struct {
+	addr string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (t *sidecarLogTransport) SendLogs(ctx context.Context, logs []*logv3.LogData) error {
+	var buf bytes.Buffer
+	for _, data := range logs {
+		js, err := protojson.Marshal(data)
+		if err != nil {
+			return err
+		}
+		buf.WriteByte(sidecarLogType)
+		buf.Write(js)
+		buf.WriteByte('\n')
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "unix", t.addr)
+		if err != nil {
+			return err
+		}
+		t.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = t.conn.SetWriteDeadline(deadline)
+	} else {
+		_ = t.conn.SetWriteDeadline(time.Time{})
+	}
+	if _, err := t.conn.Write(buf.Bytes()); err != nil {
+		// 重新连接后整批重发
+		t.conn.Close()
+		t.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (t *sidecarLogTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
@@ -0,0 +1,465 @@
+package reporter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky"
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky/propagation"
+	go2skyreporter "github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter"
+	"github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter/grpc/common"
+	agentv3 "github.com/767829413/normal-frame/fork/SkyAPM/go2sky/reporter/grpc/language-agent"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// fakeSpan is a finished span.
+type fakeSpan struct {
+	ctx       *go2sky.SegmentContext
+	refs      []*propagation.SpanContext
+	start     int64
+	end       int64
+	operation string
+	peer      string
+	spanType  agentv3.SpanType
+	spanLayer agentv3.SpanLayer
+	component int32
+	isError   bool
+	tags      []*common.KeyStringValuePair
+	logs      []*agentv3.Log
+}
+
+// newFakeSpan returns the root span of an HTTP request.
+func newFakeSpan(traceID string) go2sky.ReportedSpan {
+	return &fakeSpan{
+		ctx:       &go2sky.SegmentContext{TraceID: traceID, SegmentID: traceID + ".1", ParentSpanID: -1},
+		start:     1,
+		end:       2,
+		operation: "/GET/v1/users",
+		spanType:  agentv3.SpanType_Entry,
+		spanLayer: agentv3.SpanLayer_Http,
+		component: 5006,
+	}
+}
+
+func (s *fakeSpan) Context() *go2sky.SegmentContext    { return s.ctx }
+func (s *fakeSpan) Refs() []*propagation.SpanContext   { return s.refs }
+func (s *fakeSpan) StartTime() int64                   { return s.start }
+func (s *fakeSpan) EndTime() int64                     { return s.end }
+func (s *fakeSpan) OperationName() string              { return s.operation }
+func (s *fakeSpan) Peer() string                       { return s.peer }
+func (s *fakeSpan) SpanType() agentv3.SpanType         { return s.spanType }
+func (s *fakeSpan) SpanLayer() agentv3.SpanLayer       { return s.spanLayer }
+func (s *fakeSpan) IsError() bool                      { return s.isError }
+func (s *fakeSpan) Tags() []*common.KeyStringValuePair { return s.tags }
+func (s *fakeSpan) Logs() []*agentv3.Log               { return s.logs }
+func (s *fakeSpan) ComponentID() int32                 { return s.component }
+
+// fakeSidecar reads the lines written on a unix socket.
+type fakeSidecar struct {
+	ln net.Listener
+
+	mu    sync.Mutex
+	conns []net.Conn
+	lines []string
+}
+
+func listenSidecar(t *testing.T, addr string) *fakeSidecar {
+	ln, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSidecar{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go s.read(conn)
+		}
+	}()
+	t.Cleanup(s.close)
+	return s
+}
+
+func (s *fakeSidecar) read(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		s.mu.Lock()
+		s.lines = append(s.lines, scanner.Text())
+		s.mu.Unlock()
+	}
+}
+
+// dropConns closes the accepted connections, as a restarting sidecar would.
+func (s *fakeSidecar) dropConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeSidecar) close() {
+	s.ln.Close()
+	s.dropConns()
+}
+
+// waitTraces waits for the segments of n traces and returns their IDs.
+func (s *fakeSidecar) waitTraces(t *testing.T, n int) []string {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		s.mu.Lock()
+		lines := append([]string(nil), s.lines...)
+		s.mu.Unlock()
+		if len(lines) < n {
+			continue
+		}
+		ids := make([]string, len(lines))
+		for i, line := range lines {
+			if !strings.HasPrefix(line, string(sidecarSegmentType)) {
+				t.Fatalf("line %q is not a segment", line)
+			}
+			var segment SegmentObject
+			if err := json.Unmarshal([]byte(line[1:]), &segment); err != nil {
+				t.Fatal(err)
+			}
+			if segment.Service != "svc" || segment.ServiceInstance != "inst" {
+				t.Errorf("segment of %s/%s, want svc/inst", segment.Service, segment.ServiceInstance)
+			}
+			ids[i] = segment.TraceId
+		}
+		return ids
+	}
+	t.Fatalf("the sidecar did not receive %d segments", n)
+	return nil
+}
+
+func newTestReporter(t *testing.T, addr string, opts ...SidecarReporterOption) *SidecarReporter {
+	r, err := NewSidecarReporter(addr, append([]SidecarReporterOption{
+		WithFlushInterval(time.Hour),
+		WithReconnectBackoff(time.Millisecond, 10*time.Millisecond),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Boot("svc", "inst")
+	return r
+}
+
+func TestSidecarReporter(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "sidecar.sock")
+	r := newTestReporter(t, addr, WithBatchSize(2))
+
+	// segments are queued until the sidecar listens
+	r.Send([]go2sky.ReportedSpan{newFakeSpan("t1")})
+	r.Send([]go2sky.ReportedSpan{newFakeSpan("t2")})
+	time.Sleep(20 * time.Millisecond)
+	s := listenSidecar(t, addr)
+	r.Send([]go2sky.ReportedSpan{newFakeSpan("t3")})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ids := s.waitTraces(t, 3); strings.Join(ids, ",") != "t1,t2,t3" {
+		t.Errorf("received %v, want t1, t2 and t3", ids)
+	}
+
+	// the connection closed by the sidecar is dialed again
+	s.dropConns()
+	r.Send([]go2sky.ReportedSpan{newFakeSpan("t4")})
+	if err := r.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ids := s.waitTraces(t, 4); ids[3] != "t4" {
+		t.Errorf("received %v, want t4 after reconnecting", ids)
+	}
+
+	if err := r.CloseContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	r.Send([]go2sky.ReportedSpan{newFakeSpan("t5")})
+	if err := r.Flush(ctx); err != ErrClosed {
+		t.Errorf("Flush after Close = %v, want ErrClosed", err)
+	}
+	stats := r.Stats()
+	if stats.Sent != 4 || stats.Dropped != 1 || stats.Reconnects != 2 {
+		t.Errorf("stats = %+v, want 4 sent, 1 dropped and 2 reconnects", stats)
+	}
+}
+
+func TestSidecarReporterQueueFull(t *testing.T) {
+	r := newTestReporter(t, filepath.Join(t.TempDir(), "sidecar.sock"), WithQueueSize(1), WithBatchSize(10))
+	for _, id := range []string{"t1", "t2", "t3"} {
+		r.Send([]go2sky.ReportedSpan{newFakeSpan(id)})
+	}
+	if stats := r.Stats(); stats.Dropped == 0 {
+		t.Errorf("stats = %+v, want the segments past the queue size dropped", stats)
+	}
+
+	// the sidecar never listens, Close gives up at the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := r.CloseContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("CloseContext = %v, want the deadline exceeded", err)
+	}
+	if stats := r.Stats(); stats.Sent != 0 || stats.Dropped != 3 || stats.Queued != 0 {
+		t.Errorf("stats = %+v, want the 3 segments dropped", stats)
+	}
+}
+
+func TestSidecarReporterUnencodableSegment(t *testing.T) {
+	marshal := marshalSegment
+	t.Cleanup(func() { marshalSegment = marshal })
+	marshalSegment = func(v interface{}) ([]byte, error) {
+		if segment := v.(*SegmentObject); segment.TraceId == "t2" {
+			return nil, errors.New("unsupported value")
+		}
+		return marshal(v)
+	}
+
+	addr := filepath.Join(t.TempDir(), "sidecar.sock")
+	r := newTestReporter(t, addr, WithBatchSize(10))
+	s := listenSidecar(t, addr)
+	for _, id := range []string{"t1", "t2", "t3"} {
+		r.Send([]go2sky.ReportedSpan{newFakeSpan(id)})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ids := s.waitTraces(t, 2); strings.Join(ids, ",") != "t1,t3" {
+		t.Errorf("received %v, want t1 and t3", ids)
+	}
+	if stats := r.Stats(); stats.Sent != 2 || stats.Dropped != 1 {
+		t.Errorf("stats = %+v, want 2 sent and the unencodable segment dropped", stats)
+	}
+
+	// a batch of unencodable segments writes nothing
+	r.Send([]go2sky.ReportedSpan{newFakeSpan("t2")})
+	if err := r.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stats := r.Stats(); stats.Sent != 2 || stats.Dropped != 2 {
+		t.Errorf("stats = %+v, want 2 sent and 2 dropped", stats)
+	}
+	if err := r.CloseContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// goldenSegments are segments using every field of the span, keyed by the
+// name of their golden file.
+var goldenSegments = map[string][]go2sky.ReportedSpan{
+	// a request calling a failing gRPC service
+	"entry": {
+		&fakeSpan{
+			ctx:       &go2sky.SegmentContext{TraceID: "t1", SegmentID: "t1.1", SpanID: 1, ParentSpanID: 0},
+			start:     1200,
+			end:       1800,
+			operation: "/users.Users/Get",
+			peer:      "users:9000",
+			spanType:  agentv3.SpanType_Exit,
+			spanLayer: agentv3.SpanLayer_RPCFramework,
+			component: 23,
+			isError:   true,
+			tags: []*common.KeyStringValuePair{
+				{Key: "grpc.method", Value: "/users.Users/Get"},
+				{Key: "grpc.status_code", Value: "Unavailable"},
+			},
+			logs: []*agentv3.Log{{
+				Time: 1790,
+				Data: []*common.KeyStringValuePair{
+					{Key: "event", Value: "error"},
+					{Key: "error.kind", Value: "grpc"},
+					{Key: "message", Value: "connection refused"},
+				},
+			}},
+		},
+		&fakeSpan{
+			ctx: &go2sky.SegmentContext{TraceID: "t1", SegmentID: "t1.1", SpanID: 0, ParentSpanID: -1},
+			refs: []*propagation.SpanContext{{
+				ParentSegmentID:       "g1.1",
+				ParentSpanID:          2,
+				ParentService:         "gateway",
+				ParentServiceInstance: "gateway-1",
+				ParentEndpoint:        "/GET/api/users",
+				AddressUsedAtClient:   "orders:8080",
+			}},
+			start:     1000,
+			end:       2000,
+			operation: "/GET/v1/users",
+			spanType:  agentv3.SpanType_Entry,
+			spanLayer: agentv3.SpanLayer_Http,
+			component: 5006,
+			tags: []*common.KeyStringValuePair{
+				{Key: "http.method", Value: "GET"},
+				{Key: "http.params", Value: "id=1"},
+				{Key: "http.params", Value: "id=2"},
+				{Key: "status_code", Value: "500"},
+			},
+		},
+	},
+	// a goroutine spawned by the request
+	"cross-thread": {
+		&fakeSpan{
+			ctx:       &go2sky.SegmentContext{TraceID: "t1", SegmentID: "t1.2", SpanID: 0, ParentSpanID: 1, ParentSegmentID: "t1.1"},
+			start:     1300,
+			end:       1400,
+			operation: "notify",
+			spanType:  agentv3.SpanType_Local,
+		},
+	},
+}
+
+func TestSidecarSegmentGolden(t *testing.T) {
+	r := newTestReporter(t, filepath.Join(t.TempDir(), "sidecar.sock"), WithInstanceProps(map[string]string{"region": "eu-west-1"}))
+	defer r.CloseContext(context.Background())
+	for name, spans := range goldenSegments {
+		t.Run(name, func(t *testing.T) {
+			got, err := json.MarshalIndent(r.segment(spans), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+			golden := filepath.Join("testdata", name+".golden.json")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("segment differs from %s, run go test -update to accept it:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+// fakeCollector is a TraceSegmentReportService handing over the segments it
+// receives.
+type fakeCollector struct {
+	segments chan *agentv3.SegmentObject
+}
+
+func (c *fakeCollector) Collect(stream agentv3.TraceSegmentReportService_CollectServer) error {
+	for {
+		segment, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&common.Commands{})
+		}
+		if err != nil {
+			return err
+		}
+		c.segments <- segment
+	}
+}
+
+// TestSidecarSegmentMatchesGRPC checks the sidecar carries the content the
+// gRPC reporter sends to the OAP server.
+func TestSidecarSegmentMatchesGRPC(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &fakeCollector{segments: make(chan *agentv3.SegmentObject, 1)}
+	s := grpc.NewServer()
+	agentv3.RegisterTraceSegmentReportServiceServer(s, c)
+	go s.Serve(ln)
+	defer s.Stop()
+
+	g, err := go2skyreporter.NewGRPCReporter(ln.Addr().String(),
+		go2skyreporter.WithCheckInterval(-1),
+		go2skyreporter.WithLogger(log.New(io.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Boot("svc", "inst")
+	defer g.Close()
+	r := newTestReporter(t, filepath.Join(t.TempDir(), "sidecar.sock"))
+	defer r.CloseContext(context.Background())
+
+	for name, spans := range goldenSegments {
+		g.Send(spans)
+		var want *agentv3.SegmentObject
+		select {
+		case want = <-c.segments:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: the gRPC reporter sent no segment", name)
+		}
+		js, err := json.Marshal(r.segment(spans))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var segment SegmentObject
+		if err := json.Unmarshal(js, &segment); err != nil {
+			t.Fatal(err)
+		}
+		if got := segmentProto(&segment); !proto.Equal(got, want) {
+			t.Errorf("%s: sidecar segment\n%v\nwant\n%v", name, got, want)
+		}
+	}
+}
+
+// segmentProto converts the segment decoded from the sidecar format back to
+// protobuf.
+func segmentProto(s *SegmentObject) *agentv3.SegmentObject {
+	segment := &agentv3.SegmentObject{
+		TraceId:         s.TraceId,
+		TraceSegmentId:  s.Segment.TraceSegmentId,
+		Service:         s.Service,
+		ServiceInstance: s.ServiceInstance,
+		IsSizeLimited:   s.Segment.IsSizeLimited,
+	}
+	for _, span := range s.Segment.Spans {
+		o := &agentv3.SpanObject{
+			SpanId:        span.SpanId,
+			ParentSpanId:  span.ParentSpanId,
+			StartTime:     span.StartTime,
+			EndTime:       span.EndTime,
+			Refs:          span.Refs,
+			OperationName: span.OperationName,
+			Peer:          span.Peer,
+			SpanType:      span.SpanType,
+			SpanLayer:     span.SpanLayer,
+			ComponentId:   span.ComponentId,
+			IsError:       span.IsError,
+			Tags:          span.Tags,
+			Logs:          span.Logs,
+			SkipAnalysis:  span.SkipAnalysis,
+		}
+		segment.Spans = append(segment.Spans, o)
+	}
+	return segment
+}
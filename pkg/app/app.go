@@ -2,6 +2,7 @@ package app
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 
@@ -9,9 +10,9 @@ import (
 	"github.com/767829413/normal-frame/fork/component-base/cli/globalflag"
 	"github.com/767829413/normal-frame/fork/component-base/cli/term"
 	optionsCli "github.com/767829413/normal-frame/pkg/options"
+	"github.com/767829413/normal-frame/pkg/version/verflag"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var (
@@ -64,6 +65,7 @@ type App struct {
 	description string
 	options     optionsCli.CliOptions
 	runFunc     RunFunc
+	reloadFunc  ReloadFunc
 	noConfig    bool
 	commands    []*Command
 	args        cobra.PositionalArgs
@@ -126,6 +128,7 @@ func (a *App) buildCommand() {
 	if !a.noConfig {
 		addConfigFlag(a.confName, namedFlagSets.FlagSet("global"))
 	}
+	verflag.AddFlags(namedFlagSets.FlagSet("global"))
 	globalflag.AddGlobalFlags(namedFlagSets.FlagSet("global"), cmd.Name())
 	// add new global flagset to cmd FlagSet
 	cmd.Flags().AddFlagSet(namedFlagSets.FlagSet("global"))
@@ -156,6 +159,25 @@ func WithRunFunc(run RunFunc) Option {
 	}
 }
 
+// ReloadFunc defines the callback invoked after the watched configuration
+// file changed. The file has already been read again into viper.
+type ReloadFunc func(basename string) error
+
+// WithReloadFunc watches the configuration file and calls reload whenever it
+// changes.
+func WithReloadFunc(reload ReloadFunc) Option {
+	return func(a *App) {
+		a.reloadFunc = reload
+	}
+}
+
+// WithCommands adds sub commands to the application.
+func WithCommands(cmds ...*Command) Option {
+	return func(a *App) {
+		a.commands = append(a.commands, cmds...)
+	}
+}
+
 // WithDescription is used to set the description of the application.
 func WithDescription(desc string) Option {
 	return func(a *App) {
@@ -183,25 +205,58 @@ func addCmdTemplate(cmd *cobra.Command, namedFlagSets cliflag.NamedFlagSets) {
 	cols, _, _ := term.TerminalSize(cmd.OutOrStdout())
 	cmd.SetUsageFunc(func(cmd *cobra.Command) error {
 		fmt.Fprintf(cmd.OutOrStderr(), usageFmt, cmd.UseLine())
+		printCommands(cmd.OutOrStderr(), cmd)
 		cliflag.PrintSections(cmd.OutOrStderr(), namedFlagSets, cols)
 
 		return nil
 	})
 	cmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
-		fmt.Fprintf(cmd.OutOrStdout(), "%s\n\n"+usageFmt, cmd.Long, cmd.UseLine())
+		desc := cmd.Long
+		if desc == "" {
+			desc = cmd.Short
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%s\n\n"+usageFmt, desc, cmd.UseLine())
+		printCommands(cmd.OutOrStdout(), cmd)
 		cliflag.PrintSections(cmd.OutOrStdout(), namedFlagSets, cols)
 	})
 }
 
+// printCommands lists the available sub commands of cmd.
+func printCommands(w io.Writer, cmd *cobra.Command) {
+	if !cmd.HasAvailableSubCommands() {
+		return
+	}
+	fmt.Fprintf(w, "\nAvailable Commands:\n")
+	for _, c := range cmd.Commands() {
+		if c.IsAvailableCommand() {
+			fmt.Fprintf(w, "  %s %s\n", rpad(c.Name(), c.NamePadding()), c.Short)
+		}
+	}
+	fmt.Fprintf(w, "\nUse \"%s [command] --help\" for more information about a command.\n", cmd.CommandPath())
+}
+
+func rpad(s string, padding int) string {
+	return fmt.Sprintf(fmt.Sprintf("%%-%ds", padding), s)
+}
+
 func (a *App) runCommand(cmd *cobra.Command, args []string) error {
+	verflag.PrintAndExitIfRequested()
+
 	printWorkingDir()
 	cliflag.PrintFlags(cmd.Flags())
 	if !a.noConfig {
-		if err := viper.BindPFlags(cmd.Flags()); err != nil {
+		if err := loadOptions(a.basename, cmd.Flags(), a.options); err != nil {
 			return err
 		}
 
-		if err := viper.Unmarshal(a.options); err != nil {
+		if a.reloadFunc != nil {
+			watchConfig(a.basename, a.reloadFunc)
+		}
+	}
+
+	if a.options != nil {
+		// report every configuration problem at once before anything starts
+		if err := optionsCli.Aggregate(a.options.Validate()); err != nil {
 			return err
 		}
 	}
@@ -6,9 +6,11 @@ import (
 	"runtime"
 	"strings"
 
+	cliflag "github.com/767829413/normal-frame/fork/component-base/cli/flag"
 	optionsCli "github.com/767829413/normal-frame/pkg/options"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // Command is a sub command structure of a cli application.
@@ -18,6 +20,7 @@ type Command struct {
 	usage    string
 	desc     string
 	options  optionsCli.CliOptions
+	flags    func(fs *pflag.FlagSet)
 	commands []*Command
 	runFunc  RunCommandFunc
 }
@@ -34,6 +37,14 @@ func WithCommandOptions(opt optionsCli.CliOptions) CommandOption {
 	}
 }
 
+// WithCommandFlags adds flags specific to the command, they are not read from
+// the configuration file.
+func WithCommandFlags(flags func(fs *pflag.FlagSet)) CommandOption {
+	return func(c *Command) {
+		c.flags = flags
+	}
+}
+
 // RunCommandFunc defines the application's command startup callback function.
 type RunCommandFunc func(args []string) error
 
@@ -85,18 +96,34 @@ func (c *Command) cobraCommand() *cobra.Command {
 	if c.runFunc != nil {
 		cmd.Run = c.runCommand
 	}
+
+	var namedFlagSets cliflag.NamedFlagSets
 	if c.options != nil {
-		for _, f := range c.options.Flags().FlagSets {
+		namedFlagSets = c.options.Flags()
+		for _, f := range namedFlagSets.FlagSets {
 			cmd.Flags().AddFlagSet(f)
 		}
 		// c.options.AddFlags(cmd.Flags())
+		namedFlagSets.FlagSet("global").AddFlag(pflag.Lookup(configFlagName))
+		namedFlagSets.FlagSet("global").AddFlag(pflag.Lookup(strictConfigFlagName))
+	}
+	if c.flags != nil {
+		c.flags(namedFlagSets.FlagSet("global"))
 	}
-	addHelpCommandFlag(c.usage, cmd.Flags())
+	addHelpCommandFlag(c.usage, namedFlagSets.FlagSet("global"))
+	cmd.Flags().AddFlagSet(namedFlagSets.FlagSet("global"))
+	addCmdTemplate(cmd, namedFlagSets)
 
 	return cmd
 }
 
 func (c *Command) runCommand(cmd *cobra.Command, args []string) {
+	if c.options != nil {
+		if err := loadOptions(cmd.Root().Name(), cmd.Flags(), c.options); err != nil {
+			log.Printf("%v %v\n", color.RedString("Error:"), err)
+			os.Exit(1)
+		}
+	}
 	if c.runFunc != nil {
 		if err := c.runFunc(args); err != nil {
 			log.Printf("%v %v\n", color.RedString("Error:"), err)
@@ -1,29 +1,44 @@
 package app
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
+	optionsCli "github.com/767829413/normal-frame/pkg/options"
+	"github.com/fatih/color"
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
-const configFlagName = "config"
+const (
+	configFlagName       = "config"
+	strictConfigFlagName = "strict-config"
+)
 
-var cfgFile string
+var (
+	cfgFile      string
+	strictConfig bool
+)
 
 //nolint: gochecknoinits
 func init() {
 	pflag.StringVarP(&cfgFile, "config", "c", cfgFile, "Read configuration from specified `FILE`, "+
-		"support JSON, TOML, YAML, HCL, or Java properties formats.")
+		"support JSON, TOML, YAML, HCL, or Java properties formats. "+
+		"Values are taken from flags first, then environment variables, then this file, then defaults.")
+	pflag.BoolVar(&strictConfig, strictConfigFlagName, strictConfig, ""+
+		"Fail instead of warning when the configuration file contains unknown keys.")
 }
 
 // addConfigFlag adds flags for a specific server to the specified FlagSet
 // object.
 func addConfigFlag(confName string, fs *pflag.FlagSet) {
 	fs.AddFlag(pflag.Lookup(configFlagName))
+	fs.AddFlag(pflag.Lookup(strictConfigFlagName))
 
 	cobra.OnInitialize(func() {
 		if cfgFile != "" {
@@ -34,8 +49,133 @@ func addConfigFlag(confName string, fs *pflag.FlagSet) {
 		}
 		log.Println(confName)
 		if err := viper.ReadInConfig(); err != nil {
+			// the configuration file is optional unless it is given explicitly,
+			// every option can be set with flags or environment variables
+			var notFound viper.ConfigFileNotFoundError
+			if cfgFile == "" && errors.As(err, &notFound) {
+				log.Printf("%v No configuration file %s found, using flags, environment and defaults", progressMessage, confName)
+				return
+			}
 			_, _ = fmt.Fprintf(os.Stderr, "Error: failed to read configuration file(%s): %v\n", cfgFile, err)
 			os.Exit(1)
 		}
 	})
 }
+
+// EnvPrefix returns the prefix of the environment variables overriding the
+// options of the application basename, e.g. APISERVER for apiserver.
+func EnvPrefix(basename string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(basename))
+}
+
+// bindEnv binds every configuration key of opts to an environment variable
+// named after the key with the prefix of basename, dots and dashes replaced by
+// underscores, e.g. mysql.max-idle-connections is read from
+// APISERVER_MYSQL_MAX_IDLE_CONNECTIONS. Lists are given comma separated and
+// maps as comma separated key=value pairs.
+//
+// Values are resolved in the order flag > env > file > default.
+func bindEnv(basename string, opts interface{}) error {
+	viper.SetEnvPrefix(EnvPrefix(basename))
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	viper.AutomaticEnv()
+
+	// AutomaticEnv only applies to keys viper already knows about, bind all
+	// of them so that options absent from the file can be set as well
+	for _, key := range optionsCli.Keys(opts) {
+		if err := viper.BindEnv(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadOptions merges flags, environment variables, the configuration file and
+// defaults into opts.
+func loadOptions(basename string, fs *pflag.FlagSet, opts interface{}) error {
+	if err := viper.BindPFlags(fs); err != nil {
+		return err
+	}
+	// a flag named differently from its option, e.g. --log.output for
+	// logs.out-put, must also be bound to the option key to take precedence
+	// over the configuration file
+	for name, key := range optionsCli.FlagKeys(opts, fs) {
+		if name == key {
+			continue
+		}
+		if err := viper.BindPFlag(key, fs.Lookup(name)); err != nil {
+			return err
+		}
+	}
+
+	if err := bindEnv(basename, opts); err != nil {
+		return err
+	}
+
+	if err := viper.Unmarshal(opts, viper.DecodeHook(optionsCli.DecodeHook())); err != nil {
+		return err
+	}
+
+	if err := checkUnknownKeys(opts); err != nil {
+		return err
+	}
+
+	if completeable, ok := opts.(optionsCli.CompleteableOptions); ok {
+		return completeable.Complete()
+	}
+
+	return nil
+}
+
+// checkUnknownKeys reports the keys of the configuration file that match no
+// option, which viper silently ignores. They are warnings unless
+// --strict-config is set.
+func checkUnknownKeys(opts interface{}) error {
+	file := viper.ConfigFileUsed()
+	if file == "" {
+		return nil
+	}
+	// read the file alone, the global viper also knows the flag names
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+
+	unknown := optionsCli.UnknownKeys(opts, v.AllKeys())
+	msgs := make([]string, 0, len(unknown))
+	for _, key := range unknown {
+		msg := fmt.Sprintf("unknown configuration key %q in %s", key, file)
+		if suggestion := optionsCli.SuggestKey(opts, key); suggestion != "" {
+			msg += fmt.Sprintf(", did you mean %q?", suggestion)
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	if strictConfig {
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+	for _, msg := range msgs {
+		log.Printf("%v %s", color.YellowString("Warning:"), msg)
+	}
+	return nil
+}
+
+// watchConfig watches the configuration file read at startup and calls reload
+// each time it is written.
+func watchConfig(basename string, reload ReloadFunc) {
+	if viper.ConfigFileUsed() == "" {
+		return
+	}
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		log.Printf("%v Configuration file %s changed, reloading", progressMessage, e.Name)
+		if err := reload(basename); err != nil {
+			log.Printf("%v failed to reload configuration, keep running with the previous one: %v",
+				color.RedString("Error:"), err)
+		}
+	})
+	viper.WatchConfig()
+}
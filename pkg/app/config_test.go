@@ -0,0 +1,79 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+type testMySQL struct {
+	Host               string `mapstructure:"host"`
+	MaxIdleConnections int    `mapstructure:"max-idle-connections"`
+}
+
+type testOptions struct {
+	MySQL   *testMySQL        `mapstructure:"mysql"`
+	Origins []string          `mapstructure:"allow-origins"`
+	Flags   map[string]bool   `mapstructure:"flags"`
+	Props   map[string]string `mapstructure:"instance-properties"`
+}
+
+func TestEnvPrefix(t *testing.T) {
+	for basename, want := range map[string]string{
+		"apiserver":    "APISERVER",
+		"order-worker": "ORDER_WORKER",
+		"shop.api":     "SHOP_API",
+	} {
+		if got := EnvPrefix(basename); got != want {
+			t.Errorf("EnvPrefix(%q) = %q, want %q", basename, got, want)
+		}
+	}
+}
+
+func TestLoadOptionsFromEnv(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	t.Setenv("TEST_APP_MYSQL_HOST", "db:3306")
+	t.Setenv("TEST_APP_MYSQL_MAX_IDLE_CONNECTIONS", "50")
+	t.Setenv("TEST_APP_ALLOW_ORIGINS", "https://a.example,https://b.example")
+	t.Setenv("TEST_APP_FLAGS", "checkout=true,legacy-search=false")
+	t.Setenv("TEST_APP_INSTANCE_PROPERTIES", "zone=eu-1")
+
+	opts := &testOptions{MySQL: &testMySQL{Host: "127.0.0.1:3306", MaxIdleConnections: 100}}
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.IntVar(&opts.MySQL.MaxIdleConnections, "mysql.max-idle-connections", opts.MySQL.MaxIdleConnections, "")
+	if err := fs.Parse([]string{"--mysql.max-idle-connections=10"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadOptions("test-app", fs, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if opts.MySQL.Host != "db:3306" {
+		t.Errorf("mysql.host = %q, want the environment value", opts.MySQL.Host)
+	}
+	if opts.MySQL.MaxIdleConnections != 10 {
+		t.Errorf("mysql.max-idle-connections = %d, want the flag to win over the environment", opts.MySQL.MaxIdleConnections)
+	}
+	if !reflect.DeepEqual(opts.Origins, []string{"https://a.example", "https://b.example"}) {
+		t.Errorf("allow-origins = %v", opts.Origins)
+	}
+	if !reflect.DeepEqual(opts.Flags, map[string]bool{"checkout": true, "legacy-search": false}) {
+		t.Errorf("flags = %v", opts.Flags)
+	}
+	if !reflect.DeepEqual(opts.Props, map[string]string{"zone": "eu-1"}) {
+		t.Errorf("instance-properties = %v", opts.Props)
+	}
+}
+
+func TestLoadOptionsRejectsMalformedMap(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	t.Setenv("TEST_APP_FLAGS", "checkout")
+	opts := &testOptions{MySQL: &testMySQL{}}
+	if err := loadOptions("test-app", pflag.NewFlagSet("test", pflag.ContinueOnError), opts); err == nil {
+		t.Error("a map that is not a list of key=value pairs was accepted")
+	}
+}
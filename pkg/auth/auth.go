@@ -0,0 +1,18 @@
+// Package auth hashes and checks user passwords.
+package auth
+
+import (
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Encrypt hashes the password with bcrypt.
+func Encrypt(source string) (string, error) {
+	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(source), bcrypt.DefaultCost)
+	return string(hashedBytes), err
+}
+
+// Compare compares the hashed password with the plain text one, it returns
+// nil when they match.
+func Compare(hashedPassword, password string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+}
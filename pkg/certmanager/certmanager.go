@@ -0,0 +1,316 @@
+// Package certmanager keeps a TLS certificate pair in memory and swaps it
+// whenever the files on disk are rewritten, so HTTPS and gRPC servers pick up
+// rotated certificates without a restart. The client CA bundle is reloaded
+// with the pair.
+package certmanager
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Client auth modes accepted by ParseClientAuth.
+const (
+	ClientAuthNone             = "none"
+	ClientAuthRequest          = "request"
+	ClientAuthRequireAndVerify = "require-and-verify"
+)
+
+// reloadDelay debounces bursts of file events, an agent usually rewrites the
+// certificate and the key one after the other.
+const reloadDelay = 500 * time.Millisecond
+
+var (
+	certExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tls_certificate_expiry_timestamp_seconds",
+		Help: "Expiry time of the served TLS certificate in unix seconds.",
+	}, []string{"cert_file"})
+
+	certReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tls_certificate_reloads_total",
+		Help: "Number of TLS certificate reload attempts by result.",
+	}, []string{"cert_file", "result"})
+
+	registerOnce sync.Once
+)
+
+// Manager serves a certificate pair through tls.Config.GetCertificate and
+// reloads it when the cert or key file changes. A pair that fails validation
+// is never swapped in, the previous one keeps being served.
+type Manager struct {
+	certFile string
+	keyFile  string
+
+	clientAuth tls.ClientAuthType
+	caFile     string
+
+	cert      atomic.Value // *tls.Certificate
+	clientCAs atomic.Value // *x509.CertPool
+
+	mu      sync.Mutex
+	watcher *fsnotify.Watcher
+	timer   *time.Timer
+	done    chan struct{}
+}
+
+// Option configures optional behaviour of a Manager.
+type Option func(*Manager) error
+
+// WithClientAuth requires or requests client certificates signed by one of the
+// CAs in the PEM bundle caFile.
+func WithClientAuth(caFile string, mode tls.ClientAuthType) Option {
+	return func(m *Manager) error {
+		m.clientAuth = mode
+		m.caFile = caFile
+		return nil
+	}
+}
+
+// New loads the given pair and returns a Manager serving it.
+func New(certFile, keyFile string, opts ...Option) (*Manager, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both cert file and key file must be specified")
+	}
+	registerOnce.Do(func() {
+		prometheus.MustRegister(certExpiry, certReloads)
+	})
+
+	m := &Manager{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	for _, o := range opts {
+		if err := o(m); err != nil {
+			return nil, err
+		}
+	}
+	if m.clientAuth >= tls.VerifyClientCertIfGiven && m.caFile == "" {
+		return nil, errors.New("client certificate verification requires a client CA bundle")
+	}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GetCertificate returns the current certificate, it matches the signature of
+// tls.Config.GetCertificate.
+func (m *Manager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, _ := m.cert.Load().(*tls.Certificate)
+	if cert == nil {
+		return nil, errors.New("no certificate loaded")
+	}
+	return cert, nil
+}
+
+// Certificate returns the parsed leaf certificate currently served.
+func (m *Manager) Certificate() *x509.Certificate {
+	cert, _ := m.cert.Load().(*tls.Certificate)
+	if cert == nil {
+		return nil
+	}
+	return cert.Leaf
+}
+
+// ClientCAs returns the client CA bundle currently trusted, nil when the
+// manager has none.
+func (m *Manager) ClientCAs() *x509.CertPool {
+	pool, _ := m.clientCAs.Load().(*x509.CertPool)
+	return pool
+}
+
+// TLSConfig returns a server side tls.Config backed by the manager. With a
+// client CA bundle, each handshake uses the bundle loaded last.
+func (m *Manager) TLSConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: m.GetCertificate,
+		ClientAuth:     m.clientAuth,
+		ClientCAs:      m.ClientCAs(),
+	}
+	if m.caFile != "" {
+		cfg.GetConfigForClient = m.getConfigForClient
+	}
+	return cfg
+}
+
+// getConfigForClient replaces the config of the server for one handshake, it
+// offers the protocols the HTTPS and gRPC servers add to their own config.
+func (m *Manager) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: m.GetCertificate,
+		ClientAuth:     m.clientAuth,
+		ClientCAs:      m.ClientCAs(),
+		NextProtos:     []string{"h2", "http/1.1"},
+	}, nil
+}
+
+// ParseClientAuth converts a client auth mode name to its tls.ClientAuthType.
+// "request" verifies a certificate when the client sends one, so identities
+// taken from the connection are always backed by a verified chain.
+func ParseClientAuth(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "", ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthRequest:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequireAndVerify:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unknown client auth mode %q, must be one of %s, %s or %s",
+			mode, ClientAuthNone, ClientAuthRequest, ClientAuthRequireAndVerify)
+	}
+}
+
+// Reload reads the pair and the client CA bundle from disk, validates them and
+// swaps them in. On error the previously loaded ones are kept.
+func (m *Manager) Reload() error {
+	cert, err := loadPair(m.certFile, m.keyFile)
+	var pool *x509.CertPool
+	if err == nil && m.caFile != "" {
+		pool, err = loadCAPool(m.caFile)
+	}
+	if err != nil {
+		certReloads.WithLabelValues(m.certFile, "failure").Inc()
+		return err
+	}
+	m.cert.Store(cert)
+	if pool != nil {
+		m.clientCAs.Store(pool)
+	}
+	certReloads.WithLabelValues(m.certFile, "success").Inc()
+	certExpiry.WithLabelValues(m.certFile).Set(float64(cert.Leaf.NotAfter.Unix()))
+	return nil
+}
+
+// Watch starts watching the directories holding the cert, key and client CA
+// files.
+// Directories are watched instead of the files themselves so that atomic
+// renames and kubernetes secret symlink swaps are noticed as well.
+func (m *Manager) Watch() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.watcher != nil {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	dirs := map[string]struct{}{
+		filepath.Dir(m.certFile): {},
+		filepath.Dir(m.keyFile):  {},
+	}
+	if m.caFile != "" {
+		dirs[filepath.Dir(m.caFile)] = struct{}{}
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return fmt.Errorf("watch %s: %w", dir, err)
+		}
+	}
+	m.watcher = watcher
+	m.done = make(chan struct{})
+	go m.loop(watcher, m.done)
+	return nil
+}
+
+func (m *Manager) loop(watcher *fsnotify.Watcher, done chan struct{}) {
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+				continue
+			}
+			m.scheduleReload()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("certmanager: watch %s failed: %v", m.certFile, err)
+		case <-done:
+			return
+		}
+	}
+}
+
+func (m *Manager) scheduleReload() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	m.timer = time.AfterFunc(reloadDelay, func() {
+		if err := m.Reload(); err != nil {
+			log.Printf("certmanager: keep serving the previous certificate, reload %s failed: %v", m.certFile, err)
+			return
+		}
+		log.Printf("certmanager: reloaded certificate %s, expires at %s",
+			m.certFile, m.Certificate().NotAfter.Format(time.RFC3339))
+	})
+}
+
+// Close stops watching the files.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	if m.watcher == nil {
+		return nil
+	}
+	close(m.done)
+	err := m.watcher.Close()
+	m.watcher = nil
+	return err
+}
+
+func loadCAPool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client CA bundle %s: %w", caFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in client CA bundle %s", caFile)
+	}
+	return pool, nil
+}
+
+func loadPair(certFile, keyFile string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load key pair %s, %s: %w", certFile, keyFile, err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate %s: %w", certFile, err)
+	}
+	now := time.Now()
+	if now.After(leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate %s expired at %s", certFile, leaf.NotAfter.Format(time.RFC3339))
+	}
+	if now.Before(leaf.NotBefore) {
+		return nil, fmt.Errorf("certificate %s is not valid before %s", certFile, leaf.NotBefore.Format(time.RFC3339))
+	}
+	cert.Leaf = leaf
+	return &cert, nil
+}
@@ -0,0 +1,185 @@
+package certmanager
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var serial int64
+
+// issue returns the PEM cert and key of tmpl signed by parent, or self-signed
+// when parent is nil.
+func issue(t *testing.T, tmpl *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial++
+	tmpl.SerialNumber = big.NewInt(serial)
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if tmpl.NotAfter.IsZero() {
+		tmpl.NotAfter = time.Now().Add(time.Hour)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writePair writes a self-signed pair named cn valid from notBefore to
+// notAfter, zero values meaning one hour around now.
+func writePair(t *testing.T, certFile, keyFile, cn string, notBefore, notAfter time.Time) {
+	t.Helper()
+	_, _, certPEM, keyPEM := issue(t, &x509.Certificate{
+		Subject:   pkix.Name{CommonName: cn},
+		NotBefore: notBefore,
+		NotAfter:  notAfter,
+	}, nil, nil)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+}
+
+func writeFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testFiles(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	return filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+}
+
+func servedName(t *testing.T, m *Manager) string {
+	t.Helper()
+	cert, err := m.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf.Subject.CommonName
+}
+
+func TestReloadKeepsPreviousPair(t *testing.T) {
+	certFile, keyFile := testFiles(t)
+	writePair(t, certFile, keyFile, "first", time.Time{}, time.Time{})
+	m, err := New(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(certExpiry.WithLabelValues(certFile)); got != float64(m.Certificate().NotAfter.Unix()) {
+		t.Errorf("expiry metric = %v, want %d", got, m.Certificate().NotAfter.Unix())
+	}
+
+	for name, write := range map[string]func(){
+		"broken": func() { writeFile(t, certFile, []byte("not a certificate")) },
+		"expired": func() {
+			writePair(t, certFile, keyFile, "expired", time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+		},
+		"not yet valid": func() {
+			writePair(t, certFile, keyFile, "future", time.Now().Add(time.Hour), time.Now().Add(2*time.Hour))
+		},
+		"mismatched key": func() {
+			writePair(t, certFile, filepath.Join(filepath.Dir(keyFile), "other.key"), "mismatched", time.Time{}, time.Time{})
+		},
+	} {
+		write()
+		failures := testutil.ToFloat64(certReloads.WithLabelValues(certFile, "failure"))
+		if err := m.Reload(); err == nil {
+			t.Errorf("%s pair: Reload succeeded", name)
+		}
+		if got := servedName(t, m); got != "first" {
+			t.Errorf("%s pair: serving %q, want the previous certificate", name, got)
+		}
+		if got := testutil.ToFloat64(certReloads.WithLabelValues(certFile, "failure")); got != failures+1 {
+			t.Errorf("%s pair: failure metric = %v, want %v", name, got, failures+1)
+		}
+	}
+
+	writePair(t, certFile, keyFile, "second", time.Time{}, time.Now().Add(48*time.Hour))
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := servedName(t, m); got != "second" {
+		t.Errorf("serving %q, want the new certificate", got)
+	}
+	if got := testutil.ToFloat64(certExpiry.WithLabelValues(certFile)); got != float64(m.Certificate().NotAfter.Unix()) {
+		t.Errorf("expiry metric = %v, want %d", got, m.Certificate().NotAfter.Unix())
+	}
+}
+
+func TestNewRejectsInvalidPair(t *testing.T) {
+	certFile, keyFile := testFiles(t)
+	writePair(t, certFile, keyFile, "expired", time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+	if _, err := New(certFile, keyFile); err == nil {
+		t.Error("New accepted an expired certificate")
+	}
+	if _, err := New(certFile, ""); err == nil {
+		t.Error("New accepted a missing key file")
+	}
+}
+
+func TestWatchDebounces(t *testing.T) {
+	certFile, keyFile := testFiles(t)
+	writePair(t, certFile, keyFile, "first", time.Time{}, time.Time{})
+	m, err := New(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	successes := testutil.ToFloat64(certReloads.WithLabelValues(certFile, "success"))
+
+	// a burst of writes, each one before the reload delay of the previous one
+	for i, cn := range []string{"second", "third", "fourth"} {
+		if i > 0 {
+			time.Sleep(reloadDelay / 5)
+		}
+		writePair(t, certFile, keyFile, cn, time.Time{}, time.Time{})
+	}
+	if got := servedName(t, m); got != "first" {
+		t.Errorf("serving %q before the reload delay, want the previous certificate", got)
+	}
+
+	deadline := time.Now().Add(5 * reloadDelay)
+	for servedName(t, m) != "fourth" && time.Now().Before(deadline) {
+		time.Sleep(reloadDelay / 10)
+	}
+	if got := servedName(t, m); got != "fourth" {
+		t.Fatalf("serving %q, want the last written certificate", got)
+	}
+	time.Sleep(2 * reloadDelay)
+	if got := testutil.ToFloat64(certReloads.WithLabelValues(certFile, "success")); got != successes+1 {
+		t.Errorf("%v reloads, want the burst coalesced into one", got-successes)
+	}
+}
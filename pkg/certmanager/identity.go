@@ -0,0 +1,109 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+const spiffeScheme = "spiffe"
+
+// Identity describes a peer authenticated with a verified client certificate.
+type Identity struct {
+	CommonName string   `json:"commonName"`
+	DNSNames   []string `json:"dnsNames,omitempty"`
+	URIs       []string `json:"uris,omitempty"`
+	// SPIFFEID is the first spiffe:// URI SAN of the certificate, if any.
+	SPIFFEID string `json:"spiffeId,omitempty"`
+}
+
+// Name returns the most specific name of the identity, the SPIFFE ID when
+// present and the common name otherwise.
+func (i *Identity) Name() string {
+	if i.SPIFFEID != "" {
+		return i.SPIFFEID
+	}
+	return i.CommonName
+}
+
+// IdentityFromCertificate extracts the identity of a client certificate.
+func IdentityFromCertificate(cert *x509.Certificate) *Identity {
+	id := &Identity{
+		CommonName: cert.Subject.CommonName,
+		DNSNames:   cert.DNSNames,
+	}
+	for _, uri := range cert.URIs {
+		id.URIs = append(id.URIs, uri.String())
+		if id.SPIFFEID == "" && strings.EqualFold(uri.Scheme, spiffeScheme) {
+			id.SPIFFEID = uri.String()
+		}
+	}
+	return id
+}
+
+// IdentityFromConnectionState returns the identity of the verified client
+// certificate of a TLS connection, or nil when the client was not verified.
+func IdentityFromConnectionState(cs *tls.ConnectionState) *Identity {
+	if cs == nil || len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return IdentityFromCertificate(cs.VerifiedChains[0][0])
+}
+
+type identityKey struct{}
+
+// NewContext returns a copy of ctx carrying the client identity.
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the client identity stored in ctx.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok && id != nil
+}
+
+func identityFromPeer(ctx context.Context) context.Context {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ctx
+	}
+	if id := IdentityFromConnectionState(&info.State); id != nil {
+		return NewContext(ctx, id)
+	}
+	return ctx
+}
+
+// UnaryServerInterceptor stores the verified client identity of a gRPC call
+// in its context.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(identityFromPeer(ctx), req)
+	}
+}
+
+// StreamServerInterceptor stores the verified client identity of a gRPC
+// stream in its context.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &identityStream{ServerStream: ss, ctx: identityFromPeer(ss.Context())})
+	}
+}
+
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,284 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	cert, key, certPEM, _ := issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	return &testCA{cert: cert, key: key, pem: certPEM}
+}
+
+// client returns a client certificate signed by the CA.
+func (ca *testCA) client(t *testing.T, tmpl *x509.Certificate) tls.Certificate {
+	t.Helper()
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	_, _, certPEM, keyPEM := issue(t, tmpl, ca.cert, ca.key)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestIdentityFromConnectionState(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	leaf := func(tmpl *x509.Certificate) *x509.Certificate {
+		cert, err := x509.ParseCertificate(ca.client(t, tmpl).Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	service := leaf(&x509.Certificate{
+		Subject:  pkix.Name{CommonName: "orders"},
+		DNSNames: []string{"orders.shop.svc", "orders"},
+		URIs: []*url.URL{
+			mustParseURL(t, "https://orders.shop.example"),
+			mustParseURL(t, "spiffe://shop.example/ns/shop/sa/orders"),
+			mustParseURL(t, "spiffe://shop.example/ns/shop/sa/other"),
+		},
+	})
+	plain := leaf(&x509.Certificate{Subject: pkix.Name{CommonName: "batch"}})
+
+	id := IdentityFromConnectionState(&tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{service, ca.cert}}})
+	if id == nil {
+		t.Fatal("no identity for a verified chain")
+	}
+	if id.CommonName != "orders" || strings.Join(id.DNSNames, ",") != "orders.shop.svc,orders" {
+		t.Errorf("identity = %+v", id)
+	}
+	if strings.Join(id.URIs, ",") != "https://orders.shop.example,spiffe://shop.example/ns/shop/sa/orders,spiffe://shop.example/ns/shop/sa/other" {
+		t.Errorf("URIs = %v", id.URIs)
+	}
+	if id.SPIFFEID != "spiffe://shop.example/ns/shop/sa/orders" || id.Name() != id.SPIFFEID {
+		t.Errorf("SPIFFE ID = %q, name = %q, want the first spiffe URI", id.SPIFFEID, id.Name())
+	}
+
+	id = IdentityFromConnectionState(&tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{plain, ca.cert}}})
+	if id == nil || id.SPIFFEID != "" || id.Name() != "batch" {
+		t.Errorf("identity = %+v, want the common name", id)
+	}
+
+	// a certificate sent but not verified is no identity
+	for _, cs := range []*tls.ConnectionState{nil, {}, {PeerCertificates: []*x509.Certificate{service}}} {
+		if id := IdentityFromConnectionState(cs); id != nil {
+			t.Errorf("identity of %+v = %+v, want none", cs, id)
+		}
+	}
+}
+
+// identityServer serves the name of the client identity over TLS.
+func identityServer(t *testing.T, m *Manager) *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := IdentityFromConnectionState(r.TLS); id != nil {
+			_, _ = io.WriteString(w, id.Name())
+		}
+	}))
+	srv.TLS = m.TLSConfig()
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// get returns the identity the server saw, or the error of the request. The
+// certificate is sent even when the server does not list its CA.
+func get(srv *httptest.Server, certs ...tls.Certificate) (string, error) {
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if len(certs) == 0 {
+				return &tls.Certificate{}, nil
+			}
+			return &certs[0], nil
+		},
+	}}}
+	defer client.CloseIdleConnections()
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestClientAuth(t *testing.T) {
+	ca, other := newTestCA(t, "ca"), newTestCA(t, "other")
+	certFile, keyFile := testFiles(t)
+	writePair(t, certFile, keyFile, "server", time.Time{}, time.Time{})
+	caFile := filepath.Join(filepath.Dir(certFile), "ca.crt")
+	writeFile(t, caFile, ca.pem)
+	trusted := ca.client(t, &x509.Certificate{Subject: pkix.Name{CommonName: "orders"}})
+	untrusted := other.client(t, &x509.Certificate{Subject: pkix.Name{CommonName: "intruder"}})
+
+	for _, tt := range []struct {
+		mode      string
+		anonymous bool
+	}{
+		{mode: ClientAuthRequest, anonymous: true},
+		{mode: ClientAuthRequireAndVerify},
+	} {
+		t.Run(tt.mode, func(t *testing.T) {
+			mode, err := ParseClientAuth(tt.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := New(certFile, keyFile, WithClientAuth(caFile, mode))
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv := identityServer(t, m)
+
+			if name, err := get(srv, trusted); err != nil || name != "orders" {
+				t.Errorf("trusted client: identity %q, %v", name, err)
+			}
+			if _, err := get(srv, untrusted); err == nil {
+				t.Error("a client signed by an unknown CA was accepted")
+			}
+			name, err := get(srv)
+			if tt.anonymous && (err != nil || name != "") {
+				t.Errorf("anonymous client: identity %q, %v, want accepted without identity", name, err)
+			}
+			if !tt.anonymous && err == nil {
+				t.Error("a client without certificate was accepted")
+			}
+		})
+	}
+
+	if _, err := New(certFile, keyFile, WithClientAuth("", tls.RequireAndVerifyClientCert)); err == nil {
+		t.Error("New accepted client verification without a CA bundle")
+	}
+	if _, err := ParseClientAuth("optional"); err == nil {
+		t.Error("ParseClientAuth accepted an unknown mode")
+	}
+}
+
+func TestReloadClientCAs(t *testing.T) {
+	ca, next := newTestCA(t, "ca"), newTestCA(t, "next")
+	certFile, keyFile := testFiles(t)
+	writePair(t, certFile, keyFile, "server", time.Time{}, time.Time{})
+	caFile := filepath.Join(filepath.Dir(certFile), "ca.crt")
+	writeFile(t, caFile, ca.pem)
+	m, err := New(certFile, keyFile, WithClientAuth(caFile, tls.RequireAndVerifyClientCert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := identityServer(t, m)
+	client := next.client(t, &x509.Certificate{Subject: pkix.Name{CommonName: "orders"}})
+	if _, err := get(srv, client); err == nil {
+		t.Fatal("a client signed by a CA not in the bundle was accepted")
+	}
+
+	// a broken bundle keeps the previous one
+	writeFile(t, caFile, []byte("not a certificate"))
+	if err := m.Reload(); err == nil {
+		t.Error("Reload accepted a broken CA bundle")
+	}
+	if m.ClientCAs() == nil {
+		t.Fatal("the previous CA bundle was dropped")
+	}
+
+	writeFile(t, caFile, next.pem)
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if name, err := get(srv, client); err != nil || name != "orders" {
+		t.Errorf("identity %q, %v, want the client signed by the reloaded CA accepted", name, err)
+	}
+}
+
+func TestServerInterceptors(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	cert, err := x509.ParseCertificate(ca.client(t, &x509.Certificate{Subject: pkix.Name{CommonName: "orders"}}).Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{
+		State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert, ca.cert}}},
+	}})
+	anonymous := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{}})
+
+	for _, tt := range []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "verified", ctx: verified, want: "orders"},
+		{name: "anonymous", ctx: anonymous},
+		{name: "no peer", ctx: context.Background()},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			name := func(ctx context.Context) string {
+				if id, ok := FromContext(ctx); ok {
+					return id.Name()
+				}
+				return ""
+			}
+			var got string
+			_, err := UnaryServerInterceptor()(tt.ctx, nil, &grpc.UnaryServerInfo{},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					got = name(ctx)
+					return nil, nil
+				})
+			if err != nil || got != tt.want {
+				t.Errorf("unary call identity = %q, %v, want %q", got, err, tt.want)
+			}
+			got = ""
+			err = StreamServerInterceptor()(nil, &contextStream{ctx: tt.ctx}, &grpc.StreamServerInfo{},
+				func(srv interface{}, ss grpc.ServerStream) error {
+					got = name(ss.Context())
+					return nil
+				})
+			if err != nil || got != tt.want {
+				t.Errorf("stream identity = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
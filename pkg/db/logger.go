@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/767829413/normal-frame/internal/pkg/logger"
+	"gorm.io/gorm"
+	glogger "gorm.io/gorm/logger"
+)
+
+// slowThreshold is the duration above which a query is logged as slow.
+const slowThreshold = time.Second
+
+// gormLogger writes the gorm logs to the mysql category of the logger of the
+// query context, so they carry the fields of the request.
+type gormLogger struct {
+	level glogger.LogLevel
+}
+
+func newGormLogger(level glogger.LogLevel) glogger.Interface {
+	return &gormLogger{level: level}
+}
+
+func (l *gormLogger) LogMode(level glogger.LogLevel) glogger.Interface {
+	return &gormLogger{level: level}
+}
+
+func (l *gormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= glogger.Info {
+		logger.FromContext(ctx).Named(logger.LogNameMysql).Infof(msg, args...)
+	}
+}
+
+func (l *gormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= glogger.Warn {
+		logger.FromContext(ctx).Named(logger.LogNameMysql).Warnf(msg, args...)
+	}
+}
+
+func (l *gormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= glogger.Error {
+		logger.FromContext(ctx).Named(logger.LogNameMysql).Errorf(msg, args...)
+	}
+}
+
+// Trace logs the failed and slow queries, and every query at the Info level.
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= glogger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= glogger.Error:
+		sql, rows := fc()
+		logger.FromContext(ctx).Named(logger.LogNameMysql).Errorf("%s [%s] [rows:%d] %s", err, elapsed, rows, sql)
+	case elapsed > slowThreshold && l.level >= glogger.Warn:
+		sql, rows := fc()
+		logger.FromContext(ctx).Named(logger.LogNameMysql).Warnf("slow sql >= %s [%s] [rows:%d] %s", slowThreshold, elapsed, rows, sql)
+	case l.level >= glogger.Info:
+		sql, rows := fc()
+		logger.FromContext(ctx).Named(logger.LogNameMysql).Infof("[%s] [rows:%d] %s", elapsed, rows, sql)
+	}
+}
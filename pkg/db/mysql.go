@@ -2,8 +2,6 @@ package db
 
 import (
 	"fmt"
-	"log"
-	"os"
 	"time"
 
 	"github.com/767829413/normal-frame/internal/pkg/logger"
@@ -45,17 +43,12 @@ func New(opts *Options) (*gorm.DB, error) {
 		},
 	}
 
+	// 慢查询和错误写入日志, debug时按LogLevel记录每条SQL
+	level := glogger.Warn
 	if opts.IsDebug {
-		newLogger := glogger.New(
-			log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
-			glogger.Config{
-				SlowThreshold: time.Second,  // 慢 SQL 阈值
-				LogLevel:      glogger.Info, // Log level
-				Colorful:      true,         // 禁用彩色打印
-			},
-		)
-		config.Logger = newLogger
+		level = glogger.LogLevel(opts.LogLevel)
 	}
+	config.Logger = newGormLogger(level)
 
 	db, err := gorm.Open(mysql.Open(dsn), config)
 	if err != nil {
@@ -0,0 +1,279 @@
+// Package httpclient calls the other services over HTTP. Each request is an
+// exit span of the trace of its context, carries the request ID and is
+// counted in the http_client_* metrics.
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/767829413/normal-frame/internal/pkg/logger"
+	"github.com/767829413/normal-frame/internal/pkg/options"
+	"github.com/767829413/normal-frame/pkg/apm"
+)
+
+var (
+	defaultClient *Client
+	once          sync.Once
+)
+
+// otherRoute is the route label of the calls without WithRoute, the path of
+// the request would make a series of each ID it holds.
+const otherRoute = "other"
+
+// Client sends the requests of the services. The idempotent requests failing
+// with a network error or a 502, 503 or 504 response are sent again after a
+// jittered exponential backoff.
+type Client struct {
+	client *http.Client
+	opts   *options.HTTPClientOptions
+	tracer apm.Tracer
+}
+
+// GetClientOr returns the client shared by the services, created from opts
+// and tracer on the first call. It returns nil when opts is nil and the client
+// was not created yet.
+func GetClientOr(opts *options.HTTPClientOptions, tracer apm.Tracer) *Client {
+	if opts == nil {
+		return defaultClient
+	}
+	once.Do(func() {
+		defaultClient = New(opts, tracer)
+	})
+	return defaultClient
+}
+
+// New returns a client with the timeout, retries and connection pool of opts.
+// The requests are traced when tracer is not nil.
+func New(opts *options.HTTPClientOptions, tracer apm.Tracer) *Client {
+	registerMetrics()
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = opts.MaxIdleConns
+	transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = opts.MaxConnsPerHost
+	transport.IdleConnTimeout = opts.IdleConnTimeout
+	return &Client{
+		client: &http.Client{Transport: transport},
+		opts:   opts,
+		tracer: tracer,
+	}
+}
+
+// CallOption changes the settings of the client for one call.
+type CallOption func(*call)
+
+type call struct {
+	timeout time.Duration
+	retries int
+	route   string
+}
+
+// WithTimeout bounds the call, its retries and the read of the response body
+// by d instead of the timeout of the client. Zero means no timeout.
+func WithTimeout(d time.Duration) CallOption {
+	return func(c *call) {
+		c.timeout = d
+	}
+}
+
+// WithRetries sets the number of retries of the call.
+func WithRetries(n int) CallOption {
+	return func(c *call) {
+		c.retries = n
+	}
+}
+
+// WithRoute names the call after the route template, e.g. /v1/users/:id, in
+// the span and the metrics. The calls without route are labelled other in the
+// metrics and their span is named after the method only.
+func WithRoute(route string) CallOption {
+	return func(c *call) {
+		c.route = route
+	}
+}
+
+// Get sends a GET request to url.
+func (c *Client) Get(ctx context.Context, url string, opts ...CallOption) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req, opts...)
+}
+
+// Post sends a POST request to url. It is not retried unless it has an
+// Idempotency-Key header, so it is better built with NewRequestWithContext
+// and sent with Do.
+func (c *Client) Post(ctx context.Context, url, contentType string, body io.Reader, opts ...CallOption) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.Do(req, opts...)
+}
+
+// Do sends req and returns the response of the last attempt, its body must be
+// closed. The request is retried when it is idempotent and its body can be
+// read again through GetBody, as set by http.NewRequest.
+func (c *Client) Do(req *http.Request, opts ...CallOption) (*http.Response, error) {
+	cl := call{timeout: c.opts.Timeout, retries: c.opts.MaxRetries}
+	for _, o := range opts {
+		o(&cl)
+	}
+	if !replayable(req) {
+		cl.retries = 0
+	}
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if cl.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, cl.timeout)
+	}
+	log := logger.FromContext(ctx).Named(logger.LogNameHTTP)
+
+	for attempt := 0; ; attempt++ {
+		r := req.Clone(ctx)
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			r.Body = body
+		}
+		resp, err := c.send(r, cl.route)
+
+		retry := attempt < cl.retries && retryable(resp, err) && ctx.Err() == nil
+		if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+			msg := fmt.Sprintf("%s %s attempt %d", req.Method, req.URL.Redacted(), attempt+1)
+			if err != nil {
+				msg += ": " + err.Error()
+			} else {
+				msg += ": " + resp.Status
+			}
+			if retry {
+				msg += ", retrying"
+			}
+			log.Warn(msg)
+		}
+		if !retry {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		retries.WithLabelValues(req.URL.Host, routeLabel(cl.route)).Inc()
+
+		timer := time.NewTimer(c.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			cancel()
+			return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Redacted(), ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// send sends one attempt of a call as an exit span of the trace of its
+// context, and records its duration.
+func (c *Client) send(req *http.Request, route string) (*http.Response, error) {
+	if id := logger.RequestID(req.Context()); id != "" && req.Header.Get(logger.RequestIDHeader) == "" {
+		req.Header.Set(logger.RequestIDHeader, id)
+	}
+	end := func(*http.Response, error) {}
+	if c.tracer != nil {
+		end = c.tracer.StartHTTPClient(req, fmt.Sprintf("/%s%s", req.Method, route))
+	}
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	end(resp, err)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	requestDuration.WithLabelValues(req.URL.Host, routeLabel(route), req.Method, code).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// routeLabel returns the route label of the metrics of a call.
+func routeLabel(route string) string {
+	if route == "" {
+		return otherRoute
+	}
+	return route
+}
+
+// backoff returns the wait before the retry following attempt: the retry
+// backoff doubled for each attempt up to the maximum, the upper half of it
+// being random.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.opts.RetryBackoff
+	for i := 0; i < attempt && d < c.opts.MaxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > c.opts.MaxRetryBackoff {
+		d = c.opts.MaxRetryBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// CloseIdleConnections closes the connections of the pool not in use.
+func (c *Client) CloseIdleConnections() {
+	c.client.CloseIdleConnections()
+}
+
+// replayable reports whether req can be sent again: its method is idempotent,
+// or it has an idempotency key, and its body can be read again.
+func replayable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	for key := range req.Header {
+		if strings.EqualFold(key, "Idempotency-Key") || strings.EqualFold(key, "X-Idempotency-Key") {
+			return true
+		}
+	}
+	return false
+}
+
+// retryable reports whether an attempt failed in a way another one may not.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// cancelBody releases the timeout of a call once its body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
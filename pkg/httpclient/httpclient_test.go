@@ -0,0 +1,230 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/767829413/normal-frame/internal/pkg/logger"
+	"github.com/767829413/normal-frame/internal/pkg/options"
+	"github.com/767829413/normal-frame/pkg/apm"
+)
+
+func newTestClient(tracer apm.Tracer) *Client {
+	opts := options.NewHTTPClientOptions()
+	opts.RetryBackoff, opts.MaxRetryBackoff = time.Millisecond, 5*time.Millisecond
+	return New(opts, tracer)
+}
+
+// statusServer answers the requests with the statuses in turn, then 200.
+func statusServer(t *testing.T, statuses ...int) (*httptest.Server, func() []string) {
+	var mutex sync.Mutex
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+		bodies = append(bodies, string(body))
+		if len(statuses) > 0 {
+			w.WriteHeader(statuses[0])
+			statuses = statuses[1:]
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return bodies
+	}
+}
+
+func TestRetries(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		method   string
+		header   string
+		statuses []int
+		want     int
+		calls    int
+	}{
+		{name: "recovered", method: http.MethodGet, statuses: []int{503, 502}, want: 200, calls: 3},
+		{name: "exhausted", method: http.MethodGet, statuses: []int{503, 503, 504, 503}, want: 504, calls: 3},
+		{name: "not retryable", method: http.MethodPut, statuses: []int{500}, want: 500, calls: 1},
+		{name: "post", method: http.MethodPost, statuses: []int{503}, want: 503, calls: 1},
+		{name: "idempotency key", method: http.MethodPost, header: "Idempotency-Key", statuses: []int{503}, want: 200, calls: 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, bodies := statusServer(t, tt.statuses...)
+			req, err := http.NewRequest(tt.method, srv.URL+"/v1/orders", strings.NewReader("payload"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header != "" {
+				req.Header.Set(tt.header, "order-1")
+			}
+			resp, err := newTestClient(nil).Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if len(bodies()) != tt.calls {
+				t.Errorf("server called %d times, want %d", len(bodies()), tt.calls)
+			}
+			for i, body := range bodies() {
+				if body != "payload" {
+					t.Errorf("body of attempt %d = %q", i+1, body)
+				}
+			}
+			host := strings.TrimPrefix(srv.URL, "http://")
+			if got := testutil.ToFloat64(retries.WithLabelValues(host, otherRoute)); got != float64(tt.calls-1) {
+				t.Errorf("retries metric = %v, want %d", got, tt.calls-1)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	client := newTestClient(nil)
+
+	if _, err := client.Get(context.Background(), srv.URL+"/slow", WithTimeout(20*time.Millisecond)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Get error = %v, want the deadline exceeded", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("server called %d times, the timeout covers the retries", n)
+	}
+
+	// the timeout lasts until the body is closed
+	resp, err := client.Get(context.Background(), srv.URL+"/fast", WithTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, err := io.ReadAll(resp.Body); err != nil || string(body) != "ok" {
+		t.Errorf("body = %q, %v", body, err)
+	}
+}
+
+// fakeTracer writes a sw8 header and records the exit spans.
+type fakeTracer struct {
+	apm.Tracer
+	mutex      sync.Mutex
+	operations []string
+	codes      []int
+}
+
+func (t *fakeTracer) StartHTTPClient(req *http.Request, operation string) func(*http.Response, error) {
+	req.Header.Set("sw8", "1-trace")
+	t.mutex.Lock()
+	t.operations = append(t.operations, operation)
+	t.mutex.Unlock()
+	return func(resp *http.Response, err error) {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		if err != nil {
+			t.codes = append(t.codes, 0)
+			return
+		}
+		t.codes = append(t.codes, resp.StatusCode)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	var mutex sync.Mutex
+	var headers []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		headers = append(headers, r.Header.Clone())
+		if len(headers) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	tracer := &fakeTracer{}
+	ctx := logger.NewJobContext(context.Background(), "sync")
+
+	resp, err := newTestClient(tracer).Get(ctx, srv.URL+"/v1/users/42", WithRoute("/v1/users/:id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// every attempt is an exit span
+	if want := []string{"/GET/v1/users/:id", "/GET/v1/users/:id"}; strings.Join(tracer.operations, ",") != strings.Join(want, ",") {
+		t.Errorf("spans = %v, want %v", tracer.operations, want)
+	}
+	if len(tracer.codes) != 2 || tracer.codes[0] != 503 || tracer.codes[1] != 200 {
+		t.Errorf("span status codes = %v", tracer.codes)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, h := range headers {
+		if h.Get("sw8") != "1-trace" || h.Get(logger.RequestIDHeader) != logger.RequestID(ctx) {
+			t.Errorf("headers = %v, want the sw8 header and request ID %s", h, logger.RequestID(ctx))
+		}
+	}
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	for code, want := range map[string]uint64{"503": 1, "200": 1} {
+		var m dto.Metric
+		if err := requestDuration.WithLabelValues(host, "/v1/users/:id", http.MethodGet, code).(prometheus.Histogram).Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		if got := m.GetHistogram().GetSampleCount(); got != want {
+			t.Errorf("requests with code %s = %d, want %d", code, got, want)
+		}
+	}
+}
+
+func TestUnnamedRoute(t *testing.T) {
+	srv, _ := statusServer(t)
+	tracer := &fakeTracer{}
+	for _, id := range []string{"42", "43"} {
+		resp, err := newTestClient(tracer).Get(context.Background(), srv.URL+"/v1/users/"+id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if want := []string{"/GET", "/GET"}; strings.Join(tracer.operations, ",") != strings.Join(want, ",") {
+		t.Errorf("spans = %v, want %v", tracer.operations, want)
+	}
+	host := strings.TrimPrefix(srv.URL, "http://")
+	var m dto.Metric
+	if err := requestDuration.WithLabelValues(host, otherRoute, http.MethodGet, "200").(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.GetHistogram().GetSampleCount(); got != 2 {
+		t.Errorf("requests labelled %s = %d, want 2", otherRoute, got)
+	}
+	for _, path := range []string{"/v1/users/42", "/v1/users/43"} {
+		if requestDuration.DeleteLabelValues(host, path, http.MethodGet, "200") {
+			t.Errorf("a series is labelled with the path %s", path)
+		}
+	}
+}
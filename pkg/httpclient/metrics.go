@@ -0,0 +1,29 @@
+package httpclient
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_client_request_duration_seconds",
+		Help:    "Duration of the outgoing HTTP requests until the response headers, by host, route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"host", "route", "method", "code"})
+
+	retries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_retries_total",
+		Help: "Number of outgoing HTTP requests sent again after a failure, by host and route.",
+	}, []string{"host", "route"})
+
+	registerOnce sync.Once
+)
+
+// registerMetrics exposes the metrics of the clients.
+func registerMetrics() {
+	registerOnce.Do(func() {
+		prometheus.MustRegister(requestDuration, retries)
+	})
+}
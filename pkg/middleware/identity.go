@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/767829413/normal-frame/pkg/certmanager"
+	"github.com/gin-gonic/gin"
+)
+
+// ClientIdentity stores the identity of a verified client certificate in the
+// request context, authorization middlewares read it with
+// certmanager.FromContext.
+func ClientIdentity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if id := certmanager.IdentityFromConnectionState(c.Request.TLS); id != nil {
+			c.Request = c.Request.WithContext(certmanager.NewContext(c.Request.Context(), id))
+		}
+		c.Next()
+	}
+}
+
+// RequireIdentity rejects the requests without a verified client certificate
+// with 401 Unauthorized, and with 403 Forbidden those whose SPIFFE ID or
+// common name is not one of names. Any verified client is accepted when names
+// is empty. It must run after ClientIdentity.
+func RequireIdentity(names []string) gin.HandlerFunc {
+	allowed := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		allowed[name] = struct{}{}
+	}
+	return func(c *gin.Context) {
+		id, ok := certmanager.FromContext(c.Request.Context())
+		if !ok {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		if len(allowed) > 0 {
+			_, spiffe := allowed[id.SPIFFEID]
+			_, cn := allowed[id.CommonName]
+			if !(spiffe && id.SPIFFEID != "") && !(cn && id.CommonName != "") {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/767829413/normal-frame/pkg/certmanager"
+)
+
+func selfSigned(t *testing.T, tmpl *x509.Certificate) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SerialNumber = big.NewInt(1)
+	tmpl.NotBefore, tmpl.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestClientIdentity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	spiffe, _ := url.Parse("spiffe://shop.example/ns/shop/sa/orders")
+	cert := selfSigned(t, &x509.Certificate{Subject: pkix.Name{CommonName: "orders"}, URIs: []*url.URL{spiffe}})
+
+	engine := gin.New()
+	engine.Use(ClientIdentity())
+	engine.GET("/whoami", func(c *gin.Context) {
+		id, ok := certmanager.FromContext(c.Request.Context())
+		if !ok {
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		c.String(http.StatusOK, id.Name())
+	})
+
+	for _, tt := range []struct {
+		name  string
+		state *tls.ConnectionState
+		code  int
+		body  string
+	}{
+		{name: "verified", state: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}, code: http.StatusOK, body: spiffe.String()},
+		{name: "not verified", state: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, code: http.StatusUnauthorized},
+		{name: "plain HTTP", code: http.StatusUnauthorized},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+			req.TLS = tt.state
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			if w.Code != tt.code || w.Body.String() != tt.body {
+				t.Errorf("response = %d %q, want %d %q", w.Code, w.Body.String(), tt.code, tt.body)
+			}
+		})
+	}
+}
+
+func TestRequireIdentity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	spiffe, _ := url.Parse("spiffe://shop.example/ns/ops/sa/admin")
+	admin := selfSigned(t, &x509.Certificate{Subject: pkix.Name{CommonName: "admin"}, URIs: []*url.URL{spiffe}})
+	operator := selfSigned(t, &x509.Certificate{Subject: pkix.Name{CommonName: "operator"}})
+	orders := selfSigned(t, &x509.Certificate{Subject: pkix.Name{CommonName: "orders"}})
+	verified := func(cert *x509.Certificate) *tls.ConnectionState {
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+
+	for _, tt := range []struct {
+		name  string
+		names []string
+		state *tls.ConnectionState
+		code  int
+	}{
+		{name: "any verified client", state: verified(orders), code: http.StatusOK},
+		{name: "allowed SPIFFE ID", names: []string{spiffe.String()}, state: verified(admin), code: http.StatusOK},
+		{name: "allowed common name", names: []string{spiffe.String(), "operator"}, state: verified(operator), code: http.StatusOK},
+		{name: "not allowed", names: []string{spiffe.String(), "operator"}, state: verified(orders), code: http.StatusForbidden},
+		{name: "empty name", names: []string{""}, state: verified(operator), code: http.StatusForbidden},
+		{name: "not verified", state: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{admin}}, code: http.StatusUnauthorized},
+		{name: "plain HTTP", code: http.StatusUnauthorized},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := gin.New()
+			engine.Use(ClientIdentity())
+			engine.GET("/admin", RequireIdentity(tt.names), func(c *gin.Context) { c.Status(http.StatusOK) })
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			req.TLS = tt.state
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			if w.Code != tt.code {
+				t.Errorf("status = %d, want %d", w.Code, tt.code)
+			}
+		})
+	}
+}
@@ -1,10 +1,11 @@
 package middleware
 
 import (
+	"sync/atomic"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
-	gindump "github.com/tpkeeper/gin-dump"
 )
 
 // gzip 压缩
@@ -12,10 +13,50 @@ func Gzip(level int) gin.HandlerFunc {
 	return gzip.Gzip(level)
 }
 
-// Cors add cors headers.
-func Cors() gin.HandlerFunc {
+// CorsOrigins holds the origins allowed by Cors, it can be replaced while the
+// server is running.
+type CorsOrigins struct {
+	origins atomic.Value // map[string]struct{}, nil allows every origin
+}
+
+// NewCorsOrigins creates the allowed origins list, an empty list or "*"
+// allows every origin.
+func NewCorsOrigins(origins []string) *CorsOrigins {
+	o := &CorsOrigins{}
+	o.Set(origins)
+	return o
+}
+
+// Set replaces the allowed origins.
+func (o *CorsOrigins) Set(origins []string) {
+	allowed := make(map[string]struct{}, len(origins))
+	for _, origin := range origins {
+		if origin == "*" {
+			allowed = nil
+			break
+		}
+		allowed[origin] = struct{}{}
+	}
+	if len(origins) == 0 {
+		allowed = nil
+	}
+	o.origins.Store(allowed)
+}
+
+// Allowed reports whether origin may send cross origin requests.
+func (o *CorsOrigins) Allowed(origin string) bool {
+	allowed, _ := o.origins.Load().(map[string]struct{})
+	if allowed == nil {
+		return true
+	}
+	_, ok := allowed[origin]
+	return ok
+}
+
+// Cors add cors headers for the given allowed origins.
+func Cors(origins *CorsOrigins) gin.HandlerFunc {
 	config := cors.DefaultConfig()
-	config.AllowAllOrigins = true
+	config.AllowOriginFunc = origins.Allowed
 	config.AddAllowHeaders("CloudCluster", "ClusterID")
 	return cors.New(config)
 }
@@ -24,7 +65,3 @@ func Cors() gin.HandlerFunc {
 func Recovery() gin.HandlerFunc {
 	return gin.Recovery()
 }
-
-func Dump() gin.HandlerFunc {
-	return gindump.Dump()
-}
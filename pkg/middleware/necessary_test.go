@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCorsOriginsSet(t *testing.T) {
+	origins := NewCorsOrigins(nil)
+	for _, tt := range []struct {
+		set     []string
+		allowed []string
+		denied  []string
+	}{
+		{set: nil, allowed: []string{"https://shop.example", "https://other.example"}},
+		{set: []string{"https://shop.example"}, allowed: []string{"https://shop.example"}, denied: []string{"https://other.example", "http://shop.example"}},
+		{set: []string{"https://shop.example", "*"}, allowed: []string{"https://other.example"}},
+		{set: []string{"https://admin.example"}, allowed: []string{"https://admin.example"}, denied: []string{"https://shop.example"}},
+		{set: []string{}, allowed: []string{"https://shop.example"}},
+	} {
+		origins.Set(tt.set)
+		for _, origin := range tt.allowed {
+			if !origins.Allowed(origin) {
+				t.Errorf("origins %v: %s denied", tt.set, origin)
+			}
+		}
+		for _, origin := range tt.denied {
+			if origins.Allowed(origin) {
+				t.Errorf("origins %v: %s allowed", tt.set, origin)
+			}
+		}
+	}
+}
+
+func TestCorsFollowsOrigins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	origins := NewCorsOrigins([]string{"https://shop.example"})
+	engine := gin.New()
+	engine.Use(Cors(origins))
+	engine.GET("/", func(c *gin.Context) {})
+	allowOrigin := func(origin string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Header().Get("Access-Control-Allow-Origin")
+	}
+
+	if got := allowOrigin("https://admin.example"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q for an origin not allowed", got)
+	}
+	origins.Set([]string{"https://admin.example"})
+	if got := allowOrigin("https://admin.example"); got != "https://admin.example" {
+		t.Errorf("Access-Control-Allow-Origin = %q after the origins were replaced", got)
+	}
+	if got := allowOrigin("https://shop.example"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q for a removed origin", got)
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// RateLimiter rejects requests above the configured rate with
+// 429 Too Many Requests. Its settings can be updated while the server is
+// running.
+type RateLimiter struct {
+	enabled int32
+	limiter *rate.Limiter
+}
+
+// NewRateLimiter creates a token bucket limiter allowing qps requests per
+// second with bursts of up to burst requests.
+func NewRateLimiter(enabled bool, qps float64, burst int) *RateLimiter {
+	l := &RateLimiter{limiter: rate.NewLimiter(rate.Limit(qps), burst)}
+	l.Update(enabled, qps, burst)
+	return l
+}
+
+// Update replaces the limiter settings.
+func (l *RateLimiter) Update(enabled bool, qps float64, burst int) {
+	l.limiter.SetLimit(rate.Limit(qps))
+	l.limiter.SetBurst(burst)
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&l.enabled, v)
+}
+
+// Handler returns the gin middleware.
+func (l *RateLimiter) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if atomic.LoadInt32(&l.enabled) == 1 && !l.limiter.Allow() {
+			c.AbortWithStatus(http.StatusTooManyRequests)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimiterUpdate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewRateLimiter(false, 1, 1)
+	engine := gin.New()
+	engine.Use(limiter.Handler())
+	engine.GET("/", func(c *gin.Context) {})
+	// codes sends n requests at once and returns their status codes
+	codes := func(n int) []int {
+		var codes []int
+		for i := 0; i < n; i++ {
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			codes = append(codes, w.Code)
+		}
+		return codes
+	}
+	count := func(codes []int, code int) int {
+		n := 0
+		for _, c := range codes {
+			if c == code {
+				n++
+			}
+		}
+		return n
+	}
+
+	if got := codes(5); count(got, http.StatusOK) != 5 {
+		t.Errorf("disabled limiter: codes %v, want every request allowed", got)
+	}
+
+	limiter.Update(true, 0.001, 2)
+	if got := codes(5); count(got, http.StatusOK) > 2 || count(got, http.StatusTooManyRequests) < 3 {
+		t.Errorf("burst of 2: codes %v, want at most 2 allowed", got)
+	}
+
+	limiter.Update(true, 1e9, 10)
+	if got := codes(5); count(got, http.StatusOK) != 5 {
+		t.Errorf("rate raised: codes %v, want every request allowed", got)
+	}
+
+	limiter.Update(false, 0.001, 0)
+	if got := codes(5); count(got, http.StatusOK) != 5 {
+		t.Errorf("limiter disabled again: codes %v, want every request allowed", got)
+	}
+}
@@ -0,0 +1,46 @@
+package options
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// DecodeHook returns the hooks decoding the merged configuration into the
+// options, to be passed to viper.Unmarshal with viper.DecodeHook. On top of
+// the hooks of viper, map options accept "key=value" pairs separated by
+// commas, the form environment variables and flags give them in.
+func DecodeHook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		StringToMapHookFunc(),
+	)
+}
+
+// StringToMapHookFunc decodes a string such as "a=1,b=2" into a map, the
+// values being decoded to the value type of the map afterwards. An empty
+// string is an empty map.
+func StringToMapHookFunc() mapstructure.DecodeHookFuncType {
+	return func(from, to reflect.Type, data interface{}) (interface{}, error) {
+		if from.Kind() != reflect.String || to.Kind() != reflect.Map {
+			return data, nil
+		}
+		s := strings.TrimSpace(data.(string))
+		m := map[string]string{}
+		if s == "" {
+			return m, nil
+		}
+		for _, pair := range strings.Split(s, ",") {
+			key, value, ok := strings.Cut(pair, "=")
+			key = strings.TrimSpace(key)
+			if !ok || key == "" {
+				return nil, fmt.Errorf("%q is not a list of key=value pairs", s)
+			}
+			m[key] = strings.TrimSpace(value)
+		}
+		return m, nil
+	}
+}
@@ -0,0 +1,57 @@
+package options
+
+import (
+	"reflect"
+	"strings"
+)
+
+const keyTag = "mapstructure"
+
+// Keys returns the dotted configuration keys of every leaf option in v, as
+// named by the mapstructure tags of the struct tree. Maps and slices are
+// leaves, nested structs and pointers to structs are descended into.
+func Keys(v interface{}) []string {
+	var keys []string
+	walkKeys(reflect.TypeOf(v), "", &keys)
+	return keys
+}
+
+func walkKeys(t reflect.Type, prefix string, keys *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		if prefix != "" {
+			*keys = append(*keys, prefix)
+		}
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := KeyName(field)
+		if name == "" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		walkKeys(field.Type, name, keys)
+	}
+}
+
+// KeyName returns the configuration key of a struct field, the name part of
+// its mapstructure tag or the lower cased field name like mapstructure does.
+// It returns an empty string for fields tagged "-".
+func KeyName(field reflect.StructField) string {
+	tag := field.Tag.Get(keyTag)
+	if tag == "-" {
+		return ""
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name
+	}
+	return strings.ToLower(field.Name)
+}
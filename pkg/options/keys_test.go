@@ -0,0 +1,93 @@
+package options
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+type testServer struct {
+	Host    string        `mapstructure:"host"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+type testOptions struct {
+	Server   *testServer       `mapstructure:"server"`
+	Backup   testServer        `mapstructure:"backup-server"`
+	Origins  []string          `mapstructure:"allow-origins"`
+	Flags    map[string]bool   `mapstructure:"flags"`
+	Headers  map[string]string `mapstructure:"headers,omitempty"`
+	Retries  int
+	Ignored  string `mapstructure:"-"`
+	internal string
+}
+
+func TestKeys(t *testing.T) {
+	want := []string{
+		"server.host", "server.timeout",
+		"backup-server.host", "backup-server.timeout",
+		"allow-origins", "flags", "headers", "retries",
+	}
+	if got := Keys(&testOptions{}); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Keys = %v, want %v", got, want)
+	}
+	// a nil pointer is walked by type
+	if got := Keys((*testOptions)(nil)); len(got) != len(want) {
+		t.Errorf("Keys of a nil pointer = %v, want %v", got, want)
+	}
+}
+
+func TestKeyName(t *testing.T) {
+	typ := reflect.TypeOf(testOptions{})
+	for field, want := range map[string]string{
+		"Backup":  "backup-server",
+		"Headers": "headers",
+		"Retries": "retries",
+		"Ignored": "",
+	} {
+		f, _ := typ.FieldByName(field)
+		if got := KeyName(f); got != want {
+			t.Errorf("KeyName(%s) = %q, want %q", field, got, want)
+		}
+	}
+}
+
+func TestDecodeHook(t *testing.T) {
+	var opts testOptions
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       DecodeHook(),
+		WeaklyTypedInput: true,
+		Result:           &opts,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = decoder.Decode(map[string]interface{}{
+		"server":        map[string]interface{}{"timeout": "3s"},
+		"allow-origins": "https://a.example,https://b.example",
+		"flags":         "checkout=true, legacy-search=false",
+		"headers":       "Authorization=Bearer a==,X-Tenant=shop",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Server.Timeout != 3*time.Second || len(opts.Origins) != 2 {
+		t.Errorf("options = %+v", opts)
+	}
+	if !reflect.DeepEqual(opts.Flags, map[string]bool{"checkout": true, "legacy-search": false}) {
+		t.Errorf("flags = %v", opts.Flags)
+	}
+	if !reflect.DeepEqual(opts.Headers, map[string]string{"Authorization": "Bearer a==", "X-Tenant": "shop"}) {
+		t.Errorf("headers = %v", opts.Headers)
+	}
+
+	hook := StringToMapHookFunc()
+	for _, value := range []string{"checkout", "=true", "checkout=true,,"} {
+		if _, err := hook(reflect.TypeOf(""), reflect.TypeOf(opts.Flags), value); err == nil {
+			t.Errorf("%q decoded as a map", value)
+		}
+	}
+}
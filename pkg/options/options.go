@@ -1,6 +1,8 @@
 package options
 
 import (
+	"strings"
+
 	cliflag "github.com/767829413/normal-frame/fork/component-base/cli/flag"
 )
 
@@ -10,4 +12,37 @@ type CliOptions interface {
 	// AddFlags adds flags to the specified FlagSet object.
 	// AddFlags(fs *pflag.FlagSet)
 	Flags() (fss cliflag.NamedFlagSets)
+	// Validate checks the options and returns every problem found.
+	Validate() []error
+}
+
+// CompleteableOptions abstracts options which can be completed once they have
+// been read, e.g. by resolving references.
+type CompleteableOptions interface {
+	Complete() error
+}
+
+// Aggregate combines the problems returned by Validate into one error listing
+// each of them on its own line, or returns nil when there are none.
+func Aggregate(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return aggregate(errs)
+}
+
+type aggregate []error
+
+func (a aggregate) Error() string {
+	msgs := make([]string, 0, len(a)+1)
+	msgs = append(msgs, "invalid configuration:")
+	for _, err := range a {
+		msgs = append(msgs, "  "+err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Errors returns the aggregated problems.
+func (a aggregate) Errors() []error {
+	return a
 }
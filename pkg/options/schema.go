@@ -0,0 +1,185 @@
+package options
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const schemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// Schema returns a JSON schema of the configuration file for the options v.
+// The current values of v are used as defaults and descriptions, keyed by
+// configuration key, document the properties. Objects reject unknown
+// properties so that misspelled keys are reported.
+func Schema(v interface{}, descriptions map[string]string) map[string]interface{} {
+	schema := schemaOf(reflect.ValueOf(v), "", descriptions)
+	schema["$schema"] = schemaDraft
+	return schema
+}
+
+func schemaOf(rv reflect.Value, prefix string, descriptions map[string]string) map[string]interface{} {
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv = reflect.New(rv.Type().Elem())
+		}
+		rv = rv.Elem()
+	}
+
+	schema := map[string]interface{}{}
+	if rv.Kind() == reflect.Struct {
+		properties := map[string]interface{}{}
+		for i := 0; i < rv.NumField(); i++ {
+			field := rv.Type().Field(i)
+			name := KeyName(field)
+			if field.PkgPath != "" || name == "" {
+				continue
+			}
+			key := name
+			if prefix != "" {
+				key = prefix + "." + name
+			}
+			properties[name] = schemaOf(rv.Field(i), key, descriptions)
+		}
+		schema["type"] = "object"
+		schema["properties"] = properties
+		schema["additionalProperties"] = false
+	} else {
+		for k, v := range typeSchema(rv.Type()) {
+			schema[k] = v
+		}
+		schema["default"] = defaultValue(rv)
+	}
+	if desc := descriptions[prefix]; desc != "" {
+		schema["description"] = desc
+	}
+	return schema
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t == durationType {
+		// parsed by time.ParseDuration, e.g. 1m30s
+		return map[string]interface{}{"type": "string", "pattern": `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		// a string is split at the commas, e.g. out-put: stdout
+		return map[string]interface{}{"oneOf": []interface{}{
+			map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())},
+			map[string]interface{}{"type": "string"},
+		}}
+	case reflect.Map:
+		// a string holds comma separated key=value pairs
+		return map[string]interface{}{"oneOf": []interface{}{
+			map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())},
+			map[string]interface{}{"type": "string", "pattern": `^\s*$|^[^=,]+=[^,]*(,[^=,]+=[^,]*)*$`},
+		}}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// defaultValue returns the value of rv, with empty instead of nil slices and
+// maps and durations formatted as strings.
+func defaultValue(rv reflect.Value) interface{} {
+	if rv.Type() == durationType {
+		return time.Duration(rv.Int()).String()
+	}
+	switch rv.Kind() {
+	case reflect.Slice:
+		if rv.IsNil() {
+			return []interface{}{}
+		}
+	case reflect.Map:
+		if rv.IsNil() {
+			return map[string]interface{}{}
+		}
+	}
+	return rv.Interface()
+}
+
+// UnknownKeys returns the configuration keys that do not match any option of
+// v, sorted. Keys below a map option are known.
+func UnknownKeys(v interface{}, keys []string) []string {
+	known := map[string]bool{}
+	for _, key := range Keys(v) {
+		known[key] = true
+	}
+
+	var unknown []string
+	for _, key := range keys {
+		if !isKnownKey(strings.ToLower(key), known) {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+func isKnownKey(key string, known map[string]bool) bool {
+	for {
+		if known[key] {
+			return true
+		}
+		i := strings.LastIndex(key, ".")
+		if i < 0 {
+			return false
+		}
+		key = key[:i]
+	}
+}
+
+// SuggestKey returns the option of v whose key is closest to the unknown key,
+// or an empty string when none is close enough to be a likely typo.
+func SuggestKey(v interface{}, key string) string {
+	const maxDistance = 3
+	best, bestDistance := "", maxDistance+1
+	for _, known := range Keys(v) {
+		if d := levenshtein(key, known); d < bestDistance {
+			best, bestDistance = known, d
+		}
+	}
+	return best
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
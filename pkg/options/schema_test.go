@@ -0,0 +1,133 @@
+package options
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// property returns the schema of the dotted key in schema.
+func property(t *testing.T, schema map[string]interface{}, key string) map[string]interface{} {
+	t.Helper()
+	for _, name := range strings.Split(key, ".") {
+		properties, _ := schema["properties"].(map[string]interface{})
+		schema, _ = properties[name].(map[string]interface{})
+		if schema == nil {
+			t.Fatalf("no property %s in the schema", key)
+		}
+	}
+	return schema
+}
+
+// types returns the types accepted by schema, one per alternative of oneOf.
+func types(schema map[string]interface{}) []string {
+	alternatives, _ := schema["oneOf"].([]interface{})
+	if len(alternatives) == 0 {
+		alternatives = []interface{}{schema}
+	}
+	var types []string
+	for _, alt := range alternatives {
+		types = append(types, alt.(map[string]interface{})["type"].(string))
+	}
+	return types
+}
+
+func TestSchema(t *testing.T) {
+	schema := Schema(newSettingsOptions(), map[string]string{
+		"db":      "The database.",
+		"db.host": "Address of the database.",
+	})
+	if schema["$schema"] != schemaDraft || schema["type"] != "object" || schema["additionalProperties"] != false {
+		t.Errorf("root schema = %v", schema)
+	}
+
+	db := property(t, schema, "db")
+	if db["description"] != "The database." || db["additionalProperties"] != false {
+		t.Errorf("db schema = %v", db)
+	}
+	host := property(t, schema, "db.host")
+	if host["type"] != "string" || host["default"] != "db:3306" || host["description"] != "Address of the database." {
+		t.Errorf("db.host schema = %v", host)
+	}
+	// a nil pointer to a struct is described by its type
+	if replica := property(t, schema, "replica.host"); replica["default"] != "" {
+		t.Errorf("replica.host schema = %v", replica)
+	}
+	if debug := property(t, schema, "debug"); debug["type"] != "boolean" || debug["default"] != false {
+		t.Errorf("debug schema = %v", debug)
+	}
+	properties := schema["properties"].(map[string]interface{})
+	if _, ok := properties["Ignored"]; ok || len(properties) != 6 {
+		t.Errorf("properties = %v", properties)
+	}
+
+	timeout := property(t, schema, "db.timeout")
+	pattern := regexp.MustCompile(timeout["pattern"].(string))
+	if timeout["default"] != "5s" || !pattern.MatchString("1m30s") || !pattern.MatchString("1.5h") || pattern.MatchString("90") {
+		t.Errorf("db.timeout schema = %v", timeout)
+	}
+
+	// lists and maps may be given as strings, like in environment variables
+	output := property(t, schema, "out-put")
+	if got := types(output); !reflect.DeepEqual(got, []string{"array", "string"}) {
+		t.Errorf("out-put types = %v, want an array or a string", got)
+	}
+	if !reflect.DeepEqual(output["default"], []string{"stdout", "file"}) {
+		t.Errorf("out-put default = %v", output["default"])
+	}
+	labels := property(t, schema, "labels")
+	if got := types(labels); !reflect.DeepEqual(got, []string{"object", "string"}) {
+		t.Errorf("labels types = %v, want an object or a string", got)
+	}
+	if !reflect.DeepEqual(labels["default"], map[string]interface{}{}) {
+		t.Errorf("labels default = %v, want an empty object", labels["default"])
+	}
+	pairs := regexp.MustCompile(labels["oneOf"].([]interface{})[1].(map[string]interface{})["pattern"].(string))
+	for value, want := range map[string]bool{
+		"":                        true,
+		"zone=eu-1":               true,
+		"zone=eu-1, team=payment": true,
+		"token=a==":               true,
+		"zone":                    false,
+		"=eu-1":                   false,
+	} {
+		if got := pairs.MatchString(value); got != want {
+			t.Errorf("labels %q matches = %v, want %v", value, got, want)
+		}
+	}
+	flags := property(t, schema, "flags")
+	items := flags["oneOf"].([]interface{})[0].(map[string]interface{})["additionalProperties"]
+	if !reflect.DeepEqual(items, map[string]interface{}{"type": "boolean"}) {
+		t.Errorf("flags values = %v", items)
+	}
+}
+
+func TestUnknownKeys(t *testing.T) {
+	got := UnknownKeys(newSettingsOptions(), []string{
+		"db.host", "DB.Password", "db.timout", "flags.checkout", "labels.zone.eu",
+		"replica", "out-put", "ignored", "logs.level",
+	})
+	want := []string{"db.timout", "ignored", "logs.level", "replica"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("UnknownKeys = %v, want %v", got, want)
+	}
+	if got := UnknownKeys(newSettingsOptions(), nil); len(got) != 0 {
+		t.Errorf("UnknownKeys of no key = %v", got)
+	}
+}
+
+func TestSuggestKey(t *testing.T) {
+	for key, want := range map[string]string{
+		"db.timout":       "db.timeout",
+		"db.hots":         "db.host",
+		"output":          "out-put",
+		"replica.pasword": "replica.password",
+		"logs.level":      "",
+		"cache.host":      "",
+	} {
+		if got := SuggestKey(newSettingsOptions(), key); got != want {
+			t.Errorf("SuggestKey(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package options
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	cliflag "github.com/767829413/normal-frame/fork/component-base/cli/flag"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// secretTag marks the options that must not be printed, e.g.
+	// `secret:"true"` on a password.
+	secretTag = "secret"
+	redacted  = "******"
+)
+
+// Settings returns the options of v as a YAML mapping keyed by the
+// configuration keys, in the order the fields are declared. Secrets are
+// replaced by a placeholder when redact is set. comments, keyed by
+// configuration key, are written above the matching keys.
+func Settings(v interface{}, redact bool, comments map[string]string) *yaml.Node {
+	return settingsNode(reflect.ValueOf(v), "", redact, comments)
+}
+
+func settingsNode(rv reflect.Value, prefix string, redact bool, comments map[string]string) *yaml.Node {
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv = reflect.New(rv.Type().Elem())
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		node := &yaml.Node{}
+		if err := node.Encode(rv.Interface()); err != nil {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}
+		}
+		return node
+	}
+
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		name := KeyName(field)
+		if field.PkgPath != "" || name == "" {
+			continue
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		value := settingsNode(rv.Field(i), key, redact, comments)
+		if redact && field.Tag.Get(secretTag) == "true" && !rv.Field(i).IsZero() {
+			value = redactNode(value)
+		}
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name, HeadComment: comments[key]},
+			value,
+		)
+	}
+	return node
+}
+
+// redactNode replaces a secret with the placeholder, or every value of a
+// mapping of secrets such as the headers sent to a collector.
+func redactNode(node *yaml.Node) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: redacted}
+	}
+	for i := 1; i < len(node.Content); i += 2 {
+		if node.Content[i].Value != "" {
+			node.Content[i] = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: redacted}
+		}
+	}
+	return node
+}
+
+// FlatSettings returns the options of v keyed by configuration key, every
+// value formatted as YAML.
+func FlatSettings(v interface{}, redact bool) map[string]string {
+	settings := map[string]string{}
+	flatten(Settings(v, redact, nil), "", settings)
+	return settings
+}
+
+func flatten(node *yaml.Node, prefix string, settings map[string]string) {
+	if node.Kind != yaml.MappingNode || prefix != "" && len(node.Content) == 0 {
+		leaf := *node
+		leaf.Style |= yaml.FlowStyle
+		out, _ := yaml.Marshal(&leaf)
+		settings[prefix] = strings.TrimSpace(string(out))
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		flatten(node.Content[i+1], key, settings)
+	}
+}
+
+// Usages maps the configuration keys of v to the usage of the flags setting
+// them. A flag is matched by the option it is bound to, or by name when its
+// value cannot be traced back to a field.
+func Usages(v interface{}, fss cliflag.NamedFlagSets) map[string]string {
+	usages := map[string]string{}
+	for _, name := range fss.Order {
+		for flag, key := range FlagKeys(v, fss.FlagSets[name]) {
+			usages[key] = fss.FlagSets[name].Lookup(flag).Usage
+		}
+	}
+	return usages
+}
+
+// FlagKeys maps the names of the flags in fs to the configuration keys of the
+// options of v they set. A flag is matched by the option it is bound to, or by
+// name when its value cannot be traced back to a field.
+func FlagKeys(v interface{}, fs *pflag.FlagSet) map[string]string {
+	addrs := map[uintptr]string{}
+	fieldAddrs(reflect.ValueOf(v), "", addrs)
+
+	keys := map[string]string{}
+	fs.VisitAll(func(f *pflag.Flag) {
+		keys[f.Name] = f.Name
+		for _, addr := range valueAddrs(f.Value) {
+			if key, ok := addrs[addr]; ok {
+				keys[f.Name] = key
+				break
+			}
+		}
+	})
+	return keys
+}
+
+// valueAddrs returns the addresses the flag value may write to: the value
+// itself for scalars, and the pointer held by the wrappers of slices and
+// maps, such as the value of a StringSlice flag.
+func valueAddrs(value pflag.Value) []uintptr {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Ptr {
+		return nil
+	}
+	addrs := []uintptr{rv.Pointer()}
+	if e := rv.Elem(); e.Kind() == reflect.Struct && e.NumField() > 0 && e.Field(0).Kind() == reflect.Ptr {
+		addrs = append(addrs, e.Field(0).Pointer())
+	}
+	return addrs
+}
+
+func fieldAddrs(rv reflect.Value, prefix string, addrs map[uintptr]string) {
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		if prefix != "" && rv.CanAddr() {
+			addrs[rv.UnsafeAddr()] = prefix
+		}
+		return
+	}
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		name := KeyName(field)
+		if field.PkgPath != "" || name == "" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		fieldAddrs(rv.Field(i), name, addrs)
+	}
+}
+
+// ResolveSecrets replaces every non empty string option of v tagged as a
+// secret, and every non empty value of a map of strings tagged as a secret,
+// with the value returned by resolve. v must be a pointer.
+func ResolveSecrets(v interface{}, resolve func(value string) (string, error)) error {
+	return resolveSecrets(reflect.ValueOf(v), "", resolve)
+}
+
+func resolveSecrets(rv reflect.Value, prefix string, resolve func(string) (string, error)) error {
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		name := KeyName(field)
+		if field.PkgPath != "" || name == "" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		value := rv.Field(i)
+		if field.Tag.Get(secretTag) != "true" {
+			if err := resolveSecrets(value, name, resolve); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := resolveSecret(value, name, resolve); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func resolveSecret(value reflect.Value, name string, resolve func(string) (string, error)) error {
+	switch {
+	case value.Kind() == reflect.String:
+		if value.String() == "" || !value.CanSet() {
+			return nil
+		}
+		secret, err := resolve(value.String())
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		value.SetString(secret)
+	case value.Kind() == reflect.Map && value.Type().Elem().Kind() == reflect.String:
+		if value.Len() == 0 || !value.CanSet() {
+			return nil
+		}
+		// the map may be shared with the defaults, the resolved values go to
+		// a copy
+		secrets := reflect.MakeMapWithSize(value.Type(), value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			secret := iter.Value().String()
+			if secret != "" {
+				var err error
+				if secret, err = resolve(secret); err != nil {
+					return fmt.Errorf("%s.%v: %w", name, iter.Key(), err)
+				}
+			}
+			secrets.SetMapIndex(iter.Key(), reflect.ValueOf(secret).Convert(value.Type().Elem()))
+		}
+		value.Set(secrets)
+	default:
+		return resolveSecrets(value, name, resolve)
+	}
+	return nil
+}
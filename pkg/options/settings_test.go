@@ -0,0 +1,204 @@
+package options
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	cliflag "github.com/767829413/normal-frame/fork/component-base/cli/flag"
+	"gopkg.in/yaml.v3"
+)
+
+type settingsDB struct {
+	Host     string        `mapstructure:"host"`
+	Password string        `mapstructure:"password" secret:"true"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+type settingsOptions struct {
+	DB      *settingsDB       `mapstructure:"db"`
+	Replica *settingsDB       `mapstructure:"replica"`
+	Output  []string          `mapstructure:"out-put"`
+	Flags   map[string]bool   `mapstructure:"flags"`
+	Labels  map[string]string `mapstructure:"labels"`
+	Debug   bool              `mapstructure:"debug"`
+	Ignored string            `mapstructure:"-"`
+}
+
+func newSettingsOptions() *settingsOptions {
+	return &settingsOptions{
+		DB:     &settingsDB{Host: "db:3306", Password: "hunter2", Timeout: 5 * time.Second},
+		Output: []string{"stdout", "file"},
+		Flags:  map[string]bool{"checkout": true},
+	}
+}
+
+func TestSettings(t *testing.T) {
+	out, err := yaml.Marshal(Settings(newSettingsOptions(), true, map[string]string{
+		"db":       "The database.",
+		"db.host":  "Address of the database.",
+		"out-put":  "Outputs of the logs.",
+		"missing":  "Not an option.",
+		"replica":  "",
+		"db.extra": "Not an option either.",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# The database.
+db:
+    # Address of the database.
+    host: db:3306
+    password: '******'
+    timeout: 5s
+replica:
+    host: ""
+    password: ""
+    timeout: 0s
+# Outputs of the logs.
+out-put:
+    - stdout
+    - file
+flags:
+    checkout: true
+labels: {}
+debug: false
+`
+	if string(out) != want {
+		t.Errorf("Settings:\n%s\nwant:\n%s", out, want)
+	}
+
+	out, err = yaml.Marshal(Settings(newSettingsOptions(), false, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "password: hunter2") {
+		t.Errorf("Settings without redaction:\n%s\nwant the password", out)
+	}
+}
+
+func TestFlatSettings(t *testing.T) {
+	got := FlatSettings(newSettingsOptions(), true)
+	want := map[string]string{
+		"db.host":          "db:3306",
+		"db.password":      "'******'",
+		"db.timeout":       "5s",
+		"replica.host":     `""`,
+		"replica.password": `""`,
+		"replica.timeout":  "0s",
+		"out-put":          "[stdout, file]",
+		"flags.checkout":   "true",
+		"labels":           "{}",
+		"debug":            "false",
+	}
+	if len(got) != len(want) {
+		t.Errorf("FlatSettings = %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("FlatSettings[%s] = %q, want %q", key, got[key], value)
+		}
+	}
+	if got := FlatSettings(newSettingsOptions(), false)["db.password"]; got != "hunter2" {
+		t.Errorf("password = %q without redaction", got)
+	}
+}
+
+func TestUsages(t *testing.T) {
+	opts := newSettingsOptions()
+	var fss cliflag.NamedFlagSets
+	db := fss.FlagSet("db")
+	// a flag named after its key
+	db.StringVar(&opts.DB.Host, "db.host", opts.DB.Host, "Address of the database.")
+	// a flag named differently from its key, matched by the option it sets
+	db.DurationVar(&opts.DB.Timeout, "db.connect-timeout", opts.DB.Timeout, "Timeout of the connection.")
+	logs := fss.FlagSet("logs")
+	// slices and maps are matched through the pointer held by the flag value
+	logs.StringSliceVar(&opts.Output, "log.output", opts.Output, "Outputs of the logs.")
+	logs.StringToStringVar(&opts.Labels, "log.labels", opts.Labels, "Labels of the logs.")
+	// a flag bound to no option keeps its name
+	logs.Bool("verbose", false, "Log more.")
+
+	want := map[string]string{
+		"db.host":    "Address of the database.",
+		"db.timeout": "Timeout of the connection.",
+		"out-put":    "Outputs of the logs.",
+		"labels":     "Labels of the logs.",
+		"verbose":    "Log more.",
+	}
+	got := Usages(opts, fss)
+	if len(got) != len(want) {
+		t.Errorf("Usages = %v, want %v", got, want)
+	}
+	for key, usage := range want {
+		if got[key] != usage {
+			t.Errorf("Usages[%s] = %q, want %q", key, got[key], usage)
+		}
+	}
+
+	// the options of another value are not matched by address
+	keys := FlagKeys(newSettingsOptions(), db)
+	if keys["db.connect-timeout"] != "db.connect-timeout" {
+		t.Errorf("flag of other options matched to %q", keys["db.connect-timeout"])
+	}
+}
+
+type secretHeaders struct {
+	Headers map[string]string `mapstructure:"headers" secret:"true"`
+}
+
+type secretOptions struct {
+	DB     *settingsDB    `mapstructure:"db"`
+	Export *secretHeaders `mapstructure:"export"`
+}
+
+func TestSettingsRedactsMaps(t *testing.T) {
+	opts := &secretOptions{Export: &secretHeaders{Headers: map[string]string{"authorization": "Bearer abc", "x-empty": ""}}}
+	got := FlatSettings(opts, true)
+	if got["export.headers.authorization"] != "'******'" {
+		t.Errorf("authorization = %q, want it redacted", got["export.headers.authorization"])
+	}
+	if got["export.headers.x-empty"] != `""` {
+		t.Errorf("x-empty = %q, want the empty value", got["export.headers.x-empty"])
+	}
+	if got := FlatSettings(opts, false)["export.headers.authorization"]; got != "Bearer abc" {
+		t.Errorf("authorization = %q without redaction", got)
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	defaults := map[string]string{"authorization": "env://TOKEN", "x-empty": ""}
+	opts := &secretOptions{
+		DB:     &settingsDB{Host: "env://HOST", Password: "env://PASS"},
+		Export: &secretHeaders{Headers: defaults},
+	}
+	err := ResolveSecrets(opts, func(value string) (string, error) {
+		return strings.TrimPrefix(value, "env://") + "-resolved", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.DB.Host != "env://HOST" || opts.DB.Password != "PASS-resolved" {
+		t.Errorf("db = %+v, want only the password resolved", opts.DB)
+	}
+	want := map[string]string{"authorization": "TOKEN-resolved", "x-empty": ""}
+	if !reflect.DeepEqual(opts.Export.Headers, want) {
+		t.Errorf("headers = %v, want %v", opts.Export.Headers, want)
+	}
+	if defaults["authorization"] != "env://TOKEN" {
+		t.Errorf("the map of the defaults was changed to %v", defaults)
+	}
+
+	opts.Export.Headers = map[string]string{"authorization": "env://MISSING"}
+	err = ResolveSecrets(opts, func(value string) (string, error) {
+		if value == "env://MISSING" {
+			return "", errors.New("not found")
+		}
+		return value, nil
+	})
+	if err == nil || !strings.HasPrefix(err.Error(), "export.headers.authorization: ") {
+		t.Errorf("error = %v, want the key of the header", err)
+	}
+}
@@ -0,0 +1,343 @@
+// Package rotate provides a log file that rotates itself by size and by day,
+// keeps a bounded number of compressed backups and can be reopened after an
+// external tool such as logrotate moved it.
+package rotate
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// backupTimeFormat is the rotation time in the name of the backups,
+	// app.log becomes app-2006-01-02T15-04-05.000.log.
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+	compressSuffix   = ".gz"
+	megabyte         = 1024 * 1024
+)
+
+// File is an io.WriteCloser appending to a file that is rotated before a write
+// would make it exceed the maximum size, or on the first write of a new day.
+// Rotated files are renamed with the time of the rotation and are compressed
+// and removed in the background.
+type File struct {
+	filename   string
+	maxSize    int64
+	daily      bool
+	maxBackups int
+	maxAge     time.Duration
+	compress   bool
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	day  string
+
+	millCh    chan struct{}
+	millDone  chan struct{}
+	closeOnce sync.Once
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// Option configures a File.
+type Option func(*File)
+
+// WithMaxSize rotates the file before it exceeds megabytes, 0 disables size
+// rotation.
+func WithMaxSize(megabytes int) Option {
+	return func(f *File) {
+		f.maxSize = int64(megabytes) * megabyte
+	}
+}
+
+// WithDaily rotates the file on the first write of a new day, in local time.
+func WithDaily(daily bool) Option {
+	return func(f *File) {
+		f.daily = daily
+	}
+}
+
+// WithMaxBackups keeps at most n rotated files, 0 keeps them all.
+func WithMaxBackups(n int) Option {
+	return func(f *File) {
+		f.maxBackups = n
+	}
+}
+
+// WithMaxAge removes the rotated files older than d, 0 keeps them regardless
+// of their age.
+func WithMaxAge(d time.Duration) Option {
+	return func(f *File) {
+		f.maxAge = d
+	}
+}
+
+// WithCompress gzips the rotated files.
+func WithCompress(compress bool) Option {
+	return func(f *File) {
+		f.compress = compress
+	}
+}
+
+// New opens filename for appending, creating it and its directory if needed.
+func New(filename string, opts ...Option) (*File, error) {
+	if filename == "" {
+		return nil, fmt.Errorf("rotate: empty file name")
+	}
+	f := &File{
+		filename: filename,
+		millCh:   make(chan struct{}, 1),
+		millDone: make(chan struct{}),
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	go f.millRun()
+	f.mill()
+	return f, nil
+}
+
+// Write appends p to the file, rotating it first when needed.
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	now := f.now()
+	if f.daily && now.Format("2006-01-02") != f.day ||
+		f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate renames the current file to a backup and opens a new one.
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.rotate(f.now())
+}
+
+// Reopen closes and reopens the file by name, after it was moved away by an
+// external tool such as logrotate.
+func (f *File) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// Close closes the file and waits for the pending compression and cleanup.
+func (f *File) Close() error {
+	var err error
+	f.closeOnce.Do(func() {
+		f.mu.Lock()
+		if f.file != nil {
+			err = f.file.Close()
+			f.file = nil
+		}
+		f.mu.Unlock()
+		close(f.millCh)
+		<-f.millDone
+	})
+	return err
+}
+
+// open opens the file, the caller holds f.mu or owns f.
+func (f *File) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.filename), 0o755); err != nil {
+		return fmt.Errorf("rotate: %w", err)
+	}
+	file, err := os.OpenFile(f.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("rotate: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("rotate: %w", err)
+	}
+	f.file = file
+	f.size = info.Size()
+	// An existing file belongs to the day it was last written.
+	f.day = f.now().Format("2006-01-02")
+	if info.Size() > 0 {
+		f.day = info.ModTime().Format("2006-01-02")
+	}
+	return nil
+}
+
+// rotate moves the file to a backup and opens a new one, the caller holds f.mu.
+func (f *File) rotate(now time.Time) error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.filename, f.backupName(now)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("rotate: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.mill()
+	return nil
+}
+
+func (f *File) backupName(t time.Time) string {
+	dir, prefix, ext := f.nameParts()
+	return filepath.Join(dir, prefix+t.Format(backupTimeFormat)+ext)
+}
+
+func (f *File) nameParts() (dir, prefix, ext string) {
+	dir = filepath.Dir(f.filename)
+	base := filepath.Base(f.filename)
+	ext = filepath.Ext(base)
+	return dir, strings.TrimSuffix(base, ext) + "-", ext
+}
+
+// mill schedules the compression and cleanup of the backups.
+func (f *File) mill() {
+	select {
+	case f.millCh <- struct{}{}:
+	default:
+	}
+}
+
+func (f *File) millRun() {
+	defer close(f.millDone)
+	for range f.millCh {
+		_ = f.millRunOnce()
+	}
+}
+
+type backup struct {
+	name string
+	t    time.Time
+}
+
+// millRunOnce compresses the backups and removes those exceeding the maximum
+// count or age.
+func (f *File) millRunOnce() error {
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+
+	var remove []backup
+	if f.maxBackups > 0 && len(backups) > f.maxBackups {
+		remove = append(remove, backups[f.maxBackups:]...)
+		backups = backups[:f.maxBackups]
+	}
+	if f.maxAge > 0 {
+		cutoff := f.now().Add(-f.maxAge)
+		kept := backups[:0]
+		for _, b := range backups {
+			if b.t.Before(cutoff) {
+				remove = append(remove, b)
+			} else {
+				kept = append(kept, b)
+			}
+		}
+		backups = kept
+	}
+
+	var errs []string
+	for _, b := range remove {
+		if err := os.Remove(b.name); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err.Error())
+		}
+	}
+	if f.compress {
+		for _, b := range backups {
+			if strings.HasSuffix(b.name, compressSuffix) {
+				continue
+			}
+			if err := compressFile(b.name); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("rotate: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// backups returns the rotated files of f, newest first.
+func (f *File) backups() ([]backup, error) {
+	dir, prefix, ext := f.nameParts()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []backup
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), compressSuffix)
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		t, err := time.ParseInLocation(backupTimeFormat,
+			strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext), time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{name: filepath.Join(dir, e.Name()), t: t})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].t.After(backups[j].t) })
+	return backups, nil
+}
+
+// compressFile gzips name to name.gz and removes name.
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+compressSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(name + compressSuffix)
+		return err
+	}
+	return os.Remove(name)
+}
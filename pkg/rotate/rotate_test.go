@@ -0,0 +1,150 @@
+package rotate
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func write(t *testing.T, f *File, s string) {
+	t.Helper()
+	if _, err := f.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	f, err := New(filepath.Join(dir, "app.log"), WithMaxBackups(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.maxSize = 10
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.Local)
+	f.now = func() time.Time { return now }
+
+	for _, s := range []string{"0123456", "789", "abcdefg", "hijklmn", "opq"} {
+		now = now.Add(time.Second)
+		write(t, f, s)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := files(t, dir)
+	want := []string{"app-2026-01-02T03-04-08.000.log", "app-2026-01-02T03-04-09.000.log", "app.log"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+	content, _ := os.ReadFile(filepath.Join(dir, "app.log"))
+	if string(content) != "hijklmnopq" {
+		t.Errorf("app.log = %q, want %q", content, "hijklmnopq")
+	}
+}
+
+func TestRotateDaily(t *testing.T) {
+	dir := t.TempDir()
+	f, err := New(filepath.Join(dir, "app.log"), WithDaily(true), WithCompress(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	f.now = func() time.Time { return now }
+
+	write(t, f, "today\n")
+	now = now.Add(24 * time.Hour)
+	write(t, f, "tomorrow\n")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := files(t, dir)
+	if len(got) != 2 || !strings.HasSuffix(got[0], ".log.gz") || got[1] != "app.log" {
+		t.Fatalf("files = %v, want a compressed backup and app.log", got)
+	}
+	gz, err := os.Open(filepath.Join(dir, got[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gz.Close()
+	zr, err := gzip.NewReader(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(zr)
+	if string(content) != "today\n" {
+		t.Errorf("backup = %q, want %q", content, "today\n")
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "app-2000-01-01T00-00-00.000.log")
+	if err := os.WriteFile(old, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "other-2000-01-01T00-00-00.000.log")
+	if err := os.WriteFile(other, []byte("other"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := New(filepath.Join(dir, "app.log"), WithMaxAge(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed", old)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("expected the backup of another file to be kept: %v", err)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	f, err := New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	write(t, f, "before\n")
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	write(t, f, "after\n")
+
+	for file, want := range map[string]string{name + ".1": "before\n", name: "after\n"} {
+		content, _ := os.ReadFile(file)
+		if string(content) != want {
+			t.Errorf("%s = %q, want %q", file, content, want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Package secret resolves references to credentials kept outside of the
+// configuration, such as file:///run/secrets/db or env://DB_PASS, so that the
+// credentials never appear in configuration files or on the command line.
+package secret
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Provider resolves the references of one URL scheme.
+type Provider interface {
+	// Resolve returns the secret ref points to.
+	Resolve(ctx context.Context, ref *url.URL) (string, error)
+}
+
+// ProviderFunc is an adapter to use an ordinary function as a Provider.
+type ProviderFunc func(ctx context.Context, ref *url.URL) (string, error)
+
+// Resolve calls f(ctx, ref).
+func (f ProviderFunc) Resolve(ctx context.Context, ref *url.URL) (string, error) {
+	return f(ctx, ref)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]Provider{
+		"file":  ProviderFunc(resolveFile),
+		"env":   ProviderFunc(resolveEnv),
+		"vault": NewVaultProvider("", ""),
+	}
+)
+
+// Register makes a provider available for the references of scheme,
+// replacing any provider registered before for it.
+func Register(scheme string, p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[strings.ToLower(scheme)] = p
+}
+
+func lookup(value string) (Provider, bool) {
+	i := strings.Index(value, "://")
+	if i <= 0 {
+		return nil, false
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := providers[strings.ToLower(value[:i])]
+	return p, ok
+}
+
+// IsReference reports whether value refers to a secret of a registered
+// provider.
+func IsReference(value string) bool {
+	_, ok := lookup(value)
+	return ok
+}
+
+// Resolve returns the secret value refers to, or value itself when it is not
+// a reference. Errors name the reference, never the secret.
+func Resolve(ctx context.Context, value string) (string, error) {
+	p, ok := lookup(value)
+	if !ok {
+		return value, nil
+	}
+	ref, err := url.Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid secret reference: %w", err)
+	}
+	secret, err := p.Resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve secret %s: %w", ref.Redacted(), err)
+	}
+	return secret, nil
+}
+
+// resolveFile reads file:///path, or file://relative/path, without the
+// trailing newline most tools write.
+func resolveFile(_ context.Context, ref *url.URL) (string, error) {
+	data, err := os.ReadFile(filepath.FromSlash(ref.Host + ref.Path))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveEnv reads the environment variable env://NAME.
+func resolveEnv(_ context.Context, ref *url.URL) (string, error) {
+	value, ok := os.LookupEnv(ref.Host)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref.Host)
+	}
+	return value, nil
+}
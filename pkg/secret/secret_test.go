@@ -0,0 +1,98 @@
+package secret
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePlainValue(t *testing.T) {
+	for _, value := range []string{"", "p@ss://word", "s3cret", "unknown://x"} {
+		got, err := Resolve(context.Background(), value)
+		if err != nil {
+			t.Fatalf("Resolve(%q): %v", value, err)
+		}
+		if got != value {
+			t.Errorf("Resolve(%q) = %q, want the value unchanged", value, got)
+		}
+	}
+}
+
+func TestResolveFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "db")
+	if err := os.WriteFile(file, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Resolve(context.Background(), "file://"+filepath.ToSlash(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "s3cret" {
+		t.Errorf("got %q, want %q", got, "s3cret")
+	}
+
+	if _, err := Resolve(context.Background(), "file:///does/not/exist"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestResolveEnv(t *testing.T) {
+	t.Setenv("SECRET_TEST_DB_PASS", "s3cret")
+
+	got, err := Resolve(context.Background(), "env://SECRET_TEST_DB_PASS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "s3cret" {
+		t.Errorf("got %q, want %q", got, "s3cret")
+	}
+
+	if _, err := Resolve(context.Background(), "env://SECRET_TEST_UNSET"); err == nil {
+		t.Error("expected an error for an unset variable")
+	}
+}
+
+func TestVaultProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/db":
+			_, _ = w.Write([]byte(`{"data":{"data":{"password":"s3cret"},"metadata":{"version":1}}}`))
+		case "/v1/kv/db":
+			_, _ = w.Write([]byte(`{"data":{"value":"v1-s3cret"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	Register("vault", NewVaultProvider(srv.URL, "token"))
+	defer Register("vault", NewVaultProvider("", ""))
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{ref: "vault://secret/data/db#password", want: "s3cret"},
+		{ref: "vault://kv/db", want: "v1-s3cret"},
+		{ref: "vault://secret/data/db#user", wantErr: true},
+		{ref: "vault://secret/data/missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Resolve(context.Background(), tt.ref)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("Resolve(%q) error = %v, wantErr %v", tt.ref, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("Resolve(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
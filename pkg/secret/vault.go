@@ -0,0 +1,99 @@
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultVaultField = "value"
+
+// VaultProvider reads secrets from the HTTP API of a Vault compatible server.
+// vault://secret/data/db#password reads the password field of the secret at
+// secret/data/db, the field defaults to value. Both KV version 1 and 2
+// responses are understood.
+type VaultProvider struct {
+	// Address of the server, VAULT_ADDR when empty.
+	Address string
+	// Token sent in X-Vault-Token, VAULT_TOKEN when empty.
+	Token string
+	// Client sends the requests, a client with a 10 seconds timeout when nil.
+	Client *http.Client
+}
+
+// NewVaultProvider creates a VaultProvider for the server at address
+// authenticating with token, empty values are read from VAULT_ADDR and
+// VAULT_TOKEN when a secret is resolved.
+func NewVaultProvider(address, token string) *VaultProvider {
+	return &VaultProvider{Address: address, Token: token}
+}
+
+// Resolve implements Provider.
+func (p *VaultProvider) Resolve(ctx context.Context, ref *url.URL) (string, error) {
+	address, token := p.Address, p.Token
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if address == "" {
+		return "", fmt.Errorf("vault address is not set, set VAULT_ADDR")
+	}
+	field := ref.Fragment
+	if field == "" {
+		field = defaultVaultField
+	}
+
+	endpoint := strings.TrimRight(address, "/") + "/v1/" + ref.Host + ref.Path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return "", fmt.Errorf("vault responded %s", resp.Status)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	data := body.Data
+	// KV version 2 nests the secret and its metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+	value, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("field %q not found", field)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("field %q is not a string", field)
+	}
+	return s, nil
+}
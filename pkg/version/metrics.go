@@ -0,0 +1,21 @@
+package version
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var registerOnce sync.Once
+
+// RegisterMetric registers the build_info gauge, always 1 and labelled with
+// the version information, in the default prometheus registry.
+func RegisterMetric() {
+	registerOnce.Do(func() {
+		prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "build_info",
+			Help:        "Build information of the binary, the value is always 1.",
+			ConstLabels: Get().Labels(),
+		}, func() float64 { return 1 }))
+	})
+}
@@ -0,0 +1,89 @@
+// Package verflag defines the --version flag printing the version information
+// of the binary.
+package verflag
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/767829413/normal-frame/pkg/version"
+	"github.com/spf13/pflag"
+)
+
+type versionValue int
+
+const (
+	versionFalse versionValue = 0
+	versionTrue  versionValue = 1
+	versionRaw   versionValue = 2
+)
+
+const (
+	strRawVersion   = "raw"
+	versionFlagName = "version"
+)
+
+func (v *versionValue) IsBoolFlag() bool {
+	return true
+}
+
+func (v *versionValue) Get() interface{} {
+	return *v
+}
+
+func (v *versionValue) Set(s string) error {
+	if s == strRawVersion {
+		*v = versionRaw
+		return nil
+	}
+	boolVal, err := strconv.ParseBool(s)
+	if boolVal {
+		*v = versionTrue
+	} else {
+		*v = versionFalse
+	}
+	return err
+}
+
+func (v *versionValue) String() string {
+	if *v == versionRaw {
+		return strRawVersion
+	}
+	return fmt.Sprintf("%v", *v == versionTrue)
+}
+
+func (v *versionValue) Type() string {
+	return "version"
+}
+
+var versionFlag = versionFalse
+
+// AddFlags registers the --version flag in fs.
+func AddFlags(fs *pflag.FlagSet) {
+	fs.Var(&versionFlag, versionFlagName, "Print version information and quit, --version=raw prints all the build metadata.")
+	fs.Lookup(versionFlagName).NoOptDefVal = "true"
+}
+
+// PrintAndExitIfRequested prints the version information and exits when
+// --version was given.
+func PrintAndExitIfRequested() {
+	if printIfRequested(os.Stdout) {
+		os.Exit(0)
+	}
+}
+
+// printIfRequested writes the version information requested by --version to
+// w and reports whether there was one.
+func printIfRequested(w io.Writer) bool {
+	switch versionFlag {
+	case versionRaw:
+		fmt.Fprint(w, version.Get().Text())
+	case versionTrue:
+		fmt.Fprintf(w, "%s\n", version.Get())
+	default:
+		return false
+	}
+	return true
+}
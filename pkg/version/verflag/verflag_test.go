@@ -0,0 +1,52 @@
+package verflag
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/767829413/normal-frame/pkg/version"
+	"github.com/spf13/pflag"
+)
+
+func TestVersionFlag(t *testing.T) {
+	defer func(v string) { version.GitVersion = v }(version.GitVersion)
+	version.GitVersion = "v1.2.0"
+
+	for _, tt := range []struct {
+		args []string
+		want string
+		err  bool
+	}{
+		{args: nil},
+		{args: []string{"--version"}, want: "v1.2.0\n"},
+		{args: []string{"--version=true"}, want: "v1.2.0\n"},
+		{args: []string{"--version=false"}},
+		{args: []string{"--version=raw"}, want: version.Get().Text()},
+		{args: []string{"--version=json"}, err: true},
+	} {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			versionFlag = versionFalse
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			fs.SetOutput(&bytes.Buffer{})
+			AddFlags(fs)
+			if err := fs.Parse(tt.args); (err != nil) != tt.err {
+				t.Fatalf("Parse error = %v, want error %v", err, tt.err)
+			}
+			var out bytes.Buffer
+			printed := printIfRequested(&out)
+			if printed != (tt.want != "") || out.String() != tt.want {
+				t.Errorf("printed %v %q, want %q", printed, out.String(), tt.want)
+			}
+		})
+	}
+	versionFlag = versionFalse
+}
+
+func TestVersionValueString(t *testing.T) {
+	for v, want := range map[versionValue]string{versionFalse: "false", versionTrue: "true", versionRaw: "raw"} {
+		if got := v.String(); got != want {
+			t.Errorf("String() = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Package version holds the build metadata of the binary, set at link time
+// with -ldflags, e.g.
+//
+//	go build -ldflags "-X github.com/767829413/normal-frame/pkg/version.GitVersion=v1.2.0 \
+//		-X github.com/767829413/normal-frame/pkg/version.GitCommit=$(git rev-parse HEAD)"
+package version
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// GitVersion is the semantic version of the build, such as v1.2.0.
+	GitVersion = "v0.0.0-master+$Format:%h$"
+	// GitCommit is the sha1 of the commit the binary was built from.
+	GitCommit = "$Format:%H$"
+	// GitTreeState is clean when the tree had no local changes, dirty otherwise.
+	GitTreeState = ""
+	// BuildDate is the build time in ISO8601 format, output of $(date -u +'%Y-%m-%dT%H:%M:%SZ').
+	BuildDate = "1970-01-01T00:00:00Z"
+)
+
+// Info contains versioning information.
+type Info struct {
+	GitVersion   string `json:"gitVersion" yaml:"gitVersion"`
+	GitCommit    string `json:"gitCommit" yaml:"gitCommit"`
+	GitTreeState string `json:"gitTreeState" yaml:"gitTreeState"`
+	BuildDate    string `json:"buildDate" yaml:"buildDate"`
+	GoVersion    string `json:"goVersion" yaml:"goVersion"`
+	Compiler     string `json:"compiler" yaml:"compiler"`
+	Platform     string `json:"platform" yaml:"platform"`
+}
+
+// Get returns the version information of the binary.
+func Get() Info {
+	return Info{
+		GitVersion:   GitVersion,
+		GitCommit:    GitCommit,
+		GitTreeState: GitTreeState,
+		BuildDate:    BuildDate,
+		GoVersion:    runtime.Version(),
+		Compiler:     runtime.Compiler,
+		Platform:     fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
+	}
+}
+
+// String returns the git version.
+func (info Info) String() string {
+	return info.GitVersion
+}
+
+// Text returns the version information as human readable lines.
+func (info Info) Text() string {
+	return fmt.Sprintf("GitVersion:\t%s\nGitCommit:\t%s\nGitTreeState:\t%s\nBuildDate:\t%s\nGoVersion:\t%s\nCompiler:\t%s\nPlatform:\t%s\n",
+		info.GitVersion, info.GitCommit, info.GitTreeState, info.BuildDate, info.GoVersion, info.Compiler, info.Platform)
+}
+
+// JSON returns the version information as indented JSON.
+func (info Info) JSON() string {
+	s, _ := json.MarshalIndent(info, "", "  ")
+	return string(s) + "\n"
+}
+
+// YAML returns the version information as YAML.
+func (info Info) YAML() string {
+	s, _ := yaml.Marshal(info)
+	return string(s)
+}
+
+// Labels returns the version information as metric or instance property
+// labels.
+func (info Info) Labels() map[string]string {
+	return map[string]string{
+		"version":        info.GitVersion,
+		"git_commit":     info.GitCommit,
+		"git_tree_state": info.GitTreeState,
+		"build_date":     info.BuildDate,
+		"go_version":     info.GoVersion,
+		"platform":       info.Platform,
+	}
+}
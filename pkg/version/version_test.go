@@ -0,0 +1,77 @@
+package version
+
+import (
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func testInfo() Info {
+	return Info{
+		GitVersion:   "v1.2.0",
+		GitCommit:    "0123456789abcdef",
+		GitTreeState: "clean",
+		BuildDate:    "2024-05-01T10:00:00Z",
+		GoVersion:    "go1.18.10",
+		Compiler:     "gc",
+		Platform:     "linux/amd64",
+	}
+}
+
+func TestGet(t *testing.T) {
+	defer func(v, c string) { GitVersion, GitCommit = v, c }(GitVersion, GitCommit)
+	GitVersion, GitCommit = "v1.2.0", "0123456789abcdef"
+	info := Get()
+	if info.GitVersion != "v1.2.0" || info.GitCommit != "0123456789abcdef" || info.String() != "v1.2.0" {
+		t.Errorf("Get() = %+v", info)
+	}
+	if info.GoVersion != runtime.Version() || info.Platform != runtime.GOOS+"/"+runtime.GOARCH {
+		t.Errorf("runtime information = %+v", info)
+	}
+}
+
+func TestText(t *testing.T) {
+	want := "GitVersion:\tv1.2.0\nGitCommit:\t0123456789abcdef\nGitTreeState:\tclean\n" +
+		"BuildDate:\t2024-05-01T10:00:00Z\nGoVersion:\tgo1.18.10\nCompiler:\tgc\nPlatform:\tlinux/amd64\n"
+	if got := testInfo().Text(); got != want {
+		t.Errorf("Text() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	out := testInfo().JSON()
+	if !strings.HasSuffix(out, "}\n") || !strings.Contains(out, "\n  \"gitVersion\": \"v1.2.0\",\n") {
+		t.Errorf("JSON() is not indented JSON ending with a newline:\n%s", out)
+	}
+	var info Info
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info != testInfo() {
+		t.Errorf("JSON() decodes to %+v", info)
+	}
+}
+
+func TestYAML(t *testing.T) {
+	out := testInfo().YAML()
+	if !strings.HasPrefix(out, "gitVersion: v1.2.0\ngitCommit: 0123456789abcdef\n") {
+		t.Errorf("YAML() =\n%s", out)
+	}
+	var info Info
+	if err := yaml.Unmarshal([]byte(out), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info != testInfo() {
+		t.Errorf("YAML() decodes to %+v", info)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	labels := testInfo().Labels()
+	if labels["version"] != "v1.2.0" || labels["git_commit"] != "0123456789abcdef" || len(labels) != 6 {
+		t.Errorf("Labels() = %v", labels)
+	}
+}